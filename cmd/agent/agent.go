@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/llmos-ai/llmos/utils/cli"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/llmos-ai/llmos/pkg/agent"
+	"github.com/llmos-ai/llmos/pkg/applyinator"
+	"github.com/llmos-ai/llmos/pkg/bootstrap/kubectl"
+)
+
+func NewAgent() *cobra.Command {
+	return cli.Command(&Agent{}, cobra.Command{
+		Short: "Keep a plan applied and run its periodic instructions and probes",
+		Long: "Apply the plan whenever it changes, run its periodic instructions on their schedule and its probes " +
+			"continuously. The plan is read from a file, a directory of plans merged in lexical order or a Kubernetes " +
+			"Secret the result is written back to. The periodic instructions and probes of the node plan of the bootstrap " +
+			"are kept running next to it. The agent runs as the llmos-agent service after the bootstrap.",
+		SilenceUsage: true,
+	})
+}
+
+type Agent struct {
+	DataDir       string   `usage:"Path to llmos state dir" default:"/var/lib/llmos" env:"LLMOS_DATA_DIR"`
+	Config        string   `usage:"Path to the llmos config providing the encryption, image and plan signature settings" short:"c"`
+	PlanFile      string   `usage:"Path to the JSON or YAML plan to apply (default /etc/llmos/plan.yaml)"`
+	PlanDir       string   `usage:"Path to a directory of JSON or YAML plans merged in lexical order, e.g. /etc/llmos/plans.d"`
+	PlanSecret    string   `usage:"Kubernetes Secret holding the plan in namespace/name form"`
+	Kubeconfig    string   `usage:"Path to the kubeconfig used to read the plan Secret, defaults to the one of the node"`
+	Interval      string   `usage:"Interval between two checks of the plan and runs of the periodic instructions" default:"10s"`
+	ProbeInterval string   `usage:"Interval between two runs of the probes" default:"10s"`
+	RetryInterval string   `usage:"Interval between two applies of a plan whose one-time instructions failed" default:"5m"`
+	Concurrency   int      `usage:"Maximum number of one-time instructions run in parallel" default:"4"`
+	Fact          []string `usage:"Node fact in key=value form the plan templates and when expressions are evaluated against"`
+}
+
+func (a *Agent) Run(cmd *cobra.Command, _ []string) error {
+	opts := agent.Options{
+		DataDir:     a.DataDir,
+		ConfigPath:  a.Config,
+		PlanFile:    a.PlanFile,
+		PlanDir:     a.PlanDir,
+		Concurrency: a.Concurrency,
+		Facts:       applyinator.Facts{},
+	}
+
+	var err error
+	if opts.Interval, err = parseDuration(a.Interval); err != nil {
+		return err
+	}
+	if opts.ProbeInterval, err = parseDuration(a.ProbeInterval); err != nil {
+		return err
+	}
+	if opts.RetryInterval, err = parseDuration(a.RetryInterval); err != nil {
+		return err
+	}
+	for _, fact := range a.Fact {
+		key, value, ok := strings.Cut(fact, "=")
+		if !ok || key == "" {
+			return fmt.Errorf("invalid fact %s, expected key=value", fact)
+		}
+		opts.Facts[key] = value
+	}
+
+	if a.PlanSecret != "" {
+		if a.PlanFile != "" || a.PlanDir != "" {
+			return fmt.Errorf("either a plan file, a plan directory or a plan secret can be applied")
+		}
+		if opts.Source, err = a.secretSource(); err != nil {
+			return err
+		}
+	}
+
+	agt, err := agent.New(opts)
+	if err != nil {
+		return err
+	}
+	return agt.Run(cmd.Context())
+}
+
+func (a *Agent) secretSource() (agent.Source, error) {
+	namespace, name, ok := strings.Cut(a.PlanSecret, "/")
+	if !ok || namespace == "" || name == "" {
+		return nil, fmt.Errorf("invalid plan secret %s, expected namespace/name", a.PlanSecret)
+	}
+	kubeconfig, err := kubectl.GetKubeconfig(a.Kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	restConfig, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("loading kubeconfig %s: %w", kubeconfig, err)
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	return agent.NewSecretSource(client, namespace, name), nil
+}
+
+func parseDuration(value string) (time.Duration, error) {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("parsing duration %s: %w", value, err)
+	}
+	return duration, nil
+}
@@ -25,6 +25,8 @@ type Bootstrap struct {
 	Token             string `usage:"Token to use for join the cluster" env:"LLMOS_TOKEN"`
 	ClusterInit       bool   `usage:"Bootstrap cluster-init role" env:"LLMOS_CLUSTER_INIT"`
 	KubernetesVersion string `usage:"Default kubernetes version to bootstrap" env:"LLMOS_KUBERNETES_VERSION" default:"v1.30.5+k3s1"`
+	DryRun            bool   `usage:"Print the generated node plan without applying it" env:"LLMOS_BOOTSTRAP_DRY_RUN"`
+	RestartFrom       string `usage:"Name of the plan instruction to restart the bootstrap from" env:"LLMOS_BOOTSTRAP_RESTART_FROM"`
 }
 
 func (b *Bootstrap) Run(cmd *cobra.Command, _ []string) error {
@@ -37,6 +39,8 @@ func (b *Bootstrap) Run(cmd *cobra.Command, _ []string) error {
 		Token:             b.Token,
 		ClusterInit:       b.ClusterInit,
 		KubernetesVersion: b.KubernetesVersion,
+		DryRun:            b.DryRun,
+		RestartFrom:       b.RestartFrom,
 	})
 	return boot.Run(cmd.Context())
 }
@@ -0,0 +1,72 @@
+package plan
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/llmos-ai/llmos/utils/cli"
+	"github.com/spf13/cobra"
+
+	"github.com/llmos-ai/llmos/pkg/applyinator"
+	"github.com/llmos-ai/llmos/pkg/cli/plan"
+)
+
+func NewApply() *cobra.Command {
+	return cli.Command(&Apply{}, cobra.Command{
+		Short: "Apply a JSON or YAML plan to the node",
+		Long: "Apply a plan with the same engine as the bootstrap plan. The plan keeps its own state and output " +
+			"under the data dir, named after the plan, and is recorded in the plan history.",
+		SilenceUsage: true,
+	})
+}
+
+type Apply struct {
+	File        string   `usage:"Path to the plan file, - reads the plan from stdin" short:"f"`
+	DataDir     string   `usage:"Path to llmos state dir" default:"/var/lib/llmos" env:"LLMOS_DATA_DIR"`
+	Config      string   `usage:"Path to the llmos config providing the encryption and image settings" short:"c"`
+	Name        string   `usage:"Name of the plan, defaults to the base name of the plan file"`
+	RestartFrom string   `usage:"Run the one-time instructions again starting from the named instruction"`
+	Concurrency int      `usage:"Maximum number of one-time instructions run in parallel" default:"4"`
+	Fact        []string `usage:"Node fact in key=value form the plan templates and when expressions are evaluated against"`
+}
+
+func (a *Apply) Run(cmd *cobra.Command, _ []string) error {
+	if a.File == "" {
+		return fmt.Errorf("--file is required")
+	}
+	facts, err := parseKeyValues(a.Fact)
+	if err != nil {
+		return err
+	}
+
+	return plan.Apply(cmd.Context(), plan.ApplyOptions{
+		File:        a.File,
+		DataDir:     a.DataDir,
+		ConfigPath:  a.Config,
+		Name:        a.Name,
+		RestartFrom: a.RestartFrom,
+		Concurrency: a.Concurrency,
+		Facts:       toFacts(facts),
+	})
+}
+
+func toFacts(values map[string]string) applyinator.Facts {
+	facts := applyinator.Facts{}
+	for key, value := range values {
+		facts[key] = value
+	}
+	return facts
+}
+
+// parseKeyValues parses the key=value flag values.
+func parseKeyValues(values []string) (map[string]string, error) {
+	result := map[string]string{}
+	for _, v := range values {
+		key, value, ok := strings.Cut(v, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid value %s, expected key=value", v)
+		}
+		result[key] = value
+	}
+	return result, nil
+}
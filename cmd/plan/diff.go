@@ -0,0 +1,38 @@
+package plan
+
+import (
+	"os"
+
+	"github.com/llmos-ai/llmos/utils/cli"
+	"github.com/spf13/cobra"
+
+	"github.com/llmos-ai/llmos/pkg/cli/plan"
+)
+
+func NewDiff() *cobra.Command {
+	return cli.Command(&Diff{}, cobra.Command{
+		Use:   "diff [flags] [A] [B]",
+		Short: "Show the differences between two plans",
+		Long: "Show the differences of the files, instructions and probes between two plans. A plan is the time stamp " +
+			"of an applied plan of the node plan, or of the plan selected with --name, see `llmos plan history`, or the path " +
+			"to a plan file. B defaults to the last applied plan and A to the plan applied before it.",
+		Args:         cobra.MaximumNArgs(2),
+		SilenceUsage: true,
+	})
+}
+
+type Diff struct {
+	DataDir string `usage:"Path to llmos state dir" default:"/var/lib/llmos" env:"LLMOS_DATA_DIR"`
+	Name    string `usage:"Name of the plan applied with llmos plan apply to compare, defaults to the node plan"`
+}
+
+func (d *Diff) Run(_ *cobra.Command, args []string) error {
+	opts := plan.DiffOptions{DataDir: d.DataDir, Name: d.Name}
+	if len(args) > 0 {
+		opts.From = args[0]
+	}
+	if len(args) > 1 {
+		opts.To = args[1]
+	}
+	return plan.Diff(os.Stdout, opts)
+}
@@ -0,0 +1,33 @@
+package plan
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/llmos-ai/llmos/utils/cli"
+	"github.com/spf13/cobra"
+
+	"github.com/llmos-ai/llmos/pkg/cli/plan"
+)
+
+func NewHistory() *cobra.Command {
+	return cli.Command(&History{}, cobra.Command{
+		Short: "List the applied plans, the most recent first",
+		Long: "List the applied plans of the node plan, shown as <node>, and of the plans applied with " +
+			"`llmos plan apply`, the most recent first. Every plan has its own history.",
+		SilenceUsage: true,
+	})
+}
+
+type History struct {
+	DataDir string `usage:"Path to llmos state dir" default:"/var/lib/llmos" env:"LLMOS_DATA_DIR"`
+	Name    string `usage:"Name of the plan applied with llmos plan apply to list, defaults to all plans"`
+	Output  string `usage:"Output format, supported: json" short:"o"`
+}
+
+func (h *History) Run(_ *cobra.Command, _ []string) error {
+	if h.Output != "" && h.Output != plan.OutputJSON {
+		return fmt.Errorf("unsupported output format %s", h.Output)
+	}
+	return plan.History(os.Stdout, h.DataDir, h.Name, h.Output)
+}
@@ -0,0 +1,29 @@
+package plan
+
+import (
+	"github.com/llmos-ai/llmos/utils/cli"
+	"github.com/spf13/cobra"
+)
+
+func NewPlan() *cobra.Command {
+	cmd := cli.Command(&Plan{}, cobra.Command{
+		Short: "Manage the node plan",
+	})
+	cmd.AddCommand(
+		NewApply(),
+		NewValidate(),
+		NewShow(),
+		NewHistory(),
+		NewDiff(),
+		NewRollback(),
+		NewSign(),
+		NewRollbackFiles(),
+	)
+	return cmd
+}
+
+type Plan struct{}
+
+func (p *Plan) Run(cmd *cobra.Command, _ []string) error {
+	return cmd.Help()
+}
@@ -0,0 +1,56 @@
+package plan
+
+import (
+	"github.com/llmos-ai/llmos/utils/cli"
+	"github.com/spf13/cobra"
+
+	"github.com/llmos-ai/llmos/pkg/cli/plan"
+)
+
+func NewRollback() *cobra.Command {
+	return cli.Command(&Rollback{}, cobra.Command{
+		Use:   "rollback [flags] TIMESTAMP",
+		Short: "Apply a plan of the plan history again",
+		Long: "Apply the plan applied at the time stamp again, see `llmos plan history`. The time stamp must be one of the " +
+			"node plan, or of the plan selected with --name. Signed plans are applied " +
+			"again from the signed content the history keeps for them, unsigned plans from the history if the encryption " +
+			"is enabled in the config. Without encryption the history of unsigned plans does not record sensitive " +
+			"values: they are only applied again if the sensitive files still have the content of the plan and the " +
+			"values of the sensitive env are passed with --env. The k3s config and token files of the node plan are " +
+			"sensitive and change with every bootstrap, so the node plan can only be rolled back with encryption. " +
+			"Unsigned plans can't be rolled back if plan signatures are enforced. " +
+			"Stop the llmos service first, it would apply its plan again.",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+	})
+}
+
+type Rollback struct {
+	DataDir     string   `usage:"Path to llmos state dir" default:"/var/lib/llmos" env:"LLMOS_DATA_DIR"`
+	Config      string   `usage:"Path to the llmos config providing the encryption and image settings" short:"c"`
+	Name        string   `usage:"Name of the plan applied with llmos plan apply to roll back, defaults to the node plan"`
+	Env         []string `usage:"Value of a sensitive env of the plan instructions in KEY=VALUE form"`
+	Concurrency int      `usage:"Maximum number of one-time instructions run in parallel" default:"4"`
+	Fact        []string `usage:"Node fact in key=value form the plan templates and when expressions are evaluated against"`
+}
+
+func (r *Rollback) Run(cmd *cobra.Command, args []string) error {
+	facts, err := parseKeyValues(r.Fact)
+	if err != nil {
+		return err
+	}
+	env, err := parseKeyValues(r.Env)
+	if err != nil {
+		return err
+	}
+
+	return plan.Rollback(cmd.Context(), plan.RollbackOptions{
+		DataDir:     r.DataDir,
+		ConfigPath:  r.Config,
+		Timestamp:   args[0],
+		Name:        r.Name,
+		Env:         env,
+		Facts:       toFacts(facts),
+		Concurrency: r.Concurrency,
+	})
+}
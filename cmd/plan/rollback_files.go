@@ -0,0 +1,34 @@
+package plan
+
+import (
+	"os"
+
+	"github.com/llmos-ai/llmos/utils/cli"
+	"github.com/spf13/cobra"
+
+	"github.com/llmos-ai/llmos/pkg/cli/plan"
+)
+
+func NewRollbackFiles() *cobra.Command {
+	return cli.Command(&RollbackFiles{}, cobra.Command{
+		Use:   "rollback-files",
+		Short: "Restore the files of the previous plan after the last applied plan failed",
+		Long: "Restore the files overwritten by the last applied plan to the content of the previous plan, " +
+			"and remove the files it created. Stop the llmos service first, it would apply the failed plan again.",
+		SilenceUsage: true,
+	})
+}
+
+type RollbackFiles struct {
+	DataDir  string `usage:"Path to llmos state dir" default:"/var/lib/llmos" env:"LLMOS_DATA_DIR"`
+	Checksum string `usage:"Checksum of the plan to roll back, defaults to the last applied plan"`
+	Force    bool   `usage:"Restore the files even if the plan did not fail" short:"f"`
+}
+
+func (r *RollbackFiles) Run(_ *cobra.Command, _ []string) error {
+	return plan.RollbackFiles(os.Stdout, plan.RollbackFilesOptions{
+		DataDir:  r.DataDir,
+		Checksum: r.Checksum,
+		Force:    r.Force,
+	})
+}
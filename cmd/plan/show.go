@@ -0,0 +1,31 @@
+package plan
+
+import (
+	"os"
+
+	"github.com/llmos-ai/llmos/utils/cli"
+	"github.com/spf13/cobra"
+
+	"github.com/llmos-ai/llmos/pkg/cli/plan"
+)
+
+func NewShow() *cobra.Command {
+	return cli.Command(&Show{}, cobra.Command{
+		Use:          "show [flags] [FILE]",
+		Short:        "Print a plan with its sensitive values redacted, the last applied node plan by default",
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+	})
+}
+
+type Show struct {
+	DataDir string `usage:"Path to llmos state dir" default:"/var/lib/llmos" env:"LLMOS_DATA_DIR"`
+}
+
+func (s *Show) Run(_ *cobra.Command, args []string) error {
+	var path string
+	if len(args) > 0 {
+		path = args[0]
+	}
+	return plan.Show(os.Stdout, path, s.DataDir)
+}
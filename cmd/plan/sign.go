@@ -0,0 +1,38 @@
+package plan
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/llmos-ai/llmos/utils/cli"
+	"github.com/spf13/cobra"
+
+	"github.com/llmos-ai/llmos/pkg/cli/plan"
+)
+
+func NewSign() *cobra.Command {
+	return cli.Command(&Sign{}, cobra.Command{
+		Use:   "sign [flags] FILE...",
+		Short: "Sign plan files with an ed25519 key",
+		Long: "Write the detached signature of every plan file next to it with a .sig suffix. The nodes verify the " +
+			"signatures against the public keys in /etc/llmos/trust, and refuse unsigned plans if planSignature.enforce " +
+			"is set in their config. A key is generated with --generate-key or `openssl genpkey -algorithm ed25519`.",
+		SilenceUsage: true,
+	})
+}
+
+type Sign struct {
+	Key         string `usage:"Path to the PEM encoded ed25519 private key" short:"k"`
+	GenerateKey bool   `usage:"Generate the private key and its .pub public key if the key does not exist"`
+}
+
+func (s *Sign) Run(_ *cobra.Command, args []string) error {
+	if s.Key == "" {
+		return fmt.Errorf("--key is required")
+	}
+	return plan.Sign(os.Stdout, plan.SignOptions{
+		Key:         s.Key,
+		GenerateKey: s.GenerateKey,
+		Files:       args,
+	})
+}
@@ -0,0 +1,27 @@
+package plan
+
+import (
+	"os"
+
+	"github.com/llmos-ai/llmos/utils/cli"
+	"github.com/spf13/cobra"
+
+	"github.com/llmos-ai/llmos/pkg/cli/plan"
+)
+
+func NewValidate() *cobra.Command {
+	return cli.Command(&Validate{}, cobra.Command{
+		Use:          "validate [flags] FILE",
+		Short:        "Validate a JSON or YAML plan and its signature without applying it",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+	})
+}
+
+type Validate struct {
+	Config string `usage:"Path to the llmos config providing the plan signature settings" short:"c"`
+}
+
+func (v *Validate) Run(_ *cobra.Command, args []string) error {
+	return plan.Validate(os.Stdout, args[0], v.Config)
+}
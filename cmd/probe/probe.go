@@ -12,14 +12,18 @@ import (
 
 func NewProbe() *cobra.Command {
 	return cli.Command(&Probe{}, cobra.Command{
-		Short:  "Run plan probes",
-		Hidden: true,
+		Short:        "Run plan probes",
+		Hidden:       true,
+		SilenceUsage: true,
 	})
 }
 
 type Probe struct {
-	Interval string `usage:"Polling interval to run probes" default:"2s" short:"i"`
-	File     string `usage:"Plan file" default:"/var/lib/llmos/plan/plan.json" short:"f"`
+	Interval string   `usage:"Polling interval to run probes" default:"2s" short:"i"`
+	Timeout  string   `usage:"Fail if the probes are not healthy within the duration, 0 waits until they are" default:"0"`
+	File     string   `usage:"Plan file" default:"/var/lib/llmos/plan/plan.json" short:"f"`
+	Name     []string `usage:"Only run the probes with the given names"`
+	Output   string   `usage:"Write the final probe statuses to stdout in the given format, supported: json" short:"o"`
 }
 
 func (p *Probe) Run(cmd *cobra.Command, _ []string) error {
@@ -27,6 +31,18 @@ func (p *Probe) Run(cmd *cobra.Command, _ []string) error {
 	if err != nil {
 		return fmt.Errorf("parsing duration %s: %w", p.Interval, err)
 	}
+	timeout, err := time.ParseDuration(p.Timeout)
+	if err != nil {
+		return fmt.Errorf("parsing duration %s: %w", p.Timeout, err)
+	}
+	if p.Output != "" && p.Output != probe.OutputJSON {
+		return fmt.Errorf("unsupported output format %s", p.Output)
+	}
 
-	return probe.RunProbes(cmd.Context(), p.File, interval)
+	return probe.RunProbes(cmd.Context(), p.File, probe.Options{
+		Interval: interval,
+		Timeout:  timeout,
+		Names:    p.Name,
+		Output:   p.Output,
+	})
 }
@@ -1,6 +1,8 @@
 package retry
 
 import (
+	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/llmos-ai/llmos/utils/cli"
@@ -11,19 +13,75 @@ import (
 
 func NewRetry() *cobra.Command {
 	return cli.Command(&Retry{}, cobra.Command{
-		Short:              "Retry command until it succeeds",
-		DisableFlagParsing: true,
-		Hidden:             true,
+		Use:          "retry [flags] -- command [args...]",
+		Short:        "Retry command until it succeeds",
+		Hidden:       true,
+		SilenceUsage: true,
 	})
 }
 
 type Retry struct {
-	SleepFirst bool `usage:"Sleep 5 seconds before running command"`
+	SleepFirst       bool     `usage:"Sleep 5 seconds before running command"`
+	MaxAttempts      int      `usage:"Maximum number of attempts, 0 retries until the timeout is reached" default:"30"`
+	Timeout          string   `usage:"Stop retrying and kill the command after the duration, 0 disables the timeout" default:"30m"`
+	Interval         string   `usage:"Interval after the first failed attempt, doubled after every further failure" default:"5s"`
+	MaxInterval      string   `usage:"Maximum interval between two attempts" default:"1m"`
+	RetryOnExitCodes []string `usage:"Only retry the command when it exits with one of these codes, a command killed by a signal is always retried"`
+	FailOnExitCodes  []string `usage:"Never retry the command when it exits with one of these codes"`
+}
+
+// Customize stops flag parsing at the first argument, so that the flags of the retried command are passed through.
+func (p *Retry) Customize(cmd *cobra.Command) {
+	cmd.Flags().SetInterspersed(false)
 }
 
 func (p *Retry) Run(cmd *cobra.Command, args []string) error {
+	opts := retry.Options{
+		MaxAttempts: p.MaxAttempts,
+	}
+
+	var err error
+	if opts.Timeout, err = parseDuration(p.Timeout); err != nil {
+		return err
+	}
+	if opts.Interval, err = parseDuration(p.Interval); err != nil {
+		return err
+	}
+	if opts.MaxInterval, err = parseDuration(p.MaxInterval); err != nil {
+		return err
+	}
+	if opts.RetryOnExitCodes, err = parseExitCodes(p.RetryOnExitCodes); err != nil {
+		return err
+	}
+	if opts.FailOnExitCodes, err = parseExitCodes(p.FailOnExitCodes); err != nil {
+		return err
+	}
+
 	if p.SleepFirst {
 		time.Sleep(5 * time.Second)
 	}
-	return retry.Retry(cmd.Context(), 15*time.Second, args)
+	return retry.Retry(cmd.Context(), opts, args)
+}
+
+func parseDuration(value string) (time.Duration, error) {
+	if value == "" || value == "0" {
+		return 0, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("parsing duration %s: %w", value, err)
+	}
+	return duration, nil
+}
+
+func parseExitCodes(values []string) ([]int, error) {
+	codes := make([]int, 0, len(values))
+	for _, value := range values {
+		code, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("parsing exit code %s: %w", value, err)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
 }
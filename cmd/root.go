@@ -12,11 +12,14 @@ import (
 	"github.com/spf13/cobra"
 	"k8s.io/klog/v2"
 
+	"github.com/llmos-ai/llmos/cmd/agent"
 	"github.com/llmos-ai/llmos/cmd/bootstrap"
 	"github.com/llmos-ai/llmos/cmd/gettoken"
 	"github.com/llmos-ai/llmos/cmd/info"
+	"github.com/llmos-ai/llmos/cmd/plan"
 	"github.com/llmos-ai/llmos/cmd/probe"
 	"github.com/llmos-ai/llmos/cmd/retry"
+	"github.com/llmos-ai/llmos/cmd/status"
 	"github.com/llmos-ai/llmos/cmd/version"
 )
 
@@ -41,8 +44,11 @@ func NewRootCmd() *cobra.Command {
 
 	root.AddCommand(
 		bootstrap.NewBootstrap(),
+		agent.NewAgent(),
 		probe.NewProbe(),
+		plan.NewPlan(),
 		retry.NewRetry(),
+		status.NewStatus(),
 		gettoken.NewGetToken(),
 		info.NewInfo(),
 		version.NewVersion(),
@@ -0,0 +1,45 @@
+package status
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/llmos-ai/llmos/utils/cli"
+	"github.com/spf13/cobra"
+
+	"github.com/llmos-ai/llmos/pkg/cli/status"
+)
+
+func NewStatus() *cobra.Command {
+	return cli.Command(&Status{}, cobra.Command{
+		Short:        "Print the bootstrap progress of the node",
+		SilenceUsage: true,
+	})
+}
+
+type Status struct {
+	DataDir  string `usage:"Path to llmos state dir" default:"/var/lib/llmos" env:"LLMOS_DATA_DIR"`
+	Output   string `usage:"Output format, supported: json" short:"o"`
+	Watch    bool   `usage:"Refresh the status until interrupted" short:"w"`
+	Interval string `usage:"Refresh interval in watch mode" default:"2s" short:"i"`
+	Lines    int    `usage:"Number of output lines shown per instruction" default:"3"`
+}
+
+func (s *Status) Run(cmd *cobra.Command, _ []string) error {
+	interval, err := time.ParseDuration(s.Interval)
+	if err != nil {
+		return fmt.Errorf("parsing duration %s: %w", s.Interval, err)
+	}
+	if s.Output != "" && s.Output != status.OutputJSON {
+		return fmt.Errorf("unsupported output format %s", s.Output)
+	}
+
+	return status.Run(cmd.Context(), os.Stdout, status.Options{
+		DataDir:  s.DataDir,
+		Output:   s.Output,
+		Watch:    s.Watch,
+		Interval: interval,
+		Lines:    s.Lines,
+	})
+}
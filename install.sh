@@ -153,12 +153,14 @@ setup_env() {
 
     # --- set related files from system name ---
     SERVICE_LLMOS=${SYSTEM_NAME}.service
+    SERVICE_LLMOS_AGENT=${SYSTEM_NAME}-agent.service
     UNINSTALL_LLMOS_SH=${UNINSTALL_LLMOS_SH:-${BIN_DIR}/${SYSTEM_NAME}-uninstall.sh}
 
     # --- use service or environment location depending on systemd/openrc ---
 	if [ "${HAS_SYSTEMD}" = true ]; then
 		FILE_LLMOS_SERVICE=${SYSTEMD_DIR}/${SERVICE_LLMOS}
 		FILE_LLMOS_ENV=${SYSTEMD_DIR}/${SERVICE_LLMOS}.env
+		FILE_LLMOS_AGENT_SERVICE=${SYSTEMD_DIR}/${SERVICE_LLMOS_AGENT}
     elif [ "${HAS_OPENRC}" = true ]; then
 		$SUDO mkdir -p /etc/llmos
 		FILE_LLMOS_SERVICE=/etc/init.d/${SYSTEM_NAME}
@@ -377,6 +379,7 @@ LLMOS_DATA_DIR=\${LLMOS_DATA_DIR:-/var/lib/llmos}
 KUBE_UNINSTALL=
 
 if command -v systemctl; then
+    systemctl disable --now ${SYSTEM_NAME}-agent
     systemctl disable ${SYSTEM_NAME}
     systemctl reset-failed ${SYSTEM_NAME}
     systemctl daemon-reload
@@ -387,6 +390,7 @@ fi
 
 rm -f ${FILE_LLMOS_SERVICE}
 rm -f ${FILE_LLMOS_ENV}
+rm -f ${FILE_LLMOS_AGENT_SERVICE}
 
 if [ -f /etc/systemd/system/k3s.service ]; then
 	KUBE_UNINSTALL=k3s-uninstall.sh
@@ -423,7 +427,9 @@ EOF
 # --- disable current service if loaded --
 systemd_disable() {
     $SUDO systemctl disable ${SYSTEM_NAME} >/dev/null 2>&1 || true
+    $SUDO systemctl disable ${SYSTEM_NAME}-agent >/dev/null 2>&1 || true
     $SUDO rm -f /etc/systemd/system/${SERVICE_LLMOS} || true
+    $SUDO rm -f /etc/systemd/system/${SERVICE_LLMOS_AGENT} || true
     $SUDO rm -f /etc/systemd/system/${SERVICE_LLMOS}.env || true
 }
 
@@ -470,6 +476,29 @@ LimitCORE=infinity
 TasksMax=infinity
 TimeoutStartSec=0
 ExecStart=${BIN_DIR}/llmos bootstrap ${CMD_LLMOS_EXEC}
+EOF
+
+    info "systemd: Creating service file ${FILE_LLMOS_AGENT_SERVICE}"
+    $SUDO tee ${FILE_LLMOS_AGENT_SERVICE} >/dev/null << EOF
+[Unit]
+Description=LLMOS Agent
+Documentation=https://github.com/llmos-ai/llmos
+Wants=network-online.target
+After=network-online.target ${SERVICE_LLMOS}
+
+[Install]
+WantedBy=multi-user.target
+
+[Service]
+Type=simple
+EnvironmentFile=-/etc/default/%N
+EnvironmentFile=-/etc/sysconfig/%N
+EnvironmentFile=-${FILE_LLMOS_ENV}
+KillMode=process
+LimitNOFILE=1048576
+Restart=always
+RestartSec=5s
+ExecStart=${BIN_DIR}/llmos agent
 EOF
 }
 
@@ -521,19 +550,21 @@ EOF
 
 # --- get hashes of the current llmos bin and service files
 get_installed_hashes() {
-    $SUDO sha256sum ${BIN_DIR}/llmos ${FILE_LLMOS_SERVICE} ${FILE_LLMOS_ENV} 2>&1 || true
+    $SUDO sha256sum ${BIN_DIR}/llmos ${FILE_LLMOS_SERVICE} ${FILE_LLMOS_ENV} ${FILE_LLMOS_AGENT_SERVICE} 2>&1 || true
 }
 
 # --- enable and start systemd service ---
 systemd_enable() {
     info "systemd: Enabling ${SYSTEM_NAME} unit"
     $SUDO systemctl enable ${FILE_LLMOS_SERVICE} >/dev/null
+    $SUDO systemctl enable ${FILE_LLMOS_AGENT_SERVICE} >/dev/null
     $SUDO systemctl daemon-reload >/dev/null
 }
 
 systemd_start() {
     info "systemd: Starting ${SYSTEM_NAME}"
     $SUDO systemctl restart --no-block ${SYSTEM_NAME}
+    $SUDO systemctl restart --no-block ${SYSTEM_NAME}-agent
     info "Run \"journalctl -u ${SYSTEM_NAME} -f\" to watch logs"
 }
 
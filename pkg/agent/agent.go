@@ -0,0 +1,433 @@
+// Package agent keeps a plan applied on the node after the bootstrap. It reloads the plan of its source when it
+// changes, runs its periodic instructions on their schedule and its probes continuously.
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/llmos-ai/llmos/pkg/applyinator"
+	"github.com/llmos-ai/llmos/pkg/applyinator/image"
+	"github.com/llmos-ai/llmos/pkg/applyinator/prober"
+	"github.com/llmos-ai/llmos/pkg/bootstrap/config"
+	"github.com/llmos-ai/llmos/pkg/bootstrap/plan"
+	"github.com/llmos-ai/llmos/pkg/utils/crypt"
+	"github.com/llmos-ai/llmos/pkg/utils/signature"
+)
+
+const (
+	DefaultPlanFile      = "/etc/llmos/plan.yaml"
+	DefaultInterval      = 10 * time.Second
+	DefaultRetryInterval = 5 * time.Minute
+
+	oneTimeAttempts = 3
+)
+
+// Options configures the agent.
+type Options struct {
+	DataDir string
+	// ConfigPath is the llmos config providing the encryption, image and plan signature settings
+	ConfigPath string
+	// PlanFile is the JSON or YAML plan applied by the agent, used if no other source is set
+	PlanFile string
+	// PlanDir holds JSON or YAML plans merged in lexical order
+	PlanDir string
+	// Source of the plan, overrides the plan file and directory
+	Source Source
+	// Interval between two checks of the plan and runs of the periodic instructions
+	Interval time.Duration
+	// ProbeInterval between two runs of the probes
+	ProbeInterval time.Duration
+	// RetryInterval between two applies of a plan whose one-time instructions failed
+	RetryInterval time.Duration
+	Concurrency   int
+	Facts         applyinator.Facts
+}
+
+// Agent applies the plan and keeps its periodic instructions and probes running. The periodic instructions and
+// probes of the node plan of the bootstrap are kept running next to it.
+type Agent struct {
+	opts        Options
+	reconcilers []*reconciler
+	cipher      *crypt.Cipher
+	trust       *signature.TrustStore
+
+	mu       sync.Mutex
+	statuses map[string]prober.ProbeStatus
+}
+
+// reconciler keeps the plan of a source applied, with its own applyinator, history, backups and state in its
+// directory.
+type reconciler struct {
+	source Source
+	dir    string
+	apply  *applyinator.Applyinator
+	facts  func() applyinator.Facts
+
+	// restored is the plan state recorded before the agent restarted, it is checked against the first plan loaded
+	restored *applyinator.PlanState
+	// checksums of the plans whose one-time instructions succeeded and failed the last time, and the number of
+	// times the failed plan failed in a row
+	applied     string
+	failed      string
+	failures    int
+	lastAttempt time.Time
+
+	// probes of the plan, guarded by the mutex of the agent
+	probes map[string]prober.Probe
+}
+
+// New returns an agent for the options, the llmos config is loaded from the config path.
+func New(opts Options) (*Agent, error) {
+	source := opts.Source
+	switch {
+	case source != nil:
+	case opts.PlanDir != "" && opts.PlanFile != "":
+		return nil, fmt.Errorf("either a plan file or a plan directory can be applied")
+	case opts.PlanDir != "":
+		source = NewDirSource(opts.PlanDir)
+	case opts.PlanFile != "":
+		source = NewFileSource(opts.PlanFile)
+	default:
+		source = NewFileSource(DefaultPlanFile)
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.ProbeInterval <= 0 {
+		opts.ProbeInterval = DefaultInterval
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = DefaultRetryInterval
+	}
+
+	cfg, err := config.Load(opts.ConfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	cipher, err := crypt.Open(cfg.Encryption)
+	if err != nil {
+		return nil, fmt.Errorf("opening encryption key: %w", err)
+	}
+	enforced, err := signature.Open(cfg.PlanSignature)
+	if err != nil {
+		return nil, err
+	}
+	trust := enforced
+	if trust == nil {
+		dir := signature.DefaultTrustDir
+		if cfg.PlanSignature != nil && cfg.PlanSignature.TrustDir != "" {
+			dir = cfg.PlanSignature.TrustDir
+		}
+		if trust, err = signature.LoadTrustStore(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	images := image.NewUtility(cfg.ImageUtility)
+	newReconciler := func(source Source, dir string) *reconciler {
+		apply := applyinator.NewApplyinator(filepath.Join(dir, "work"), false, filepath.Join(dir, "applied"), "", images)
+		apply.SetCipher(cipher)
+		apply.SetBackupStore(applyinator.NewBackupStore(filepath.Join(dir, "backup"), cipher))
+		return &reconciler{source: source, dir: dir, apply: apply}
+	}
+
+	// the node plan is generated by llmos like the one applied by the bootstrap, it is not signed
+	bootstrap := &bootstrapSource{dataDir: opts.DataDir}
+	bootstrapReconciler := newReconciler(bootstrap, GetBootstrapDir(opts.DataDir))
+	bootstrapReconciler.facts = bootstrap.Facts
+
+	sourceReconciler := newReconciler(source, GetAgentDir(opts.DataDir))
+	sourceReconciler.apply.SetTrustStore(enforced)
+	sourceReconciler.facts = func() applyinator.Facts { return opts.Facts }
+
+	return &Agent{
+		opts:        opts,
+		reconcilers: []*reconciler{bootstrapReconciler, sourceReconciler},
+		cipher:      cipher,
+		trust:       trust,
+	}, nil
+}
+
+// Run applies the plan and runs its periodic instructions and probes until the context is done.
+func (a *Agent) Run(ctx context.Context) error {
+	var sources []string
+	for _, r := range a.reconcilers {
+		if err := os.MkdirAll(r.dir, 0700); err != nil {
+			return err
+		}
+		state, err := applyinator.ReadPlanState(filepath.Join(r.dir, "state.json"))
+		if err != nil {
+			return fmt.Errorf("reading plan state: %w", err)
+		}
+		r.restored = state
+		sources = append(sources, r.source.String())
+	}
+	logrus.Infof("Starting llmos agent for %s", strings.Join(sources, " and "))
+
+	changed := make(chan struct{}, 1)
+	var wg sync.WaitGroup
+	wg.Add(1 + len(a.reconcilers))
+	go func() {
+		defer wg.Done()
+		a.runProbes(ctx)
+	}()
+	for _, r := range a.reconcilers {
+		go func(source Source) {
+			defer wg.Done()
+			if err := source.Watch(ctx, changed); err != nil {
+				logrus.Warnf("Failed to watch %s, checking it every %s: %v", source, a.opts.Interval, err)
+			}
+		}(r.source)
+	}
+
+	for {
+		for _, r := range a.reconcilers {
+			if err := a.reconcile(ctx, r); err != nil {
+				logrus.Errorf("failed to apply %s: %v", r.source, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return nil
+		case <-changed:
+		case <-time.After(a.opts.Interval):
+		}
+	}
+}
+
+// reconcile applies the plan of the source if it changed or its one-time instructions failed, and runs the
+// periodic instructions that are due otherwise.
+func (a *Agent) reconcile(ctx context.Context, r *reconciler) error {
+	calculated, err := r.source.Load(ctx, a.trust)
+	if err != nil {
+		return err
+	} else if calculated == nil {
+		logrus.Debugf("No plan to apply from %s", r.source)
+		return nil
+	}
+
+	if r.restored != nil {
+		// a plan applied before the restart is not applied again, its periodic instructions keep their schedule.
+		// A plan whose apply was interrupted is resumed, its completed instructions are skipped.
+		if r.restored.Checksum == calculated.Checksum && completed(r.restored, calculated.Plan) {
+			r.applied = calculated.Checksum
+		}
+		r.restored = nil
+	}
+
+	a.mu.Lock()
+	r.probes = calculated.Plan.Probes
+	a.mu.Unlock()
+
+	full := calculated.Checksum != r.applied
+	if full && calculated.Checksum == r.failed && time.Since(r.lastAttempt) < a.opts.RetryInterval {
+		// a failed plan is applied again once the retry interval passed, its periodic instructions keep running
+		full = false
+	}
+	output, err := a.applyPlan(ctx, r, *calculated, full)
+
+	status := Status{
+		AppliedChecksum: r.applied,
+		FailedChecksum:  r.failed,
+		Failures:        r.failures,
+		OneTimeOutput:   output.OneTimeOutput,
+		PeriodicOutput:  output.PeriodicOutput,
+		ProbeStatuses:   a.probeStatuses(calculated.Plan.Probes),
+	}
+	if reportErr := r.source.Report(ctx, status); reportErr != nil {
+		logrus.Errorf("failed to report the status of the plan to %s: %v", r.source, reportErr)
+	}
+	return err
+}
+
+// applyPlan applies the plan. The files are reconciled and the one-time instructions are run if full is set,
+// otherwise only the periodic instructions that are due are run.
+func (a *Agent) applyPlan(ctx context.Context, r *reconciler, calculated applyinator.CalculatedPlan, full bool) (*applyinator.ApplyOutput, error) {
+	outputFile, periodicOutputFile := filepath.Join(r.dir, "output.json"), filepath.Join(r.dir, "periodic-output.json")
+	existingOutput, err := plan.LoadOutput(outputFile)
+	if err != nil {
+		return &applyinator.ApplyOutput{}, err
+	}
+	existingPeriodicOutput, err := plan.LoadOutput(periodicOutputFile)
+	if err != nil {
+		return &applyinator.ApplyOutput{}, err
+	}
+
+	if full {
+		logrus.Infof("Applying plan with checksum %s from %s", calculated.Checksum, r.source)
+	}
+	output, err := r.apply.Apply(ctx, applyinator.ApplyInput{
+		CalculatedPlan:                calculated,
+		RunOneTimeInstructions:        full,
+		ReconcileFiles:                full,
+		Facts:                         r.facts(),
+		OneTimeInstructionAttempts:    oneTimeAttempts,
+		OneTimeInstructionConcurrency: a.opts.Concurrency,
+		ExistingOneTimeOutput:         existingOutput,
+		ExistingPeriodicOutput:        existingPeriodicOutput,
+		StateFile:                     filepath.Join(r.dir, "state.json"),
+		ManagedFilesFile:              filepath.Join(r.dir, "managed-files.json"),
+	})
+	if err != nil {
+		if full {
+			r.fail(calculated.Checksum)
+		}
+		return &applyinator.ApplyOutput{}, err
+	}
+
+	// keep the periodic output between restarts, so that the periods and the failure cooldown are honored
+	if err = plan.SaveOutput(output.PeriodicOutput, periodicOutputFile, a.cipher); err != nil {
+		return &output, err
+	}
+	if !output.PeriodicApplySucceeded {
+		logrus.Warnf("Periodic instructions of plan %s failed, see %s", calculated.Checksum, periodicOutputFile)
+	}
+	if !full {
+		output.OneTimeOutput = nil
+		return &output, nil
+	}
+
+	if err = plan.SaveOutput(output.OneTimeOutput, outputFile, a.cipher); err != nil {
+		return &output, err
+	}
+	if !output.OneTimeApplySucceeded {
+		r.fail(calculated.Checksum)
+		return &output, fmt.Errorf("one-time instructions of plan %s failed, retrying in %s", calculated.Checksum, a.opts.RetryInterval)
+	}
+	r.applied, r.failed, r.failures = calculated.Checksum, "", 0
+	logrus.Infof("Successfully applied plan %s", calculated.Checksum)
+	return &output, nil
+}
+
+// fail records that the one-time instructions of the plan failed.
+func (r *reconciler) fail(checksum string) {
+	if r.failed != checksum {
+		r.failures = 0
+	}
+	r.failed, r.lastAttempt = checksum, time.Now()
+	r.failures++
+}
+
+// completed returns true if every one-time instruction of the plan succeeded or was skipped according to the
+// state. Instructions without a name are not recorded in the state and can't be resumed.
+func completed(state *applyinator.PlanState, p applyinator.Plan) bool {
+	for _, instruction := range p.OneTimeInstructions {
+		if instruction.Name == "" {
+			continue
+		}
+		switch state.Instructions[instruction.Name].State {
+		case applyinator.InstructionSucceeded, applyinator.InstructionSkipped:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// probeStatuses returns the last statuses of the probes.
+func (a *Agent) probeStatuses(probes map[string]prober.Probe) map[string]prober.ProbeStatus {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	statuses := map[string]prober.ProbeStatus{}
+	for name := range probes {
+		if status, ok := a.statuses[name]; ok {
+			statuses[name] = status
+		}
+	}
+	return statuses
+}
+
+// runProbes runs the probes of the current plan every probe interval and records their statuses.
+func (a *Agent) runProbes(ctx context.Context) {
+	statuses := map[string]prober.ProbeStatus{}
+	initial := true
+	for {
+		// the probes of the plan of the source override the ones of the node plan with the same name
+		probes := map[string]prober.Probe{}
+		a.mu.Lock()
+		for _, r := range a.reconcilers {
+			for name, probe := range r.probes {
+				probes[name] = probe
+			}
+		}
+		a.mu.Unlock()
+
+		if len(probes) > 0 {
+			current := map[string]prober.ProbeStatus{}
+			for name := range probes {
+				if status, ok := statuses[name]; ok {
+					current[name] = status
+				}
+			}
+			prober.DoProbes(probes, current, initial)
+			initial = false
+
+			for name, status := range current {
+				if previous, ok := statuses[name]; !ok || previous.Healthy != status.Healthy {
+					if status.Healthy {
+						logrus.Infof("Probe [%s] is healthy", name)
+					} else {
+						logrus.Warnf("Probe [%s] is unhealthy", name)
+					}
+				}
+			}
+			statuses = current
+			a.mu.Lock()
+			a.statuses = statuses
+			a.mu.Unlock()
+			if err := a.writeProbeStatuses(statuses); err != nil {
+				logrus.Errorf("failed to write probe statuses: %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(a.opts.ProbeInterval):
+		}
+	}
+}
+
+func (a *Agent) writeProbeStatuses(statuses map[string]prober.ProbeStatus) error {
+	content, err := json.Marshal(statuses)
+	if err != nil {
+		return err
+	}
+	return a.cipher.WriteFile(GetProbeStatusFile(a.opts.DataDir), content, 0600)
+}
+
+// GetAgentDir returns the directory holding the state of the plan applied by the agent.
+func GetAgentDir(dataDir string) string {
+	return filepath.Join(dataDir, "agent")
+}
+
+// GetBootstrapDir returns the directory holding the state of the node plan of the bootstrap kept running by the
+// agent.
+func GetBootstrapDir(dataDir string) string {
+	return filepath.Join(GetAgentDir(dataDir), "bootstrap")
+}
+
+// GetStateFile returns the per-instruction completion record of the plan applied by the agent.
+func GetStateFile(dataDir string) string {
+	return filepath.Join(GetAgentDir(dataDir), "state.json")
+}
+
+// GetPeriodicOutputFile returns the output of the periodic instructions, kept between restarts of the agent.
+func GetPeriodicOutputFile(dataDir string) string {
+	return filepath.Join(GetAgentDir(dataDir), "periodic-output.json")
+}
+
+// GetProbeStatusFile returns the last statuses of the probes of the plan.
+func GetProbeStatusFile(dataDir string) string {
+	return filepath.Join(GetAgentDir(dataDir), "probe-status.json")
+}
@@ -0,0 +1,207 @@
+package agent_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/llmos-ai/llmos/pkg/agent"
+	"github.com/llmos-ai/llmos/pkg/applyinator"
+	"github.com/llmos-ai/llmos/pkg/applyinator/prober"
+	"github.com/llmos-ai/llmos/pkg/bootstrap/plan"
+)
+
+var _ = Describe("agent", Label("agent"), func() {
+	var (
+		dir      string
+		planFile string
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		planFile = filepath.Join(dir, "plan.yaml")
+	})
+
+	writePlan := func(plan applyinator.Plan) {
+		content, err := json.Marshal(plan)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.WriteFile(planFile, content, 0600)).To(Succeed())
+	}
+
+	start := func() context.CancelFunc {
+		a, err := agent.New(agent.Options{
+			DataDir:       dir,
+			PlanFile:      planFile,
+			Interval:      50 * time.Millisecond,
+			ProbeInterval: 50 * time.Millisecond,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			defer GinkgoRecover()
+			Expect(a.Run(ctx)).To(Succeed())
+		}()
+		return func() {
+			cancel()
+			Eventually(done).Should(BeClosed())
+		}
+	}
+
+	failures := func(name string) int {
+		outputs := map[string]applyinator.PeriodicInstructionOutput{}
+		// the agent rewrites the output while it is read, retry until a whole output was read
+		Eventually(func() error {
+			content, err := os.ReadFile(agent.GetPeriodicOutputFile(dir))
+			if os.IsNotExist(err) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			return json.Unmarshal(content, &outputs)
+		}).Should(Succeed())
+		return outputs[name].Failures
+	}
+
+	instruction := func(name, script string) applyinator.CommonInstruction {
+		return applyinator.CommonInstruction{Name: name, Command: "/bin/sh", Args: []string{"-c", script}}
+	}
+
+	It("applies the plan again when it changes", func() {
+		writePlan(applyinator.Plan{OneTimeInstructions: []applyinator.OneTimeInstruction{
+			{CommonInstruction: instruction("first", "echo first >> "+filepath.Join(dir, "runs"))},
+		}})
+		stop := start()
+		defer stop()
+
+		Eventually(func() (string, error) {
+			content, err := os.ReadFile(filepath.Join(dir, "runs"))
+			return string(content), err
+		}).Should(Equal("first\n"))
+
+		writePlan(applyinator.Plan{OneTimeInstructions: []applyinator.OneTimeInstruction{
+			{CommonInstruction: instruction("second", "echo second >> "+filepath.Join(dir, "runs"))},
+		}})
+		Eventually(func() (string, error) {
+			content, err := os.ReadFile(filepath.Join(dir, "runs"))
+			return string(content), err
+		}).Should(Equal("first\nsecond\n"))
+		Consistently(func() (string, error) {
+			content, err := os.ReadFile(filepath.Join(dir, "runs"))
+			return string(content), err
+		}, 300*time.Millisecond).Should(Equal("first\nsecond\n"))
+	})
+
+	It("keeps the failure cooldown of the periodic instructions across restarts", func() {
+		writePlan(applyinator.Plan{PeriodicInstructions: []applyinator.PeriodicInstruction{
+			{CommonInstruction: instruction("check", "exit 1"), PeriodSeconds: 1},
+		}})
+		stop := start()
+		Eventually(func() int {
+			return failures("check")
+		}).Should(Equal(1))
+		stop()
+
+		stop = start()
+		defer stop()
+		Consistently(func() int {
+			return failures("check")
+		}, 1500*time.Millisecond).Should(Equal(1))
+	})
+
+	It("runs the probes continuously", func() {
+		marker := filepath.Join(dir, "ready")
+		writePlan(applyinator.Plan{Probes: map[string]prober.Probe{
+			"ready": {FileExistsAction: &prober.FileExistsAction{Path: marker}, FailureThreshold: 1},
+		}})
+		stop := start()
+		defer stop()
+
+		healthy := func() bool {
+			statuses := map[string]prober.ProbeStatus{}
+			Eventually(func() error {
+				content, err := os.ReadFile(agent.GetProbeStatusFile(dir))
+				if err != nil {
+					return err
+				}
+				return json.Unmarshal(content, &statuses)
+			}).Should(Succeed())
+			return statuses["ready"].Healthy
+		}
+		Eventually(healthy).Should(BeFalse())
+
+		Expect(os.WriteFile(marker, nil, 0600)).To(Succeed())
+		Eventually(healthy).Should(BeTrue())
+	})
+
+	It("resumes a plan whose apply was interrupted", func() {
+		runs := filepath.Join(dir, "runs")
+		p := applyinator.Plan{OneTimeInstructions: []applyinator.OneTimeInstruction{
+			{CommonInstruction: instruction("done", "echo done >> "+runs)},
+			{CommonInstruction: instruction("interrupted", "echo interrupted >> "+runs)},
+			{CommonInstruction: instruction("pending", "echo pending >> "+runs)},
+		}}
+		writePlan(p)
+		raw, err := json.Marshal(p)
+		Expect(err).NotTo(HaveOccurred())
+		calculated, err := applyinator.CalculatePlan(raw)
+		Expect(err).NotTo(HaveOccurred())
+
+		// the agent was killed while the second instruction was running
+		state, err := json.Marshal(applyinator.PlanState{
+			Checksum: calculated.Checksum,
+			Instructions: map[string]applyinator.InstructionStatus{
+				"done":        {State: applyinator.InstructionSucceeded, Attempts: 1},
+				"interrupted": {State: applyinator.InstructionRunning, Attempts: 1},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.MkdirAll(agent.GetAgentDir(dir), 0700)).To(Succeed())
+		Expect(os.WriteFile(agent.GetStateFile(dir), state, 0600)).To(Succeed())
+
+		stop := start()
+		defer stop()
+		Eventually(func() (string, error) {
+			content, err := os.ReadFile(runs)
+			return string(content), err
+		}).Should(Equal("interrupted\npending\n"))
+	})
+
+	It("keeps the periodic instructions and probes of the node plan running", func() {
+		Expect(plan.WriteAgentPlan(&applyinator.Plan{
+			OneTimeInstructions: []applyinator.OneTimeInstruction{
+				{CommonInstruction: instruction("bootstrap", "echo bootstrap >> "+filepath.Join(dir, "runs"))},
+			},
+			PeriodicInstructions: []applyinator.PeriodicInstruction{
+				{
+					CommonInstruction: instruction("node-check", "echo checked >> "+filepath.Join(dir, "checks")),
+					PeriodSeconds:     1,
+					When:              `nodeName == "node-1"`,
+				},
+			},
+		}, applyinator.Facts{"nodeName": "node-1"}, dir, nil)).To(Succeed())
+		writePlan(applyinator.Plan{PeriodicInstructions: []applyinator.PeriodicInstruction{
+			{CommonInstruction: instruction("check", "exit 1"), PeriodSeconds: 1},
+		}})
+		stop := start()
+		defer stop()
+
+		Eventually(func() (string, error) {
+			content, err := os.ReadFile(filepath.Join(dir, "checks"))
+			return string(content), err
+		}).Should(HavePrefix("checked\n"))
+		Eventually(func() int {
+			return failures("check")
+		}).Should(BeNumerically(">=", 1))
+		// the one-time instructions of the node plan are only run by the bootstrap
+		Expect(filepath.Join(dir, "runs")).NotTo(BeAnExistingFile())
+		Expect(filepath.Join(agent.GetBootstrapDir(dir), "applied")).To(BeADirectory())
+	})
+})
@@ -0,0 +1,169 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/llmos-ai/llmos/pkg/applyinator"
+	cliplan "github.com/llmos-ai/llmos/pkg/cli/plan"
+	"github.com/llmos-ai/llmos/pkg/utils/signature"
+)
+
+// Keys of the plan Secret, named like the ones of the system-agent plan Secrets.
+const (
+	SecretPlanKey         = "plan"
+	SecretSignatureKey    = "plan" + signature.FileSuffix
+	SecretAppliedChecksum = "applied-checksum"
+	SecretFailedChecksum  = "failed-checksum"
+	SecretFailureCount    = "failure-count"
+	SecretAppliedOutput   = "applied-output"
+	SecretPeriodicOutput  = "applied-periodic-output"
+	SecretProbeStatuses   = "probe-statuses"
+)
+
+const secretWatchRetryBackoff = 5 * time.Second
+
+type secretSource struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+}
+
+// NewSecretSource returns a source reading the plan from the plan key of the Secret, signed by its plan.sig key.
+// The result of applying the plan is written back to the Secret.
+func NewSecretSource(client kubernetes.Interface, namespace, name string) Source {
+	return &secretSource{client: client, namespace: namespace, name: name}
+}
+
+func (s *secretSource) String() string {
+	return fmt.Sprintf("plan secret %s/%s", s.namespace, s.name)
+}
+
+func (s *secretSource) Load(ctx context.Context, trust *signature.TrustStore) (*applyinator.CalculatedPlan, error) {
+	secret, err := s.client.CoreV1().Secrets(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	content := secret.Data[SecretPlanKey]
+	if len(content) == 0 {
+		return nil, nil
+	}
+	calculated, err := cliplan.Parse(s.String(), content, secret.Data[SecretSignatureKey], trust)
+	if err != nil {
+		return nil, err
+	}
+	return &calculated, nil
+}
+
+func (s *secretSource) Watch(ctx context.Context, changed chan<- struct{}) error {
+	var plan, sig []byte
+	for {
+		watcher, err := s.client.CoreV1().Secrets(s.namespace).Watch(ctx, metav1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("metadata.name", s.name).String(),
+		})
+		if err == nil {
+			// the plan might have changed while it was not watched
+			notify(changed)
+			s.watch(ctx, watcher, changed, &plan, &sig)
+			watcher.Stop()
+		} else if ctx.Err() == nil {
+			// the API server might not be up yet, the agent polls the secret meanwhile
+			logrus.Debugf("Failed to watch %s: %v", s, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(secretWatchRetryBackoff):
+		}
+	}
+}
+
+// watch notifies the changes of the plan until the watch ends or the context is done.
+func (s *secretSource) watch(ctx context.Context, watcher watch.Interface, changed chan<- struct{}, plan, sig *[]byte) {
+	for {
+		var event watch.Event
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-watcher.ResultChan():
+			if !ok {
+				return
+			}
+			event = e
+		}
+
+		secret, ok := event.Object.(*corev1.Secret)
+		if !ok {
+			continue
+		}
+		if event.Type == watch.Deleted {
+			secret = &corev1.Secret{}
+		}
+		// the agent writes the status back to the secret, only changes of the plan are notified
+		if !bytes.Equal(*plan, secret.Data[SecretPlanKey]) || !bytes.Equal(*sig, secret.Data[SecretSignatureKey]) {
+			*plan, *sig = secret.Data[SecretPlanKey], secret.Data[SecretSignatureKey]
+			notify(changed)
+		}
+	}
+}
+
+func (s *secretSource) Report(ctx context.Context, status Status) error {
+	probeStatuses, err := json.Marshal(status.ProbeStatuses)
+	if err != nil {
+		return err
+	}
+	data := map[string][]byte{
+		SecretAppliedChecksum: []byte(status.AppliedChecksum),
+		SecretFailedChecksum:  []byte(status.FailedChecksum),
+		SecretFailureCount:    []byte(strconv.Itoa(status.Failures)),
+		SecretAppliedOutput:   status.OneTimeOutput,
+		SecretPeriodicOutput:  status.PeriodicOutput,
+		SecretProbeStatuses:   probeStatuses,
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret, err := s.client.CoreV1().Secrets(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return errors.New("the secret was deleted")
+		} else if err != nil {
+			return err
+		}
+
+		secret = secret.DeepCopy()
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		modified := false
+		for key, value := range data {
+			if value == nil {
+				continue
+			}
+			if !bytes.Equal(secret.Data[key], value) {
+				secret.Data[key] = value
+				modified = true
+			}
+		}
+		if !modified {
+			return nil
+		}
+		_, err = s.client.CoreV1().Secrets(s.namespace).Update(ctx, secret, metav1.UpdateOptions{})
+		return err
+	})
+}
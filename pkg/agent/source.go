@@ -0,0 +1,247 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/llmos-ai/llmos/pkg/applyinator"
+	"github.com/llmos-ai/llmos/pkg/applyinator/prober"
+	"github.com/llmos-ai/llmos/pkg/bootstrap/plan"
+	cliplan "github.com/llmos-ai/llmos/pkg/cli/plan"
+	"github.com/llmos-ai/llmos/pkg/utils/signature"
+)
+
+// Source provides the plan applied by the agent and records the result of applying it.
+type Source interface {
+	fmt.Stringer
+	// Load returns the plan of the source, nil if it has none
+	Load(ctx context.Context, trust *signature.TrustStore) (*applyinator.CalculatedPlan, error)
+	// Watch notifies changed when the plan might have changed until the context is done. The agent polls
+	// the source if it returns an error.
+	Watch(ctx context.Context, changed chan<- struct{}) error
+	// Report records the result of the last apply of the plan
+	Report(ctx context.Context, status Status) error
+}
+
+// Status is the result of applying the plan of a source.
+type Status struct {
+	// AppliedChecksum is the checksum of the last plan whose one-time instructions succeeded
+	AppliedChecksum string
+	// FailedChecksum is the checksum of the plan whose one-time instructions failed, empty if the last apply succeeded
+	FailedChecksum string
+	Failures       int
+	// OneTimeOutput and PeriodicOutput are the gzipped outputs of the applyinator
+	OneTimeOutput  []byte
+	PeriodicOutput []byte
+	ProbeStatuses  map[string]prober.ProbeStatus
+}
+
+// planExtensions are the extensions of the plan files read from a plan directory.
+var planExtensions = []string{".json", ".yaml", ".yml"}
+
+type fileSource struct {
+	path string
+}
+
+// NewFileSource returns a source reading the JSON or YAML plan file at the path, signed by the file next to
+// it with a .sig suffix.
+func NewFileSource(path string) Source {
+	return &fileSource{path: filepath.Clean(path)}
+}
+
+func (f *fileSource) String() string {
+	return "plan file " + f.path
+}
+
+func (f *fileSource) Load(_ context.Context, trust *signature.TrustStore) (*applyinator.CalculatedPlan, error) {
+	calculated, err := cliplan.Load(f.path, trust)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &calculated, nil
+}
+
+func (f *fileSource) Watch(ctx context.Context, changed chan<- struct{}) error {
+	// the directory is watched, editors and config management replace the file rather than writing it
+	return watchDir(ctx, filepath.Dir(f.path), changed, func(name string) bool {
+		return name == f.path || name == f.path+signature.FileSuffix
+	})
+}
+
+func (f *fileSource) Report(context.Context, Status) error {
+	return nil
+}
+
+type dirSource struct {
+	dir string
+}
+
+// NewDirSource returns a source merging the JSON and YAML plan files of the directory in lexical order, see
+// applyinator.MergePlans.
+func NewDirSource(dir string) Source {
+	return &dirSource{dir: filepath.Clean(dir)}
+}
+
+func (d *dirSource) String() string {
+	return "plan directory " + d.dir
+}
+
+func (d *dirSource) Load(_ context.Context, trust *signature.TrustStore) (*applyinator.CalculatedPlan, error) {
+	entries, err := os.ReadDir(d.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && isPlanFile(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	sort.Strings(names)
+
+	plans := make([]applyinator.CalculatedPlan, 0, len(names))
+	for _, name := range names {
+		calculated, err := cliplan.Load(filepath.Join(d.dir, name), trust)
+		if err != nil {
+			return nil, err
+		}
+		plans = append(plans, calculated)
+	}
+	merged, err := applyinator.MergePlans(plans...)
+	if err != nil {
+		return nil, fmt.Errorf("merging the plans of %s: %w", d.dir, err)
+	}
+	return &merged, nil
+}
+
+func (d *dirSource) Watch(ctx context.Context, changed chan<- struct{}) error {
+	return watchDir(ctx, d.dir, changed, func(name string) bool {
+		return filepath.Dir(name) == d.dir
+	})
+}
+
+func (d *dirSource) Report(context.Context, Status) error {
+	return nil
+}
+
+// bootstrapSource reads the periodic instructions and probes of the node plan written by the bootstrap, see
+// plan.WriteAgentPlan.
+type bootstrapSource struct {
+	dataDir string
+
+	mu    sync.Mutex
+	facts applyinator.Facts
+}
+
+func (b *bootstrapSource) String() string {
+	return "node plan " + plan.GetAgentPlanFile(b.dataDir)
+}
+
+func (b *bootstrapSource) Load(context.Context, *signature.TrustStore) (*applyinator.CalculatedPlan, error) {
+	agentPlan, err := plan.ReadAgentPlan(b.dataDir)
+	if err != nil || agentPlan == nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(agentPlan.Plan)
+	if err != nil {
+		return nil, err
+	}
+	calculated, err := applyinator.CalculatePlan(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", b, err)
+	}
+
+	b.mu.Lock()
+	b.facts = agentPlan.Facts
+	b.mu.Unlock()
+	return &calculated, nil
+}
+
+// Facts returns the facts the node plan was bootstrapped with.
+func (b *bootstrapSource) Facts() applyinator.Facts {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.facts
+}
+
+func (b *bootstrapSource) Watch(ctx context.Context, changed chan<- struct{}) error {
+	path := plan.GetAgentPlanFile(b.dataDir)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return watchDir(ctx, filepath.Dir(path), changed, func(name string) bool {
+		return name == path
+	})
+}
+
+func (b *bootstrapSource) Report(context.Context, Status) error {
+	return nil
+}
+
+func isPlanFile(name string) bool {
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+	for _, ext := range planExtensions {
+		if filepath.Ext(name) == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// watchDir notifies changed on the events of the files of the directory that match.
+func watchDir(ctx context.Context, dir string, changed chan<- struct{}, match func(name string) bool) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	if err = watcher.Add(dir); err != nil {
+		return fmt.Errorf("watching %s: %w", dir, err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return errors.New("watcher closed")
+			}
+			if match(filepath.Clean(event.Name)) {
+				notify(changed)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return errors.New("watcher closed")
+			}
+			return err
+		}
+	}
+}
+
+// notify signals the change without blocking, a pending signal covers the new change.
+func notify(changed chan<- struct{}) {
+	select {
+	case changed <- struct{}{}:
+	default:
+	}
+}
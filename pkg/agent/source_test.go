@@ -0,0 +1,172 @@
+package agent_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/llmos-ai/llmos/pkg/agent"
+)
+
+var _ = Describe("plan sources", Label("agent", "source"), func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+	})
+
+	write := func(name, content string) {
+		Expect(os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, name), []byte(content), 0600)).To(Succeed())
+	}
+
+	Context("directory", func() {
+		It("merges the plans in lexical order", func() {
+			source := agent.NewDirSource(filepath.Join(dir, "plans.d"))
+			plan, err := source.Load(context.Background(), nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan).To(BeNil())
+
+			write("plans.d/20-gpu.yaml", "instructions:\n- name: sysctl\n  command: /usr/sbin/sysctl\n- name: driver\n  command: nvidia-smi\n")
+			write("plans.d/10-base.json", `{"instructions":[{"name":"sysctl","command":"sysctl"},{"name":"modprobe","command":"modprobe"}]}`)
+			write("plans.d/10-base.json.sig", "not a plan")
+			write("plans.d/README.md", "not a plan")
+
+			plan, err = source.Load(context.Background(), nil)
+			Expect(err).NotTo(HaveOccurred())
+			var commands []string
+			for _, instruction := range plan.Plan.OneTimeInstructions {
+				commands = append(commands, instruction.Command)
+			}
+			Expect(commands).To(Equal([]string{"/usr/sbin/sysctl", "modprobe", "nvidia-smi"}))
+		})
+
+		It("rejects an invalid plan", func() {
+			write("plans.d/10-base.yaml", "instructions:\n- name: sysctl\n  comand: sysctl\n")
+			_, err := agent.NewDirSource(filepath.Join(dir, "plans.d")).Load(context.Background(), nil)
+			Expect(err).To(MatchError(ContainSubstring("unknown field")))
+		})
+	})
+
+	Context("file", func() {
+		It("notifies the changes of the plan file", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			changed := make(chan struct{}, 1)
+			go func() {
+				defer GinkgoRecover()
+				Expect(agent.NewFileSource(filepath.Join(dir, "plan.yaml")).Watch(ctx, changed)).To(Succeed())
+			}()
+
+			// the watch starts asynchronously, the file is written until a change is notified
+			Eventually(func() bool {
+				write("other.yaml", "")
+				write("plan.yaml", "instructions: []\n")
+				select {
+				case <-changed:
+					return true
+				case <-time.After(100 * time.Millisecond):
+					return false
+				}
+			}).Should(BeTrue())
+		})
+	})
+
+	Context("secret", func() {
+		const plan = `{"instructions":[{"name":"marker","command":"/usr/bin/touch","args":["%s"]}]}`
+
+		var client *fake.Clientset
+
+		BeforeEach(func() {
+			client = fake.NewSimpleClientset()
+		})
+
+		secret := func() *corev1.Secret {
+			secret, err := client.CoreV1().Secrets("llmos-system").Get(context.Background(), "node-plan", metav1.GetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			return secret
+		}
+
+		It("reads the plan and writes the status back", func() {
+			source := agent.NewSecretSource(client, "llmos-system", "node-plan")
+			calculated, err := source.Load(context.Background(), nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(calculated).To(BeNil())
+
+			_, err = client.CoreV1().Secrets("llmos-system").Create(context.Background(), &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "llmos-system", Name: "node-plan"},
+				Data:       map[string][]byte{agent.SecretPlanKey: []byte("instructions:\n- name: sysctl\n  command: sysctl\n")},
+			}, metav1.CreateOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			calculated, err = source.Load(context.Background(), nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(calculated.Plan.OneTimeInstructions).To(HaveLen(1))
+
+			Expect(source.Report(context.Background(), agent.Status{
+				AppliedChecksum: calculated.Checksum,
+				OneTimeOutput:   []byte("output"),
+			})).To(Succeed())
+			data := secret().Data
+			Expect(string(data[agent.SecretAppliedChecksum])).To(Equal(calculated.Checksum))
+			Expect(string(data[agent.SecretAppliedOutput])).To(Equal("output"))
+			Expect(string(data[agent.SecretFailureCount])).To(Equal("0"))
+
+			// the output of the last full apply is kept when only the periodic instructions ran
+			Expect(source.Report(context.Background(), agent.Status{
+				AppliedChecksum: calculated.Checksum,
+				PeriodicOutput:  []byte("periodic"),
+			})).To(Succeed())
+			data = secret().Data
+			Expect(string(data[agent.SecretAppliedOutput])).To(Equal("output"))
+			Expect(string(data[agent.SecretPeriodicOutput])).To(Equal("periodic"))
+		})
+
+		It("is applied by the agent when the plan changes", func() {
+			_, err := client.CoreV1().Secrets("llmos-system").Create(context.Background(), &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "llmos-system", Name: "node-plan"},
+			}, metav1.CreateOptions{})
+			Expect(err).NotTo(HaveOccurred())
+
+			a, err := agent.New(agent.Options{
+				DataDir: dir,
+				Source:  agent.NewSecretSource(client, "llmos-system", "node-plan"),
+				// the plan is only applied again because the watch notifies the change
+				Interval: time.Hour,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				defer GinkgoRecover()
+				Expect(a.Run(ctx)).To(Succeed())
+			}()
+			defer func() {
+				cancel()
+				Eventually(done).Should(BeClosed())
+			}()
+
+			marker := filepath.Join(dir, "marker")
+			Eventually(func() error {
+				s := secret()
+				s.Data = map[string][]byte{agent.SecretPlanKey: []byte(fmt.Sprintf(plan, marker))}
+				_, err := client.CoreV1().Secrets("llmos-system").Update(context.Background(), s, metav1.UpdateOptions{})
+				return err
+			}).Should(Succeed())
+
+			Eventually(marker).Should(BeAnExistingFile())
+			Eventually(func() string {
+				return string(secret().Data[agent.SecretAppliedChecksum])
+			}).ShouldNot(BeEmpty())
+			Expect(secret().Data[agent.SecretAppliedOutput]).NotTo(BeEmpty())
+		})
+	})
+})
@@ -7,12 +7,11 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
-	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"sort"
 	"strconv"
@@ -25,6 +24,8 @@ import (
 
 	"github.com/llmos-ai/llmos/pkg/applyinator/image"
 	"github.com/llmos-ai/llmos/pkg/applyinator/prober"
+	"github.com/llmos-ai/llmos/pkg/utils/crypt"
+	"github.com/llmos-ai/llmos/pkg/utils/signature"
 )
 
 type Applyinator struct {
@@ -34,12 +35,20 @@ type Applyinator struct {
 	appliedPlanDir  string
 	interlockDir    string
 	imageUtil       *image.Utility
+	executors       map[string]Executor
+	cipher          *crypt.Cipher
+	backups         *BackupStore
+	trust           *signature.TrustStore
 }
 
 // CalculatedPlan is passed into Applyinator and is a Plan with checksum calculated
 type CalculatedPlan struct {
 	Plan     Plan
 	Checksum string
+	// SignedBy is the name of the trusted key the plan is signed with, see CalculateSignedPlan
+	SignedBy string `json:",omitempty"`
+
+	signed []signedContent // the contents the signatures were verified against, one per merged plan
 }
 
 type Plan struct {
@@ -47,20 +56,57 @@ type Plan struct {
 	OneTimeInstructions  []OneTimeInstruction    `json:"instructions,omitempty"`
 	Probes               map[string]prober.Probe `json:"probes,omitempty"`
 	PeriodicInstructions []PeriodicInstruction   `json:"periodicInstructions,omitempty"`
+	Executor             string                  `json:"executor,omitempty"` // default executor of the instructions, default local
+	Redacted             bool                    `json:"redacted,omitempty"` // the sensitive values of the plan are masked, see RedactPlan
 }
 
 type CommonInstruction struct {
-	Name    string   `json:"name,omitempty"`
-	Image   string   `json:"image,omitempty"`
-	Env     []string `json:"env,omitempty"`
-	Args    []string `json:"args,omitempty"`
-	Command string   `json:"command,omitempty"`
+	Name           string   `json:"name,omitempty"`
+	Image          string   `json:"image,omitempty"`
+	Env            []string `json:"env,omitempty"`
+	SensitiveEnv   []string `json:"sensitiveEnv,omitempty"` // keys of Env whose values are masked in logs, outputs and plan files
+	Args           []string `json:"args,omitempty"`
+	Command        string   `json:"command,omitempty"`
+	MaxAttempts    int      `json:"maxAttempts,omitempty"`    // default ApplyInput.OneTimeInstructionAttempts for one-time instructions, 1 for periodic instructions
+	Backoff        *Backoff `json:"backoff,omitempty"`        // delay between attempts, see Backoff for the defaults
+	TimeoutSeconds int      `json:"timeoutSeconds,omitempty"` // default 0, i.e. no timeout. The process group is killed once the timeout is hit
+	Executor       string   `json:"executor,omitempty"`       // executor running the command, e.g. local or systemd, default Plan.Executor
+	// The following settings are only supported on Linux
+	User            string `json:"user,omitempty"`            // user name or uid to run the command as, default root
+	Group           string `json:"group,omitempty"`           // group name or gid to run the command as, default the primary group of the user
+	CPUQuota        string `json:"cpuQuota,omitempty"`        // CPU time limit as a percentage of one CPU, e.g. 50%. Enforced with cgroup v2
+	MemoryMax       string `json:"memoryMax,omitempty"`       // memory limit in bytes with an optional K, M, G or T suffix. Enforced with cgroup v2
+	NoNewPrivileges bool   `json:"noNewPrivileges,omitempty"` // the command and its children can't gain privileges, e.g. through setuid binaries
+	CleanEnv        bool   `json:"cleanEnv,omitempty"`        // do not pass the environment of the applyinator to the command, only a default PATH and Env
+	WorkingDir      string `json:"workingDir,omitempty"`      // working directory of the command, default the execution directory
+	// Rootfs runs the command chrooted into the extracted Image with the BindMounts of the host,
+	// /proc, /sys, /dev and /etc/resolv.conf are always mounted
+	Rootfs     bool        `json:"rootfs,omitempty"`
+	BindMounts []BindMount `json:"bindMounts,omitempty"`
+}
+
+// BindMount mounts a host path into the rootfs of an instruction.
+type BindMount struct {
+	Source   string `json:"source"`           // absolute host path
+	Target   string `json:"target,omitempty"` // absolute path inside the rootfs, default Source
+	ReadOnly bool   `json:"readOnly,omitempty"`
+	optional bool   // the mount is skipped if the source does not exist
 }
 
 type PeriodicInstruction struct {
 	CommonInstruction
-	PeriodSeconds    int  `json:"periodSeconds,omitempty"` // default 600, i.e. 10 minutes
-	SaveStderrOutput bool `json:"saveStderrOutput,omitempty"`
+	PeriodSeconds int `json:"periodSeconds,omitempty"` // default 600, i.e. 10 minutes
+	// Schedule is a cron expression in the local time of the node, e.g. "0 3 * * *", replacing the period. The
+	// instruction first runs at the next time of its schedule, unlike a period which runs as soon as it is applied.
+	Schedule string `json:"schedule,omitempty"`
+	// JitterSeconds delays each scheduled run by a random duration of up to the given seconds, so that the nodes
+	// do not all run the instruction at the same time
+	JitterSeconds int `json:"jitterSeconds,omitempty"`
+	// AllowedWindows restrict the runs of the instruction to the windows, it runs in the next window once it is due.
+	// Instructions with a schedule or windows are not run when the plan is applied but on their schedule.
+	AllowedWindows   []Window `json:"allowedWindows,omitempty"`
+	SaveStderrOutput bool     `json:"saveStderrOutput,omitempty"`
+	When             string   `json:"when,omitempty"` // CEL expression evaluated against the node facts, the instruction is skipped if it is false
 }
 
 type PeriodicInstructionOutput struct {
@@ -71,27 +117,48 @@ type PeriodicInstructionOutput struct {
 	LastSuccessfulRunTime string `json:"lastSuccessfulRunTime"` // LastSuccessfulRunTime is a time.UnixDate formatted string of the last successful time (exit code 0) the instruction was run
 	Failures              int    `json:"failures"`              // Failures is the number of time the periodic instruction has failed to run
 	LastFailedRunTime     string `json:"lastFailedRunTime"`     // LastFailedRunTime is a time.UnixDate formatted string of the time that the periodic instruction started failing
+	Skipped               bool   `json:"skipped,omitempty"`     // Skipped is true if the instruction was not run the last time as its when expression was false
+	NextRunTime           string `json:"nextRunTime,omitempty"` // NextRunTime is a time.UnixDate formatted string of the time the instruction runs next, see NextRunTime
 }
 
 type OneTimeInstruction struct {
 	CommonInstruction
-	SaveOutput bool `json:"saveOutput,omitempty"`
+	SaveOutput bool     `json:"saveOutput,omitempty"`
+	DependsOn  []string `json:"dependsOn,omitempty"` // names of the instructions to run before, if no instruction in the plan has dependencies they run in order
+	When       string   `json:"when,omitempty"`      // CEL expression evaluated against the node facts, the instruction is skipped if it is false
 }
 
 // Path would be `/etc/kubernetes/ssl/ca.pem`, Content is base64 encoded.
 // If Directory is true, then we are creating a directory, not a file
 type File struct {
 	Content     string `json:"content,omitempty"`
+	Encoding    string `json:"encoding,omitempty"` // Encoding of the content: base64 (default), plain or gzip+base64
+	Source      string `json:"source,omitempty"`   // Source is an http(s) URL or a path inside Image the content is read from
+	Image       string `json:"image,omitempty"`
+	SHA256      string `json:"sha256,omitempty"`   // SHA256 is the hex encoded checksum the content is verified against before rendering
+	Template    bool   `json:"template,omitempty"` // Template renders the content as a Go template with the node facts
 	Directory   bool   `json:"directory,omitempty"`
+	Symlink     string `json:"symlink,omitempty"` // Symlink is the target of the symbolic link created at Path
+	State       string `json:"state,omitempty"`   // State is either present (default) or absent to remove the file
 	UID         int    `json:"uid,omitempty"`
 	GID         int    `json:"gid,omitempty"`
+	Owner       string `json:"owner,omitempty"` // Owner is the name of the user owning the file, instead of UID
+	Group       string `json:"group,omitempty"` // Group is the name of the group owning the file, instead of GID
 	Path        string `json:"path,omitempty"`
 	Permissions string `json:"permissions,omitempty"` // internally, the string will be converted to a uint32 to satisfy os.FileMode
+	Sensitive   bool   `json:"sensitive,omitempty"`   // the content is masked in plan files, a single line content is masked in logs and outputs
 }
 
-const appliedPlanFileSuffix = "-applied.plan"
+const (
+	appliedPlanFileSuffix = "-applied.plan"
+	// signedPlanFileSuffix is the suffix of the signed contents of the applied plans, kept next to the history
+	signedPlanFileSuffix = "-applied.signed"
+	// originalPlanFileSuffix is the suffix of the unredacted unsigned applied plans, kept if the history is encrypted
+	originalPlanFileSuffix = "-applied.original"
+)
 const applyinatorDateCodeLayout = "20060102-150405"
 const defaultCommand = "/run.sh"
+const defaultPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
 const cattleAgentExecutionPwdEnvKey = "CATTLE_AGENT_EXECUTION_PWD"
 const cattleAgentAttemptKey = "CATTLE_AGENT_ATTEMPT_NUMBER"
 const planRetentionPolicyCount = 64
@@ -107,9 +174,14 @@ func NewApplyinator(workDir string, preserveWorkDir bool, appliedPlanDir, interl
 		appliedPlanDir:  appliedPlanDir,
 		interlockDir:    interlockDir,
 		imageUtil:       imageUtil,
+		executors: map[string]Executor{
+			ExecutorLocal:   localExecutor{},
+			ExecutorSystemd: NewSystemdExecutor(runCommand, time.Second),
+		},
 	}
 }
 
+// CalculatePlan decodes and validates the JSON plan and calculates its checksum, see PlanChecksum.
 func CalculatePlan(rawPlan []byte) (CalculatedPlan, error) {
 	var cp CalculatedPlan
 	var plan Plan
@@ -117,17 +189,64 @@ func CalculatePlan(rawPlan []byte) (CalculatedPlan, error) {
 		return cp, err
 	}
 
-	cp.Checksum = checksum(rawPlan)
+	if err := validatePlan(&plan); err != nil {
+		return cp, err
+	}
+
+	sum, err := PlanChecksum(plan)
+	if err != nil {
+		return cp, err
+	}
+	cp.Checksum = sum
 	cp.Plan = plan
 
 	return cp, nil
 }
 
-func checksum(input []byte) string {
-	h := sha256.New()
-	h.Write(input)
-
-	return fmt.Sprintf("%x", h.Sum(nil))
+// validatePlan checks the plan for errors that would only surface while it is applied.
+func validatePlan(plan *Plan) error {
+	if plan.Redacted {
+		return fmt.Errorf("the sensitive values of the plan are redacted, it can't be applied")
+	}
+	if _, err := oneTimeDependencies(plan.OneTimeInstructions); err != nil {
+		return fmt.Errorf("invalid one-time instructions: %w", err)
+	}
+	for index, instruction := range plan.OneTimeInstructions {
+		if err := validateLimits(instruction.CommonInstruction); err != nil {
+			return fmt.Errorf("invalid one-time instruction %s: %w", instructionName(instruction, index), err)
+		}
+		if instruction.When == "" {
+			continue
+		}
+		if err := validateWhen(instruction.When); err != nil {
+			return fmt.Errorf("invalid one-time instruction %s: %w", instructionName(instruction, index), err)
+		}
+	}
+	for _, instruction := range plan.PeriodicInstructions {
+		if err := validateLimits(instruction.CommonInstruction); err != nil {
+			return fmt.Errorf("invalid periodic instruction %s: %w", instruction.Name, err)
+		}
+		if err := validateSchedule(instruction); err != nil {
+			return fmt.Errorf("invalid periodic instruction %s: %w", instruction.Name, err)
+		}
+		if instruction.When == "" {
+			continue
+		}
+		if err := validateWhen(instruction.When); err != nil {
+			return fmt.Errorf("invalid periodic instruction %s: %w", instruction.Name, err)
+		}
+	}
+	for _, file := range plan.Files {
+		if err := validateFile(file); err != nil {
+			return fmt.Errorf("invalid file %s: %w", file.Path, err)
+		}
+	}
+	for name, probe := range plan.Probes {
+		if err := prober.ValidateProbe(probe); err != nil {
+			return fmt.Errorf("invalid probe %s: %w", name, err)
+		}
+	}
+	return nil
 }
 
 type ApplyOutput struct {
@@ -141,9 +260,23 @@ type ApplyInput struct {
 	CalculatedPlan             CalculatedPlan
 	RunOneTimeInstructions     bool
 	OneTimeInstructionAttempts int
-	ReconcileFiles             bool
-	ExistingOneTimeOutput      []byte
-	ExistingPeriodicOutput     []byte
+	// OneTimeInstructionConcurrency is the maximum number of one-time instructions run in parallel, default 1.
+	// Instructions only run in parallel if the plan declares their dependencies.
+	OneTimeInstructionConcurrency int
+	ReconcileFiles                bool
+	ExistingOneTimeOutput         []byte
+	ExistingPeriodicOutput        []byte
+	// StateFile is the path of the per-instruction completion record of the plan. If set, one-time instructions that
+	// already succeeded for the same plan checksum are skipped, so that a retried apply resumes at the first failure.
+	StateFile string
+	// ManagedFilesFile is the path of the record of the files written by the last applied plan. If set, the files of
+	// the previous plan that are no longer part of the plan are removed when reconciling the files.
+	ManagedFilesFile string
+	// Facts are the node facts `when` expressions are evaluated against, in addition to the facts of the host.
+	Facts Facts
+	// RestartFrom is the name of the one-time instruction to resume from. Instructions before it are skipped, it and
+	// every instruction after it are run regardless of the completion record.
+	RestartFrom string
 }
 
 // Apply accepts a context, calculated plan, a bool to indicate whether to run the onetime instructions, the existing onetimeinstruction output, and an input byte slice which is a base64+gzip json-marshalled map of PeriodicInstructionOutput
@@ -162,6 +295,15 @@ func (a *Applyinator) Apply(ctx context.Context, input ApplyInput) (ApplyOutput,
 	nowUnixTimeString := now.Format(time.UnixDate)
 	nowString := now.Format(applyinatorDateCodeLayout)
 
+	if err := a.verifySignature(input.CalculatedPlan); err != nil {
+		return output, err
+	}
+	if err := a.validateExecutors(input.CalculatedPlan.Plan); err != nil {
+		return output, fmt.Errorf("invalid plan %s: %w", input.CalculatedPlan.Checksum, err)
+	}
+	// sensitive values are masked in the logs and the saved outputs of the instructions
+	redactor := NewRedactor(SensitiveValues(input.CalculatedPlan.Plan)...)
+
 	// Check to see if we are safe to apply.
 	if a.interlockDir != "" {
 		restartPendingInterlockFilePath := filepath.Join(a.interlockDir, restartPendingInterlockFile)
@@ -230,24 +372,14 @@ func (a *Applyinator) Apply(ctx context.Context, input ApplyInput) (ApplyOutput,
 	}
 
 	if input.ReconcileFiles {
-		for _, file := range input.CalculatedPlan.Plan.Files {
-			if file.Directory {
-				logrus.Debugf("[Applyinator] Creating directory %s", file.Path)
-				if err := CreateDirectory(file); err != nil {
-					return output, err
-				}
-			} else {
-				logrus.Debugf("[Applyinator] Writing file %s", file.Path)
-				if err := writeBase64ContentToFile(file); err != nil {
-					return output, err
-				}
-			}
+		if err := a.reconcileFiles(ctx, input); err != nil {
+			return output, err
 		}
 	}
 
 	if !a.preserveWorkDir {
 		logrus.Debugf("[Applyinator] Cleaning working directory before applying %s", a.workDir)
-		if err := os.RemoveAll(a.workDir); err != nil {
+		if err := removeWorkDir(a.workDir); err != nil {
 			return output, err
 		}
 	}
@@ -264,26 +396,83 @@ func (a *Applyinator) Apply(ctx context.Context, input ApplyInput) (ApplyOutput,
 			}
 		}
 
-		oneTimeApplySucceeded := true
-		for index, instruction := range input.CalculatedPlan.Plan.OneTimeInstructions {
-			logrus.Debugf("[Applyinator] Executing instruction %d attempt %d for plan %s", index, input.OneTimeInstructionAttempts, input.CalculatedPlan.Checksum)
+		stateRecorder, err := newPlanStateRecorder(input.StateFile, input.CalculatedPlan.Checksum)
+		if err != nil {
+			return output, fmt.Errorf("unable to load plan state %s: %w", input.StateFile, err)
+		}
+
+		restartIndex := 0
+		if input.RestartFrom != "" {
+			restartIndex = -1
+			for index, instruction := range input.CalculatedPlan.Plan.OneTimeInstructions {
+				if instruction.Name == input.RestartFrom {
+					restartIndex = index
+					break
+				}
+			}
+			if restartIndex < 0 {
+				return output, fmt.Errorf("instruction %s to restart from was not found in plan %s", input.RestartFrom, input.CalculatedPlan.Checksum)
+			}
+		}
+
+		dependencies, err := oneTimeDependencies(input.CalculatedPlan.Plan.OneTimeInstructions)
+		if err != nil {
+			return output, fmt.Errorf("invalid one-time instructions in plan %s: %w", input.CalculatedPlan.Checksum, err)
+		}
+
+		facts := withHostFacts(input.Facts)
+		var outputsLock sync.Mutex
+		oneTimeApplySucceeded := runDAG(dependencies, input.OneTimeInstructionConcurrency, func(index int) bool {
+			instruction := input.CalculatedPlan.Plan.OneTimeInstructions[index]
+			if index < restartIndex {
+				logrus.Infof("[Applyinator] Skipping instruction %d %s, restarting from instruction %s", index, instruction.Name, input.RestartFrom)
+				return true
+			}
+			if input.RestartFrom != "" {
+				stateRecorder.reset(instruction.Name)
+			} else if stateRecorder.succeeded(instruction.Name) {
+				logrus.Infof("[Applyinator] Skipping instruction %d %s as it already succeeded for plan %s", index, instruction.Name, input.CalculatedPlan.Checksum)
+				return true
+			}
+			if run, err := evaluateWhen(instruction.When, facts); err != nil {
+				logrus.Errorf("error evaluating when expression of instruction %d %s: %v", index, instruction.Name, err)
+				stateRecorder.finish(instruction.Name, -1, false, time.Now())
+				return false
+			} else if !run {
+				logrus.Infof("[Applyinator] Skipping instruction %d %s as its when expression %q is false", index, instruction.Name, instruction.When)
+				stateRecorder.skip(instruction.Name, time.Now())
+				if instruction.SaveOutput && instruction.Name != "" {
+					outputsLock.Lock()
+					executionOutputs[instruction.Name] = []byte(fmt.Sprintf("skipped: when expression %q is false\n", instruction.When))
+					outputsLock.Unlock()
+				}
+				return true
+			}
+			maxAttempts := instruction.MaxAttempts
+			if maxAttempts == 0 {
+				maxAttempts = input.OneTimeInstructionAttempts
+			}
 			executionInstructionDir := filepath.Join(executionDir, input.CalculatedPlan.Checksum+"_"+strconv.Itoa(index))
 			prefix := input.CalculatedPlan.Checksum + "_" + strconv.Itoa(index)
-			executeOutput, _, exitCode, err := a.execute(ctx, prefix, executionInstructionDir, instruction.CommonInstruction, true, input.OneTimeInstructionAttempts)
-			if err != nil || exitCode != 0 {
+			executeOutput, _, exitCode, err := a.executeWithRetry(ctx, prefix, redactor, executionInstructionDir, withExecutor(instruction.CommonInstruction, input.CalculatedPlan.Plan.Executor), true, maxAttempts, 1, func(attempt int) {
+				logrus.Debugf("[Applyinator] Executing instruction %d attempt %d for plan %s", index, attempt, input.CalculatedPlan.Checksum)
+				stateRecorder.start(instruction.Name, time.Now())
+			})
+			succeeded := err == nil && exitCode == 0
+			if !succeeded {
 				logrus.Errorf("error executing instruction %d %s: %v", index, instruction.Name, err)
-				oneTimeApplySucceeded = false
 			}
+			stateRecorder.finish(instruction.Name, exitCode, succeeded, time.Now())
 			if instruction.Name == "" && instruction.SaveOutput {
 				logrus.Errorf("instruction does not have a name set, cannot save output data")
 			} else if instruction.SaveOutput {
+				outputsLock.Lock()
 				executionOutputs[instruction.Name] = executeOutput
+				outputsLock.Unlock()
 			}
-			// If we have failed to apply our one-time instructions, we need to break in order to stop subsequent instructions from executing.
-			if !oneTimeApplySucceeded {
-				break
-			}
-		}
+			// If we have failed to apply our one-time instructions, no further instruction is started.
+			return succeeded
+		})
 
 		output.OneTimeApplySucceeded = oneTimeApplySucceeded
 
@@ -312,56 +501,43 @@ func (a *Applyinator) Apply(ctx context.Context, input ApplyInput) (ApplyOutput,
 	}
 
 	periodicApplySucceeded := true
+	periodicFacts := withHostFacts(input.Facts)
 	for index, instruction := range input.CalculatedPlan.Plan.PeriodicInstructions {
 		if instruction.Name == "" {
 			logrus.Errorf("periodic instruction %d did not have name, unable to run", index)
 			continue
 		}
-		var previousRunTime, lastFailureTime string
-		var failures int
-		if po, ok := periodicOutputs[instruction.Name]; ok {
-			if po.LastSuccessfulRunTime != "" {
-				logrus.Debugf("[Applyinator] Got periodic output for instruction %s and am now parsing last successful run time %s", instruction.Name, po.LastSuccessfulRunTime)
-				t, err := time.Parse(time.UnixDate, po.LastSuccessfulRunTime)
-				if err != nil {
-					logrus.Errorf("error encountered during parsing of last successful run time: %v", err)
-				} else {
-					previousRunTime = po.LastSuccessfulRunTime
-					if instruction.PeriodSeconds == 0 {
-						instruction.PeriodSeconds = 600 // set default period to 600 seconds
-					}
-					if now.Before(t.Add(time.Second*time.Duration(instruction.PeriodSeconds))) && !input.RunOneTimeInstructions {
-						logrus.Debugf("[Applyinator] Not running periodic instruction %s as period duration has not elapsed since last successful run", instruction.Name)
-						continue
-					}
-				}
-			}
-			if po.LastFailedRunTime != "" {
-				logrus.Debugf("[Applyinator] Got periodic output for instruction %s and am now parsing last failed time %s", instruction.Name, po.LastFailedRunTime)
-				t, err := time.Parse(time.UnixDate, po.LastFailedRunTime)
-				if err != nil {
-					logrus.Errorf("error encountered during parsing of last failed run time: %+v", err)
-				} else {
-					lastFailureTime = po.LastFailedRunTime
-					failures = po.Failures
-					failureCooldown := failures
-					if failures > 6 {
-						failureCooldown = 6
-					} else if failures == 0 {
-						failureCooldown = 1
-					}
-					logrus.Debugf("[Applyinator] Instruction %s - Last failed run attempt was %s, failures: %d, failureCooldown: %d", instruction.Name, lastFailureTime, failures, failureCooldown)
-					if now.Before(t.Add(time.Second*time.Duration(30*failureCooldown))) && !input.RunOneTimeInstructions {
-						logrus.Debugf("[Applyinator] Not running periodic instruction %s as failure cooldown has not elapsed since last failed run", instruction.Name)
-						continue
-					}
-				}
-			}
+		po := periodicOutputs[instruction.Name]
+		po.Name = instruction.Name
+		previousRunTime, lastFailureTime, failures := po.LastSuccessfulRunTime, po.LastFailedRunTime, po.Failures
+		next, err := NextRunTime(instruction, po, now)
+		if err != nil {
+			logrus.Errorf("error encountered during computing the next run time of periodic instruction %s: %v", instruction.Name, err)
+			next = now
+		}
+		// a scheduled instruction only runs on its schedule, even when the plan is applied
+		forced := input.RunOneTimeInstructions && instruction.Schedule == "" && len(instruction.AllowedWindows) == 0
+		if next.After(now) && !forced {
+			logrus.Debugf("[Applyinator] Not running periodic instruction %s before its next run time %s", instruction.Name, next.Format(time.UnixDate))
+			po.NextRunTime = next.Format(time.UnixDate)
+			periodicOutputs[instruction.Name] = po
+			continue
+		}
+		if run, err := evaluateWhen(instruction.When, periodicFacts); err != nil {
+			logrus.Errorf("error evaluating when expression of periodic instruction %s: %v", instruction.Name, err)
+			periodicApplySucceeded = false
+			break
+		} else if !run {
+			logrus.Debugf("[Applyinator] Skipping periodic instruction %s as its when expression %q is false", instruction.Name, instruction.When)
+			po.Skipped = true
+			po.NextRunTime = ""
+			periodicOutputs[instruction.Name] = po
+			continue
 		}
 		logrus.Debugf("[Applyinator] Executing periodic instruction %d for plan %s", index, input.CalculatedPlan.Checksum)
 		executionInstructionDir := filepath.Join(executionDir, input.CalculatedPlan.Checksum+"_"+strconv.Itoa(index))
 		prefix := input.CalculatedPlan.Checksum + "_" + strconv.Itoa(index)
-		stdout, stderr, exitCode, err := a.execute(ctx, prefix, executionInstructionDir, instruction.CommonInstruction, false, failures+1)
+		stdout, stderr, exitCode, err := a.executeWithRetry(ctx, prefix, redactor, executionInstructionDir, withExecutor(instruction.CommonInstruction, input.CalculatedPlan.Plan.Executor), false, instruction.MaxAttempts, failures+1, nil)
 		if err != nil || exitCode != 0 {
 			periodicApplySucceeded = false
 		}
@@ -378,7 +554,7 @@ func (a *Applyinator) Apply(ctx context.Context, input ApplyInput) (ApplyOutput,
 		if !instruction.SaveStderrOutput {
 			stderr = []byte{}
 		}
-		periodicOutputs[instruction.Name] = PeriodicInstructionOutput{
+		po = PeriodicInstructionOutput{
 			Name:                  instruction.Name,
 			Stdout:                stdout,
 			Stderr:                stderr,
@@ -387,6 +563,10 @@ func (a *Applyinator) Apply(ctx context.Context, input ApplyInput) (ApplyOutput,
 			LastFailedRunTime:     lastFailureTime,
 			Failures:              failures,
 		}
+		if next, err := NextRunTime(instruction, po, now); err == nil {
+			po.NextRunTime = next.Format(time.UnixDate)
+		}
+		periodicOutputs[instruction.Name] = po
 		if !periodicApplySucceeded {
 			break
 		}
@@ -459,6 +639,12 @@ func (a *Applyinator) appliedPlanRetentionPolicy(retention int) error {
 		if err := os.Remove(historicalPlanFile); err != nil {
 			return err
 		}
+		for _, suffix := range []string{signedPlanFileSuffix, originalPlanFileSuffix} {
+			sibling := strings.TrimSuffix(historicalPlanFile, appliedPlanFileSuffix) + suffix
+			if err := os.Remove(sibling); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
 	}
 	return nil
 }
@@ -478,6 +664,12 @@ func (a *Applyinator) getAppliedPlanFiles() ([]os.DirEntry, error) {
 	return planFiles, nil
 }
 
+// SetCipher encrypts the applied plan history with the cipher, the history then keeps the unsigned plans with their
+// sensitive values.
+func (a *Applyinator) SetCipher(cipher *crypt.Cipher) {
+	a.cipher = cipher
+}
+
 func (a *Applyinator) writePlanToDisk(now time.Time, plan *CalculatedPlan) error {
 	planFiles, err := a.getAppliedPlanFiles()
 	if err != nil {
@@ -485,7 +677,12 @@ func (a *Applyinator) writePlanToDisk(now time.Time, plan *CalculatedPlan) error
 	}
 
 	file := now.Format(applyinatorDateCodeLayout) + appliedPlanFileSuffix
-	anpString, err := json.Marshal(plan)
+	// the history is support data, it must not contain the secrets of the plan
+	anpString, err := json.Marshal(CalculatedPlan{
+		Plan:     RedactPlan(plan.Plan),
+		Checksum: plan.Checksum,
+		SignedBy: plan.SignedBy,
+	})
 	if err != nil {
 		return err
 	}
@@ -494,20 +691,57 @@ func (a *Applyinator) writePlanToDisk(now time.Time, plan *CalculatedPlan) error
 		sort.Slice(planFiles, func(i, j int) bool {
 			return planFiles[i].Name() > planFiles[j].Name()
 		})
-		existingFileContent, err := os.ReadFile(filepath.Join(a.appliedPlanDir, planFiles[0].Name()))
+		existingFileContent, err := crypt.ReadFile(filepath.Join(a.appliedPlanDir, planFiles[0].Name()))
 		if err != nil {
 			return err
 		}
-		if bytes.Equal(existingFileContent, anpString) {
-			logrus.Debugf("[Applyinator] Not writing applied plan to file %s as the last file written (%s) had identical contents", file, planFiles[0].Name())
+		// the checksum identifies equivalent plans, even if they are encoded differently
+		var existing CalculatedPlan
+		if err = json.Unmarshal(existingFileContent, &existing); err == nil && existing.Checksum == plan.Checksum {
+			logrus.Debugf("[Applyinator] Not writing applied plan to file %s as the last file written (%s) had the same checksum", file, planFiles[0].Name())
 			return nil
 		}
 	}
 
-	return writeContentToFile(filepath.Join(a.appliedPlanDir, file), os.Getuid(), os.Getgid(), 0600, anpString)
+	content, err := a.cipher.Encrypt(anpString)
+	if err != nil {
+		return err
+	}
+	if err = writeContentToFile(filepath.Join(a.appliedPlanDir, file), os.Getuid(), os.Getgid(), 0600, content); err != nil {
+		return err
+	}
+	if len(plan.signed) == 0 {
+		if a.cipher == nil {
+			return nil
+		}
+		// the redacted plan can't be applied again, an unsigned plan is kept with its secrets if the history is
+		// encrypted so that it can be rolled back
+		if content, err = json.Marshal(plan.Plan); err != nil {
+			return err
+		}
+		if content, err = a.cipher.Encrypt(content); err != nil {
+			return err
+		}
+		originalFile := now.Format(applyinatorDateCodeLayout) + originalPlanFileSuffix
+		return writeContentToFile(filepath.Join(a.appliedPlanDir, originalFile), os.Getuid(), os.Getgid(), 0600, content)
+	}
+
+	// the redacted plan can't be applied again, the signed contents are kept so that it can be rolled back
+	signed := make([]SignedContent, 0, len(plan.signed))
+	for _, part := range plan.signed {
+		signed = append(signed, SignedContent{Content: part.content, Signature: part.signature})
+	}
+	if content, err = json.Marshal(signed); err != nil {
+		return err
+	}
+	if content, err = a.cipher.Encrypt(content); err != nil {
+		return err
+	}
+	signedFile := now.Format(applyinatorDateCodeLayout) + signedPlanFileSuffix
+	return writeContentToFile(filepath.Join(a.appliedPlanDir, signedFile), os.Getuid(), os.Getgid(), 0600, content)
 }
 
-func (a *Applyinator) execute(ctx context.Context, prefix, executionDir string, instruction CommonInstruction, combinedOutput bool, attempt int) ([]byte, []byte, int, error) {
+func (a *Applyinator) execute(ctx context.Context, prefix string, redactor *Redactor, executionDir string, instruction CommonInstruction, combinedOutput bool, attempt int) ([]byte, []byte, int, error) {
 	if instruction.Image == "" {
 		logrus.Infof("[Applyinator] No image provided, creating empty working directory %s", executionDir)
 		if err := CreateDirectory(File{Directory: true, Path: executionDir}); err != nil {
@@ -522,42 +756,61 @@ func (a *Applyinator) execute(ctx context.Context, prefix, executionDir string,
 		}
 	}
 
+	// in rootfs mode the command runs inside the extracted image, paths are relative to its root
+	rootfs, commandDir := "", executionDir
+	if instruction.Rootfs {
+		rootfs, commandDir = executionDir, "/"
+	}
+
 	command := instruction.Command
 
 	if command == "" {
 		logrus.Debugf("[Applyinator] Command was not specified, defaulting to %s%s", executionDir, defaultCommand)
-		command = executionDir + defaultCommand
+		command = filepath.Join(commandDir, defaultCommand)
 	}
 
-	cmd := exec.CommandContext(ctx, command, instruction.Args...)
-	logrus.Infof("[Applyinator] Running command: %s %v", instruction.Command, instruction.Args)
-	cmd.Env = os.Environ()
-	cmd.Env = append(cmd.Env, instruction.Env...)
-	cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", cattleAgentExecutionPwdEnvKey, executionDir))
-	cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%d", cattleAgentAttemptKey, attempt))
-	cmd.Env = append(cmd.Env, "PATH="+os.Getenv("PATH")+":"+executionDir)
-	cmd.Dir = executionDir
+	if instruction.TimeoutSeconds > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(instruction.TimeoutSeconds)*time.Second)
+		defer cancel()
+	}
 
-	stdout, err := cmd.StdoutPipe()
+	executor, err := a.executor(instruction.Executor)
 	if err != nil {
-		logrus.Errorf("error setting up stdout pipe: %v", err)
 		return nil, nil, -1, err
 	}
-	defer stdout.Close() // nolint: errcheck
 
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		logrus.Errorf("error setting up stderr pipe: %v", err)
-		return nil, nil, -1, err
+	logrus.Infof("[Applyinator] Running command: %s %v", instruction.Command, redactInstruction(instruction, redactor).Args)
+	env, path := os.Environ(), os.Getenv("PATH")
+	if instruction.CleanEnv {
+		env, path = nil, defaultPath
+	}
+	if instruction.Rootfs {
+		// the host PATH does not apply inside the image
+		path = defaultPath
 	}
+	instructionEnv := append([]string(nil), instruction.Env...)
+	instructionEnv = append(instructionEnv, fmt.Sprintf("%s=%s", cattleAgentExecutionPwdEnvKey, commandDir))
+	instructionEnv = append(instructionEnv, fmt.Sprintf("%s=%d", cattleAgentAttemptKey, attempt))
+	instructionEnv = append(instructionEnv, "PATH="+path+":"+commandDir)
+	env = append(env, instructionEnv...)
+
+	dir := commandDir
+	if instruction.WorkingDir != "" {
+		dir = instruction.WorkingDir
+	}
+
+	stdout, stdoutWriter := io.Pipe()
+	defer stdout.Close() // nolint: errcheck
+	stderr, stderrWriter := io.Pipe()
 	defer stderr.Close() // nolint: errcheck
 
 	var (
 		eg              = errgroup.Group{}
 		stdoutWriteLock *sync.Mutex
 		stderrWriteLock *sync.Mutex
-		stdoutBuffer    bytes.Buffer
-		stderrBuffer    bytes.Buffer
+		stdoutBuffer    = &bytes.Buffer{}
+		stderrBuffer    = &bytes.Buffer{}
 	)
 
 	if combinedOutput {
@@ -570,39 +823,65 @@ func (a *Applyinator) execute(ctx context.Context, prefix, executionDir string,
 	}
 
 	eg.Go(func() error {
-		return streamLogs("["+prefix+":stdout]", &stdoutBuffer, stdout, stdoutWriteLock)
+		return streamLogs("["+prefix+":stdout]", redactor, stdoutBuffer, stdout, stdoutWriteLock)
 	})
 	eg.Go(func() error {
-		return streamLogs("["+prefix+":stderr]", &stderrBuffer, stderr, stderrWriteLock)
+		return streamLogs("["+prefix+":stderr]", redactor, stderrBuffer, stderr, stderrWriteLock)
 	})
 
-	if err := cmd.Start(); err != nil {
-		return nil, nil, -1, err
-	}
-
-	// Wait for I/O to complete before calling cmd.Wait() because cmd.Wait() will close the I/O pipes.
+	exitCode, err := executor.Run(ctx, &Command{
+		Name:           prefix,
+		Instruction:    instruction.Name,
+		Path:           command,
+		Args:           instruction.Args,
+		Env:            env,
+		InstructionEnv: instructionEnv,
+		Dir:            dir,
+		ExecutionDir:   executionDir,
+		Stdout:         stdoutWriter,
+		Stderr:         stderrWriter,
+
+		User:            instruction.User,
+		Group:           instruction.Group,
+		CPUQuota:        instruction.CPUQuota,
+		MemoryMax:       instruction.MemoryMax,
+		NoNewPrivileges: instruction.NoNewPrivileges,
+		Rootfs:          rootfs,
+		BindMounts:      instruction.BindMounts,
+	})
+	// Wait for I/O to complete before returning the output.
+	_ = stdoutWriter.Close()
+	_ = stderrWriter.Close()
 	_ = eg.Wait()
-	exitCode := 0
-	if err := cmd.Wait(); err != nil {
-		if ee, ok := err.(*exec.ExitError); ok {
-			exitCode = ee.ExitCode()
-		} else {
-			exitCode = -1
-		}
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("command timed out after %ds: %w", instruction.TimeoutSeconds, err)
 	}
-	logrus.Infof("[Applyinator] Command %s %v finished with err: %v and exit code: %d", instruction.Command, instruction.Args, err, exitCode)
+	logrus.Infof("[Applyinator] Command %s %v finished with err: %v and exit code: %d", instruction.Command,
+		redactInstruction(instruction, redactor).Args, err, exitCode)
 	return stdoutBuffer.Bytes(), stderrBuffer.Bytes(), exitCode, err
 }
 
-// streamLogs accepts a prefix, outputBuffer, reader, and buffer lock and will scan input from the reader and write it
-// to the output buffer while also logging anything that comes from the reader with the prefix.
-func streamLogs(prefix string, outputBuffer *bytes.Buffer, reader io.Reader, lock *sync.Mutex) error {
+// withExecutor returns the instruction with the executor of the plan if it does not select one itself.
+func withExecutor(instruction CommonInstruction, planExecutor string) CommonInstruction {
+	if instruction.Executor == "" {
+		instruction.Executor = planExecutor
+	}
+	return instruction
+}
+
+// streamLogs accepts a prefix, redactor, outputBuffer, reader, and buffer lock and will scan input from the reader and
+// write it to the output buffer while also logging anything that comes from the reader with the prefix. Sensitive values
+// are masked in both.
+func streamLogs(prefix string, redactor *Redactor, outputBuffer *bytes.Buffer, reader io.Reader, lock *sync.Mutex) error {
 	scanner := bufio.NewScanner(reader)
 	for scanner.Scan() {
-		logrus.Infof("%s: %s", prefix, scanner.Text())
+		line := redactor.String(scanner.Text())
+		logrus.Infof("%s: %s", prefix, line)
 		lock.Lock()
-		outputBuffer.Write(append(scanner.Bytes(), []byte("\n")...))
+		outputBuffer.WriteString(line + "\n")
 		lock.Unlock()
 	}
+	// keep draining the reader if a line is too long to scan, so the writer is not blocked
+	_, _ = io.Copy(io.Discard, reader)
 	return nil
 }
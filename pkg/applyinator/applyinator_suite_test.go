@@ -0,0 +1,13 @@
+package applyinator_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestApplyinator(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Applyinator Suite")
+}
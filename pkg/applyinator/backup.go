@@ -0,0 +1,224 @@
+package applyinator
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/llmos-ai/llmos/pkg/utils/atomicfile"
+	"github.com/llmos-ai/llmos/pkg/utils/crypt"
+)
+
+const (
+	backupIndexFile       = "index.json"
+	backupRetentionPolicy = 8
+)
+
+// BackupStore keeps the content files had before a plan overwrote them, so that the files of the
+// previously applied plan can be restored if the new plan fails. Every plan gets its own backup set,
+// named after the plan checksum.
+type BackupStore struct {
+	dir    string
+	cipher *crypt.Cipher
+}
+
+// BackupSet is the index of the files a plan overwrote.
+type BackupSet struct {
+	Checksum string       `json:"checksum"`
+	Created  string       `json:"created"` // Created is a time.RFC3339Nano formatted string of when the first file was backed up
+	Files    []BackupFile `json:"files"`
+}
+
+// BackupFile is the previous state of a file overwritten by the plan.
+type BackupFile struct {
+	Path string `json:"path"`
+	// Existed is false if the plan created the file, restoring the backup removes it
+	Existed bool        `json:"existed"`
+	Backup  string      `json:"backup,omitempty"`  // Backup is the name of the file holding the previous content
+	Symlink string      `json:"symlink,omitempty"` // Symlink is the target of the file if it was a symbolic link
+	Mode    os.FileMode `json:"mode,omitempty"`
+	UID     int         `json:"uid,omitempty"`
+	GID     int         `json:"gid,omitempty"`
+}
+
+// NewBackupStore returns a backup store under the directory, the backups are encrypted with the cipher
+// as the files of a plan usually contain credentials.
+func NewBackupStore(dir string, cipher *crypt.Cipher) *BackupStore {
+	return &BackupStore{dir: dir, cipher: cipher}
+}
+
+// SetBackupStore keeps the previous content of the files the plans overwrite in the store.
+func (a *Applyinator) SetBackupStore(store *BackupStore) {
+	a.backups = store
+}
+
+// backup saves the current state of the file at the path before the plan changes it. Only the first backup of a path
+// is kept for a plan, so that applying the same plan again does not replace the state of the previous plan.
+// Directories are not backed up.
+func (s *BackupStore) backup(checksum, path string) error {
+	if s == nil {
+		return nil
+	}
+
+	info, err := os.Lstat(path)
+	existed := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if existed && info.IsDir() {
+		return nil
+	}
+
+	set, err := s.Get(checksum)
+	if err != nil {
+		return err
+	}
+	if set == nil {
+		set = &BackupSet{Checksum: checksum, Created: time.Now().Format(time.RFC3339Nano)}
+	}
+	for _, backup := range set.Files {
+		if backup.Path == path {
+			return nil
+		}
+	}
+
+	setDir := filepath.Join(s.dir, checksum)
+	if err = os.MkdirAll(setDir, 0700); err != nil {
+		return err
+	}
+	backup := BackupFile{Path: path, Existed: existed}
+	switch {
+	case !existed:
+	case info.Mode()&os.ModeSymlink != 0:
+		if backup.Symlink, err = os.Readlink(path); err != nil {
+			return err
+		}
+	default:
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		backup.Mode = info.Mode().Perm()
+		backup.UID, backup.GID = fileOwner(info)
+		backup.Backup = fmt.Sprintf("%d.backup", len(set.Files))
+		encrypted, err := s.cipher.Encrypt(content)
+		if err != nil {
+			return err
+		}
+		if err = atomicfile.WriteFile(filepath.Join(setDir, backup.Backup), encrypted, 0600); err != nil {
+			return err
+		}
+	}
+	logrus.Debugf("[Applyinator] Backed up file %s for plan %s", path, checksum)
+
+	set.Files = append(set.Files, backup)
+	index, err := json.Marshal(set)
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(filepath.Join(setDir, backupIndexFile), index, 0600)
+}
+
+// Get returns the backup set of the plan with the checksum, nil if the plan did not overwrite any file.
+func (s *BackupStore) Get(checksum string) (*BackupSet, error) {
+	content, err := os.ReadFile(filepath.Join(s.dir, checksum, backupIndexFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	set := &BackupSet{}
+	if err = json.Unmarshal(content, set); err != nil {
+		return nil, fmt.Errorf("decoding backup index of plan %s: %w", checksum, err)
+	}
+	return set, nil
+}
+
+// List returns the backup sets, the most recent first.
+func (s *BackupStore) List() ([]BackupSet, error) {
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var sets []BackupSet
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		set, err := s.Get(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		if set != nil {
+			sets = append(sets, *set)
+		}
+	}
+	sort.SliceStable(sets, func(i, j int) bool {
+		return sets[i].Created > sets[j].Created
+	})
+	return sets, nil
+}
+
+// Restore puts the files of the backup set back the way they were before the plan was applied
+// and returns the restored paths.
+func (s *BackupStore) Restore(set BackupSet) ([]string, error) {
+	var restored []string
+	for _, backup := range set.Files {
+		if !backup.Existed {
+			logrus.Infof("[Applyinator] Removing file %s created by plan %s", backup.Path, set.Checksum)
+			if err := os.Remove(backup.Path); err != nil && !os.IsNotExist(err) {
+				return restored, err
+			}
+			restored = append(restored, backup.Path)
+			continue
+		}
+
+		if backup.Symlink != "" {
+			logrus.Infof("[Applyinator] Restoring symlink %s changed by plan %s", backup.Path, set.Checksum)
+			if err := createSymlink(backup.Path, backup.Symlink); err != nil {
+				return restored, fmt.Errorf("restoring %s: %w", backup.Path, err)
+			}
+			restored = append(restored, backup.Path)
+			continue
+		}
+
+		if isSymlink(backup.Path) {
+			if err := os.Remove(backup.Path); err != nil {
+				return restored, err
+			}
+		}
+		content, err := crypt.ReadFile(filepath.Join(s.dir, set.Checksum, backup.Backup))
+		if err != nil {
+			return restored, fmt.Errorf("reading backup of %s: %w", backup.Path, err)
+		}
+		logrus.Infof("[Applyinator] Restoring file %s overwritten by plan %s", backup.Path, set.Checksum)
+		if err = writeContentToFile(backup.Path, backup.UID, backup.GID, backup.Mode, content); err != nil {
+			return restored, fmt.Errorf("restoring %s: %w", backup.Path, err)
+		}
+		restored = append(restored, backup.Path)
+	}
+	return restored, nil
+}
+
+// prune removes the oldest backup sets beyond the retention.
+func (s *BackupStore) prune(retention int) error {
+	sets, err := s.List()
+	if err != nil {
+		return err
+	}
+	for i := retention; i < len(sets); i++ {
+		logrus.Debugf("[Applyinator] Removing backup of plan %s", sets[i].Checksum)
+		if err = os.RemoveAll(filepath.Join(s.dir, sets[i].Checksum)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package applyinator_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/llmos-ai/llmos/pkg/applyinator"
+)
+
+var _ = Describe("file backups", Label("applyinator", "backup"), func() {
+	var (
+		dir   string
+		store *applyinator.BackupStore
+		a     *applyinator.Applyinator
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		store = applyinator.NewBackupStore(filepath.Join(dir, "backup"), nil)
+		a = applyinator.NewApplyinator(filepath.Join(dir, "work"), false, "", "", nil)
+		a.SetBackupStore(store)
+	})
+
+	file := func(name, content string) applyinator.File {
+		return applyinator.File{
+			Path:    filepath.Join(dir, "etc", name),
+			Content: base64.StdEncoding.EncodeToString([]byte(content)),
+		}
+	}
+
+	apply := func(files ...applyinator.File) string {
+		raw, err := json.Marshal(applyinator.Plan{Files: files})
+		Expect(err).NotTo(HaveOccurred())
+		plan, err := applyinator.CalculatePlan(raw)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = a.Apply(context.Background(), applyinator.ApplyInput{
+			CalculatedPlan: plan,
+			ReconcileFiles: true,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return plan.Checksum
+	}
+
+	It("restores the files of the previous plan", func() {
+		apply(file("config.yaml", "token: old\n"))
+		checksum := apply(file("config.yaml", "token: new\n"), file("registries.yaml", "mirrors: {}\n"))
+		// applying the same plan again keeps the content of the previous plan
+		apply(file("config.yaml", "token: new\n"), file("registries.yaml", "mirrors: {}\n"))
+
+		Expect(os.ReadFile(filepath.Join(dir, "etc", "config.yaml"))).To(Equal([]byte("token: new\n")))
+		entries, err := os.ReadDir(filepath.Join(dir, "etc"))
+		Expect(err).NotTo(HaveOccurred())
+		// the atomic writes leave no temporary files behind
+		Expect(entries).To(HaveLen(2))
+
+		set, err := store.Get(checksum)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(set).NotTo(BeNil())
+		restored, err := store.Restore(*set)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(restored).To(ConsistOf(filepath.Join(dir, "etc", "config.yaml"), filepath.Join(dir, "etc", "registries.yaml")))
+
+		Expect(os.ReadFile(filepath.Join(dir, "etc", "config.yaml"))).To(Equal([]byte("token: old\n")))
+		Expect(filepath.Join(dir, "etc", "registries.yaml")).NotTo(BeAnExistingFile())
+	})
+
+	It("lists the backup sets with the most recent first", func() {
+		first := apply(file("config.yaml", "a"))
+		second := apply(file("config.yaml", "b"))
+
+		sets, err := store.List()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sets).To(HaveLen(2))
+		Expect(sets[0].Checksum).To(Equal(second))
+		Expect(sets[1].Checksum).To(Equal(first))
+	})
+})
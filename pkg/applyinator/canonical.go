@@ -0,0 +1,100 @@
+package applyinator
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/llmos-ai/llmos/pkg/applyinator/prober"
+)
+
+const defaultPeriodSeconds = 600
+
+// PlanChecksum returns the checksum identifying the plan. It is calculated from the canonical encoding of the plan,
+// so that plans only differing in key order, whitespace, the encoding of file content or explicitly set defaults
+// have the same checksum.
+func PlanChecksum(plan Plan) (string, error) {
+	encoded, err := canonicalJSON(canonicalPlan(plan))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(encoded)), nil
+}
+
+// canonicalPlan returns the plan with its defaults set explicitly. The order of the files and instructions is kept,
+// as it is the order they are applied in.
+func canonicalPlan(plan Plan) Plan {
+	result := Plan{
+		Executor: plan.Executor,
+		Probes:   map[string]prober.Probe{},
+	}
+	if result.Executor == "" {
+		result.Executor = ExecutorLocal
+	}
+
+	for _, file := range plan.Files {
+		if file.State == "" {
+			file.State = FileStatePresent
+		}
+		if file.Permissions == "" {
+			if file.Directory {
+				file.Permissions = fmt.Sprintf("%04o", defaultDirectoryPermissions)
+			} else {
+				file.Permissions = fmt.Sprintf("%04o", defaultFilePermissions)
+			}
+		} else if perm, err := parsePerm(file.Permissions); err == nil {
+			file.Permissions = fmt.Sprintf("%04o", perm)
+		}
+		if file.Content != "" {
+			if content, err := DecodeContent(file); err == nil {
+				file.Content = base64.StdEncoding.EncodeToString(content)
+				file.Encoding = ""
+			}
+		}
+		result.Files = append(result.Files, file)
+	}
+
+	for _, instruction := range plan.OneTimeInstructions {
+		instruction.CommonInstruction = withExecutor(instruction.CommonInstruction, result.Executor)
+		result.OneTimeInstructions = append(result.OneTimeInstructions, instruction)
+	}
+	for _, instruction := range plan.PeriodicInstructions {
+		instruction.CommonInstruction = withExecutor(instruction.CommonInstruction, result.Executor)
+		if instruction.PeriodSeconds == 0 && instruction.Schedule == "" {
+			instruction.PeriodSeconds = defaultPeriodSeconds
+		}
+		result.PeriodicInstructions = append(result.PeriodicInstructions, instruction)
+	}
+
+	for name, probe := range plan.Probes {
+		if probe.TimeoutSeconds == 0 {
+			probe.TimeoutSeconds = 1
+		}
+		if probe.SuccessThreshold == 0 {
+			probe.SuccessThreshold = 1
+		}
+		if probe.FailureThreshold == 0 {
+			probe.FailureThreshold = 3
+		}
+		result.Probes[name] = probe
+	}
+	return result
+}
+
+// canonicalJSON encodes the value as compact JSON with the keys of all objects sorted.
+func canonicalJSON(value interface{}) ([]byte, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	// objects decoded into maps are encoded with sorted keys, numbers are kept as they are
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	var generic interface{}
+	if err = decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return json.Marshal(generic)
+}
@@ -0,0 +1,52 @@
+package applyinator_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/llmos-ai/llmos/pkg/applyinator"
+)
+
+var _ = Describe("canonical plan checksum", Label("applyinator", "checksum"), func() {
+	checksum := func(raw string) string {
+		plan, err := applyinator.CalculatePlan([]byte(raw))
+		Expect(err).NotTo(HaveOccurred())
+		return plan.Checksum
+	}
+
+	base := `{"files":[{"path":"/etc/sysctl.d/90-llmos.conf","content":"dm0uc3dhcHBpbmVzcz0w"}],` +
+		`"instructions":[{"name":"sysctl","command":"sysctl","args":["--system"]}],` +
+		`"periodicInstructions":[{"name":"check","command":"true"}],` +
+		`"probes":{"kubelet":{"httpGet":{"url":"https://127.0.0.1:10250/healthz"}}}}`
+
+	DescribeTable("is the same for equivalent plans", func(equivalent string) {
+		Expect(checksum(equivalent)).To(Equal(checksum(base)))
+	},
+		Entry("with another key order and whitespace", `{
+			"probes": {"kubelet": {"httpGet": {"url": "https://127.0.0.1:10250/healthz"}}},
+			"periodicInstructions": [{"command": "true", "name": "check"}],
+			"instructions": [{"args": ["--system"], "command": "sysctl", "name": "sysctl"}],
+			"files": [{"content": "dm0uc3dhcHBpbmVzcz0w", "path": "/etc/sysctl.d/90-llmos.conf"}]
+		}`),
+		Entry("with the content in another encoding",
+			`{"files":[{"path":"/etc/sysctl.d/90-llmos.conf","content":"vm.swappiness=0","encoding":"plain"}],`+
+				`"instructions":[{"name":"sysctl","command":"sysctl","args":["--system"]}],`+
+				`"periodicInstructions":[{"name":"check","command":"true"}],`+
+				`"probes":{"kubelet":{"httpGet":{"url":"https://127.0.0.1:10250/healthz"}}}}`),
+		Entry("with the defaults set explicitly",
+			`{"executor":"local","files":[{"path":"/etc/sysctl.d/90-llmos.conf","content":"dm0uc3dhcHBpbmVzcz0w",`+
+				`"permissions":"600","state":"present"}],`+
+				`"instructions":[{"name":"sysctl","command":"sysctl","args":["--system"],"executor":"local"}],`+
+				`"periodicInstructions":[{"name":"check","command":"true","periodSeconds":600}],`+
+				`"probes":{"kubelet":{"httpGet":{"url":"https://127.0.0.1:10250/healthz"},"timeoutSeconds":1,`+
+				`"successThreshold":1,"failureThreshold":3}}}`),
+	)
+
+	It("changes with the plan", func() {
+		Expect(checksum(`{"instructions":[{"name":"sysctl","command":"sysctl","args":["--load"]}]}`)).
+			NotTo(Equal(checksum(`{"instructions":[{"name":"sysctl","command":"sysctl","args":["--system"]}]}`)))
+		// the order of the instructions is the order they are run in
+		Expect(checksum(`{"instructions":[{"name":"a","command":"true"},{"name":"b","command":"true"}]}`)).
+			NotTo(Equal(checksum(`{"instructions":[{"name":"b","command":"true"},{"name":"a","command":"true"}]}`)))
+	})
+})
@@ -0,0 +1,179 @@
+package applyinator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// hasDependencies returns true if any one-time instruction declares its dependencies. Plans without dependencies
+// run their one-time instructions in order, otherwise instructions without dependencies can run right away.
+func hasDependencies(instructions []OneTimeInstruction) bool {
+	for _, instruction := range instructions {
+		if len(instruction.DependsOn) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// oneTimeDependencies returns the indexes of the instructions each one-time instruction depends on.
+// It fails on duplicated instruction names, unknown dependencies and dependency cycles.
+func oneTimeDependencies(instructions []OneTimeInstruction) ([][]int, error) {
+	indexes := map[string]int{}
+	for index, instruction := range instructions {
+		if instruction.Name == "" {
+			continue
+		}
+		if _, ok := indexes[instruction.Name]; ok {
+			return nil, fmt.Errorf("instruction name %s is used more than once", instruction.Name)
+		}
+		indexes[instruction.Name] = index
+	}
+
+	dependencies := make([][]int, len(instructions))
+	if !hasDependencies(instructions) {
+		for index := 1; index < len(instructions); index++ {
+			dependencies[index] = []int{index - 1}
+		}
+		return dependencies, nil
+	}
+
+	for index, instruction := range instructions {
+		for _, name := range instruction.DependsOn {
+			dependency, ok := indexes[name]
+			if !ok {
+				return nil, fmt.Errorf("instruction %s depends on unknown instruction %s", instructionName(instruction, index), name)
+			}
+			if dependency == index {
+				return nil, fmt.Errorf("instruction %s depends on itself", instructionName(instruction, index))
+			}
+			dependencies[index] = append(dependencies[index], dependency)
+		}
+	}
+
+	if cycle := findCycle(instructions, dependencies); len(cycle) > 0 {
+		return nil, fmt.Errorf("instructions have a dependency cycle: %s", strings.Join(cycle, " -> "))
+	}
+	return dependencies, nil
+}
+
+// findCycle returns the names of the instructions forming a dependency cycle, or nil if there is none.
+func findCycle(instructions []OneTimeInstruction, dependencies [][]int) []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	var (
+		marks = make([]int, len(instructions))
+		stack []int
+		visit func(index int) []string
+	)
+	visit = func(index int) []string {
+		marks[index] = visiting
+		stack = append(stack, index)
+		for _, dependency := range dependencies[index] {
+			switch marks[dependency] {
+			case visiting:
+				// the cycle runs from this instruction back to itself through the instructions on the stack
+				cycle := []string{instructionName(instructions[index], index)}
+				start := len(stack) - 1
+				for stack[start] != dependency {
+					start--
+				}
+				for _, i := range stack[start:] {
+					cycle = append(cycle, instructionName(instructions[i], i))
+				}
+				return cycle
+			case unvisited:
+				if cycle := visit(dependency); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		marks[index] = visited
+		return nil
+	}
+
+	for index := range instructions {
+		if marks[index] == unvisited {
+			if cycle := visit(index); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+func instructionName(instruction OneTimeInstruction, index int) string {
+	if instruction.Name == "" {
+		return fmt.Sprintf("#%d", index)
+	}
+	return instruction.Name
+}
+
+type dagResult struct {
+	index     int
+	succeeded bool
+}
+
+// runDAG calls run for every instruction once all of its dependencies succeeded, with at most concurrency calls
+// running at the same time. Ready instructions are started in plan order. Once an instruction fails no further
+// instruction is started, runDAG waits for the running ones and returns false.
+func runDAG(dependencies [][]int, concurrency int, run func(index int) bool) bool {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var (
+		remaining  = make([]int, len(dependencies))
+		dependents = make([][]int, len(dependencies))
+		ready      []int
+		done       = make(chan dagResult)
+		running    int
+		completed  int
+		failed     bool
+	)
+	for index, deps := range dependencies {
+		remaining[index] = len(deps)
+		for _, dependency := range deps {
+			dependents[dependency] = append(dependents[dependency], index)
+		}
+		if len(deps) == 0 {
+			ready = append(ready, index)
+		}
+	}
+
+	for {
+		for !failed && len(ready) > 0 && running < concurrency {
+			index := ready[0]
+			ready = ready[1:]
+			running++
+			go func() {
+				done <- dagResult{index: index, succeeded: run(index)}
+			}()
+		}
+		if running == 0 {
+			break
+		}
+
+		result := <-done
+		running--
+		if !result.succeeded {
+			failed = true
+			continue
+		}
+		completed++
+		for _, dependent := range dependents[result.index] {
+			remaining[dependent]--
+			if remaining[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+		sort.Ints(ready)
+	}
+
+	return !failed && completed == len(dependencies)
+}
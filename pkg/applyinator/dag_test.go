@@ -0,0 +1,83 @@
+package applyinator_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/llmos-ai/llmos/pkg/applyinator"
+)
+
+func instruction(name, script string, dependsOn ...string) applyinator.OneTimeInstruction {
+	return applyinator.OneTimeInstruction{
+		CommonInstruction: applyinator.CommonInstruction{
+			Name:    name,
+			Command: "/bin/sh",
+			Args:    []string{"-c", script},
+		},
+		DependsOn: dependsOn,
+	}
+}
+
+func calculate(instructions ...applyinator.OneTimeInstruction) (applyinator.CalculatedPlan, error) {
+	raw, err := json.Marshal(applyinator.Plan{OneTimeInstructions: instructions})
+	Expect(err).NotTo(HaveOccurred())
+	return applyinator.CalculatePlan(raw)
+}
+
+var _ = Describe("one-time instruction dependencies", Label("applyinator", "dag"), func() {
+	It("rejects unknown dependencies", func() {
+		_, err := calculate(instruction("a", "true", "missing"))
+		Expect(err).To(MatchError(ContainSubstring("depends on unknown instruction missing")))
+	})
+
+	It("rejects duplicated instruction names", func() {
+		_, err := calculate(instruction("a", "true"), instruction("a", "true"))
+		Expect(err).To(MatchError(ContainSubstring("instruction name a is used more than once")))
+	})
+
+	It("rejects dependency cycles", func() {
+		_, err := calculate(
+			instruction("a", "true", "c"),
+			instruction("b", "true", "a"),
+			instruction("c", "true", "b"),
+		)
+		Expect(err).To(MatchError(ContainSubstring("dependency cycle")))
+	})
+
+	It("runs instructions after their dependencies and stops at the first failure", func() {
+		dir := GinkgoT().TempDir()
+		log := filepath.Join(dir, "log")
+		record := func(name string) string {
+			return "echo " + name + " >> " + log
+		}
+
+		plan, err := calculate(
+			instruction("install", record("install")),
+			instruction("wait-a", "sleep 0.2; "+record("wait-a"), "install"),
+			instruction("wait-b", record("wait-b"), "install"),
+			instruction("fail", "exit 1", "wait-a", "wait-b"),
+			instruction("never", record("never"), "fail"),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		a := applyinator.NewApplyinator(filepath.Join(dir, "work"), false, "", "", nil)
+		output, err := a.Apply(context.Background(), applyinator.ApplyInput{
+			CalculatedPlan:                plan,
+			RunOneTimeInstructions:        true,
+			OneTimeInstructionConcurrency: 2,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output.OneTimeApplySucceeded).To(BeFalse())
+
+		content, err := os.ReadFile(log)
+		Expect(err).NotTo(HaveOccurred())
+		// wait-b does not wait for the slower wait-a as they run in parallel
+		Expect(strings.Fields(string(content))).To(Equal([]string{"install", "wait-b", "wait-a"}))
+	})
+})
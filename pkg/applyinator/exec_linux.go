@@ -0,0 +1,309 @@
+//go:build linux
+// +build linux
+
+package applyinator
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+// cgroupParent is the cgroup v2 group the cgroups of limited commands are created in.
+var cgroupParent = filepath.Join(cgroupRoot, "llmos")
+
+// mountRootfs bind mounts the host paths into the rootfs of the command and chroots cmd into it. It must run on
+// the locked OS thread starting the command after the thread unshared its mount namespace, see startCommand, so
+// that the mounts are private to the command and go away with it, even if llmos is killed while it runs.
+func mountRootfs(cmd *exec.Cmd, command *Command) error {
+	// the mounts must not propagate back to the host
+	if err := unix.Mount("", "/", "", unix.MS_PRIVATE|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("making the mount namespace private: %w", err)
+	}
+
+	for _, mount := range rootfsMounts(command) {
+		info, err := os.Stat(mount.Source)
+		if errors.Is(err, os.ErrNotExist) && mount.optional {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("bind mount source %s: %w", mount.Source, err)
+		}
+
+		target := filepath.Join(command.Rootfs, mount.Target)
+		if err = createMountpoint(command.Rootfs, target, info.IsDir()); err != nil {
+			return err
+		}
+		if err = unix.Mount(mount.Source, target, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+			return fmt.Errorf("bind mounting %s to %s: %w", mount.Source, target, err)
+		}
+		if mount.ReadOnly {
+			if err = unix.Mount("", target, "", unix.MS_BIND|unix.MS_REMOUNT|unix.MS_RDONLY, ""); err != nil {
+				return fmt.Errorf("remounting %s read-only: %w", target, err)
+			}
+		}
+	}
+
+	cmd.SysProcAttr.Chroot = command.Rootfs
+	return nil
+}
+
+// removeWorkDir removes the work directory. The rootfs mounts of the commands are private to them, but mounts left
+// under the directory, e.g. by a previous version of llmos that was killed, are unmounted first so that removing the
+// directory never deletes the host files mounted into it.
+func removeWorkDir(dir string) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	mounts, err := mountsUnder(dir)
+	if err != nil {
+		return err
+	}
+	// the nested mounts are unmounted first
+	sort.Sort(sort.Reverse(sort.StringSlice(mounts)))
+	for _, mount := range mounts {
+		if err := unix.Unmount(mount, unix.MNT_DETACH); err != nil && !errors.Is(err, unix.EINVAL) {
+			return fmt.Errorf("unmounting %s left in the work directory: %w", mount, err)
+		}
+	}
+	if mounts, err = mountsUnder(dir); err != nil {
+		return err
+	} else if len(mounts) > 0 {
+		return fmt.Errorf("refusing to remove the work directory %s, %s is still mounted", dir, mounts[0])
+	}
+	return os.RemoveAll(dir)
+}
+
+// mountsUnder returns the mount points of the mount namespace of llmos in the directory.
+func mountsUnder(dir string) ([]string, error) {
+	content, err := os.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		return nil, fmt.Errorf("reading mounts: %w", err)
+	}
+	var mounts []string
+	for _, line := range strings.Split(string(content), "\n") {
+		// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			continue
+		}
+		mountPoint := unescapeMountPoint(fields[4])
+		if mountPoint == dir || strings.HasPrefix(mountPoint, dir+string(filepath.Separator)) {
+			mounts = append(mounts, mountPoint)
+		}
+	}
+	return mounts, nil
+}
+
+// unescapeMountPoint decodes the octal escapes of the spaces, tabs, newlines and backslashes of a mountinfo path.
+func unescapeMountPoint(path string) string {
+	if !strings.Contains(path, "\\") {
+		return path
+	}
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if value, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(value))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(path[i])
+	}
+	return b.String()
+}
+
+// createMountpoint creates the directory or file to mount on, the mount point must not resolve outside of the rootfs.
+func createMountpoint(rootfs, target string, dir bool) error {
+	root, err := filepath.EvalSymlinks(rootfs)
+	if err != nil {
+		return err
+	}
+	parent := filepath.Dir(target)
+	if err = os.MkdirAll(parent, 0755); err != nil {
+		return err
+	}
+	resolved, err := filepath.EvalSymlinks(parent)
+	if err != nil {
+		return err
+	}
+	if resolved != root && !strings.HasPrefix(resolved, root+string(filepath.Separator)) {
+		return fmt.Errorf("mount point %s resolves outside of the rootfs %s", target, rootfs)
+	}
+
+	if info, err := os.Lstat(target); err == nil {
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("mount point %s is a symlink", target)
+		}
+		return nil
+	}
+	if dir {
+		return os.Mkdir(target, 0755)
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// applyPrivileges sets the credentials and the cgroup of the command on cmd, the returned cleanup function
+// removes the cgroup once the command finished.
+func applyPrivileges(cmd *exec.Cmd, command *Command) (func(), error) {
+	if command.User != "" {
+		credential, err := lookupCredential(command.User, command.Group)
+		if err != nil {
+			return nil, err
+		}
+		cmd.SysProcAttr.Credential = credential
+	}
+
+	if !command.hasLimits() {
+		return func() {}, nil
+	}
+	cgroup, err := createCgroup(strings.TrimSuffix(unitName(command), ".service"), command)
+	if err != nil {
+		return nil, err
+	}
+	fd, err := os.Open(cgroup)
+	if err != nil {
+		removeCgroup(cgroup)
+		return nil, err
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(fd.Fd())
+	return func() {
+		_ = fd.Close()
+		removeCgroup(cgroup)
+	}, nil
+}
+
+// startCommand starts the command, in a private mount namespace with its rootfs mounted if it has one and with
+// no_new_privs set if requested. Both are set up on a locked OS thread that starts the command and is then discarded,
+// as they can't be undone and would otherwise leak to the applyinator.
+func startCommand(cmd *exec.Cmd, command *Command) error {
+	if command.Rootfs == "" && !command.NoNewPrivileges {
+		return cmd.Start()
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		// the thread is terminated when the goroutine exits without unlocking it
+		runtime.LockOSThread()
+		if command.Rootfs != "" {
+			if err := unix.Unshare(unix.CLONE_NEWNS); err != nil {
+				result <- fmt.Errorf("creating the mount namespace of the command: %w", err)
+				return
+			}
+			if err := mountRootfs(cmd, command); err != nil {
+				result <- err
+				return
+			}
+		}
+		if command.NoNewPrivileges {
+			if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+				result <- fmt.Errorf("setting no_new_privs: %w", err)
+				return
+			}
+		}
+		result <- cmd.Start()
+	}()
+	return <-result
+}
+
+func lookupCredential(userName, groupName string) (*syscall.Credential, error) {
+	u, err := user.Lookup(userName)
+	if err != nil {
+		if u, err = user.LookupId(userName); err != nil {
+			return nil, fmt.Errorf("looking up user %s: %w", userName, err)
+		}
+	}
+	gid := u.Gid
+	if groupName != "" {
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			if g, err = user.LookupGroupId(groupName); err != nil {
+				return nil, fmt.Errorf("looking up group %s: %w", groupName, err)
+			}
+		}
+		gid = g.Gid
+	}
+
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	parsedGID, err := strconv.ParseUint(gid, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	return &syscall.Credential{Uid: uint32(uid), Gid: uint32(parsedGID)}, nil
+}
+
+// createCgroup creates the cgroup v2 group of the command with its cpu and memory limits.
+func createCgroup(name string, command *Command) (string, error) {
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return "", fmt.Errorf("resource limits require cgroup v2 mounted at %s: %w", cgroupRoot, err)
+	}
+	if err := os.MkdirAll(cgroupParent, 0755); err != nil {
+		return "", err
+	}
+	// enable the controllers for the children of the llmos group
+	for _, dir := range []string{cgroupRoot, cgroupParent} {
+		if err := os.WriteFile(filepath.Join(dir, "cgroup.subtree_control"), []byte("+cpu +memory"), 0644); err != nil {
+			return "", fmt.Errorf("enabling cpu and memory controllers in %s: %w", dir, err)
+		}
+	}
+
+	cgroup := filepath.Join(cgroupParent, name)
+	// a cgroup left behind by a previous run would still hold its limits
+	removeCgroup(cgroup)
+	if err := os.Mkdir(cgroup, 0755); err != nil {
+		return "", err
+	}
+
+	if quota, _ := parseCPUQuota(command.CPUQuota); quota > 0 {
+		if err := os.WriteFile(filepath.Join(cgroup, "cpu.max"), []byte(fmt.Sprintf("%d %d", quota, cpuPeriod)), 0644); err != nil {
+			removeCgroup(cgroup)
+			return "", fmt.Errorf("setting cpu quota: %w", err)
+		}
+	}
+	if memory, _ := parseMemoryMax(command.MemoryMax); memory > 0 {
+		if err := os.WriteFile(filepath.Join(cgroup, "memory.max"), []byte(strconv.FormatInt(memory, 10)), 0644); err != nil {
+			removeCgroup(cgroup)
+			return "", fmt.Errorf("setting memory limit: %w", err)
+		}
+	}
+	return cgroup, nil
+}
+
+// removeCgroup kills the processes left in the cgroup and removes it.
+func removeCgroup(cgroup string) {
+	if _, err := os.Stat(cgroup); errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	_ = os.WriteFile(filepath.Join(cgroup, "cgroup.kill"), []byte("1"), 0644)
+	var err error
+	for i := 0; i < 10; i++ {
+		if err = os.Remove(cgroup); err == nil || errors.Is(err, os.ErrNotExist) {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	logrus.Errorf("error removing cgroup %s: %v", cgroup, err)
+}
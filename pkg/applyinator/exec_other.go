@@ -0,0 +1,34 @@
+//go:build !linux
+// +build !linux
+
+package applyinator
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// removeWorkDir removes the work directory, no rootfs is mounted into it outside of Linux.
+func removeWorkDir(dir string) error {
+	return os.RemoveAll(dir)
+}
+
+// applyPrivileges fails for commands with credentials or resource limits, they are only supported on Linux.
+func applyPrivileges(_ *exec.Cmd, command *Command) (func(), error) {
+	if command.User != "" || command.hasLimits() {
+		return nil, fmt.Errorf("user and resource limits are only supported on linux")
+	}
+	return func() {}, nil
+}
+
+// startCommand fails for commands with a rootfs or no_new_privs, they are only supported on Linux.
+func startCommand(cmd *exec.Cmd, command *Command) error {
+	if command.Rootfs != "" {
+		return fmt.Errorf("rootfs is only supported on linux")
+	}
+	if command.NoNewPrivileges {
+		return fmt.Errorf("noNewPrivileges is only supported on linux")
+	}
+	return cmd.Start()
+}
@@ -0,0 +1,11 @@
+//go:build windows
+// +build windows
+
+package applyinator
+
+import (
+	"os/exec"
+)
+
+// setProcessGroup is a no op on Windows, only the command process is killed once the command context is done.
+func setProcessGroup(_ *exec.Cmd) {}
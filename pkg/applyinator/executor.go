@@ -0,0 +1,116 @@
+package applyinator
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+)
+
+// Names of the built-in executors
+const (
+	ExecutorLocal   = "local"
+	ExecutorSystemd = "systemd"
+)
+
+// Command is the resolved command of an instruction that an Executor runs.
+type Command struct {
+	// Name identifies the instruction of a plan, it is stable across restarts of the applyinator
+	Name string
+	// Instruction is the name of the instruction, it may be empty
+	Instruction string
+	Path        string
+	Args        []string
+	// Env is the complete environment of the command
+	Env []string
+	// InstructionEnv is Env without the environment of the host, executors starting the command outside of the
+	// applyinator process forward it instead of Env
+	InstructionEnv []string
+	Dir            string
+	// ExecutionDir is the host directory the instruction is executed in, executors may keep their files in it
+	ExecutionDir string
+	Stdout       io.Writer
+	Stderr       io.Writer
+
+	// User and Group to run the command as, see CommonInstruction for the format of the limits
+	User            string
+	Group           string
+	CPUQuota        string
+	MemoryMax       string
+	NoNewPrivileges bool
+
+	// Rootfs is the host directory the command is chrooted into with the BindMounts, Path and Dir are inside it
+	Rootfs     string
+	BindMounts []BindMount
+}
+
+// Executor runs the commands of plan instructions.
+type Executor interface {
+	// Run runs the command to completion while writing its output to the command's Stdout and Stderr,
+	// and returns its exit code. The command is stopped once the context is done.
+	Run(ctx context.Context, command *Command) (int, error)
+}
+
+// RegisterExecutor makes the executor selectable by name in the plan and its instructions.
+func (a *Applyinator) RegisterExecutor(name string, executor Executor) {
+	a.executors[name] = executor
+}
+
+// executor returns the executor with the name, the local executor is the default.
+func (a *Applyinator) executor(name string) (Executor, error) {
+	if name == "" {
+		name = ExecutorLocal
+	}
+	executor, ok := a.executors[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown executor %s", name)
+	}
+	return executor, nil
+}
+
+// validateExecutors checks that the executors selected by the plan are registered.
+func (a *Applyinator) validateExecutors(plan Plan) error {
+	if _, err := a.executor(plan.Executor); err != nil {
+		return err
+	}
+	for index, instruction := range plan.OneTimeInstructions {
+		if _, err := a.executor(instruction.Executor); err != nil {
+			return fmt.Errorf("one-time instruction %s: %w", instructionName(instruction, index), err)
+		}
+	}
+	for _, instruction := range plan.PeriodicInstructions {
+		if _, err := a.executor(instruction.Executor); err != nil {
+			return fmt.Errorf("periodic instruction %s: %w", instruction.Name, err)
+		}
+	}
+	return nil
+}
+
+// localExecutor runs the command as a child process of the applyinator.
+type localExecutor struct{}
+
+func (localExecutor) Run(ctx context.Context, command *Command) (int, error) {
+	cmd := exec.CommandContext(ctx, command.Path, command.Args...)
+	setProcessGroup(cmd)
+	cmd.Env = command.Env
+	cmd.Dir = command.Dir
+	cmd.Stdout = command.Stdout
+	cmd.Stderr = command.Stderr
+
+	cleanup, err := applyPrivileges(cmd, command)
+	if err != nil {
+		return -1, err
+	}
+	defer cleanup()
+
+	if err := startCommand(cmd, command); err != nil {
+		return -1, err
+	}
+	if err := cmd.Wait(); err != nil {
+		if ee, ok := err.(*exec.ExitError); ok {
+			return ee.ExitCode(), err
+		}
+		return -1, err
+	}
+	return 0, nil
+}
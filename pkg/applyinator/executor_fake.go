@@ -0,0 +1,101 @@
+package applyinator
+
+import (
+	"context"
+	"sync"
+)
+
+// FakeResult is the result the FakeExecutor returns for a command.
+type FakeResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+	Err      error
+}
+
+// FakeExecutor is an in-memory Executor for tests. It records the commands instead of running them
+// and returns the result configured for the instruction, commands without a result succeed.
+type FakeExecutor struct {
+	mu       sync.Mutex
+	commands []Command
+	results  map[string]FakeResult
+}
+
+func NewFakeExecutor() *FakeExecutor {
+	return &FakeExecutor{
+		results: map[string]FakeResult{},
+	}
+}
+
+// SetResult sets the result of the commands of the named instruction.
+func (f *FakeExecutor) SetResult(instruction string, result FakeResult) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.results[instruction] = result
+}
+
+// Commands returns the commands run so far in the order they were run.
+func (f *FakeExecutor) Commands() []Command {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Command(nil), f.commands...)
+}
+
+func (f *FakeExecutor) Run(ctx context.Context, command *Command) (int, error) {
+	f.mu.Lock()
+	f.commands = append(f.commands, *command)
+	result := f.results[command.Instruction]
+	f.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return -1, err
+	}
+	if _, err := command.Stdout.Write([]byte(result.Stdout)); err != nil {
+		return -1, err
+	}
+	if _, err := command.Stderr.Write([]byte(result.Stderr)); err != nil {
+		return -1, err
+	}
+	return result.ExitCode, result.Err
+}
+
+// FakeCommandRunner is a CommandRunner for tests. It records the system commands instead of running them and
+// returns the output of the handler of the command, commands without a handler succeed without output.
+type FakeCommandRunner struct {
+	mu       sync.Mutex
+	commands [][]string
+	handlers map[string]func(args []string) ([]byte, error)
+}
+
+func NewFakeCommandRunner() *FakeCommandRunner {
+	return &FakeCommandRunner{
+		handlers: map[string]func(args []string) ([]byte, error){},
+	}
+}
+
+// Handle sets the handler of the commands with the name.
+func (f *FakeCommandRunner) Handle(name string, handler func(args []string) ([]byte, error)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handlers[name] = handler
+}
+
+// Commands returns the argv of the commands run so far in the order they were run.
+func (f *FakeCommandRunner) Commands() [][]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([][]string(nil), f.commands...)
+}
+
+// Run is the CommandRunner of the fake.
+func (f *FakeCommandRunner) Run(name string, args ...string) ([]byte, error) {
+	f.mu.Lock()
+	f.commands = append(f.commands, append([]string{name}, args...))
+	handler := f.handlers[name]
+	f.mu.Unlock()
+
+	if handler == nil {
+		return nil, nil
+	}
+	return handler(args)
+}
@@ -0,0 +1,234 @@
+package applyinator
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var unitNameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9:_.\-]+`)
+
+// CommandRunner runs a system command such as systemctl and returns its stdout, the error of a failed command is an
+// *exec.ExitError holding its stderr.
+type CommandRunner func(name string, args ...string) ([]byte, error)
+
+func runCommand(name string, args ...string) ([]byte, error) {
+	return exec.Command(name, args...).Output()
+}
+
+// systemdExecutor runs the command as a transient systemd service with systemd-run, so the command survives a restart
+// of the applyinator and its output is logged to journald under its own unit. A unit that is still running when the
+// instruction is run again, e.g. after a restart, is re-attached to instead of starting the command a second time.
+// The output of the unit is read from journald once it finished, stdout and stderr are combined.
+type systemdExecutor struct {
+	run          CommandRunner
+	pollInterval time.Duration
+}
+
+// NewSystemdExecutor returns the systemd executor running systemd-run, systemctl and journalctl with run and polling
+// the state of the units every pollInterval.
+func NewSystemdExecutor(run CommandRunner, pollInterval time.Duration) Executor {
+	return &systemdExecutor{run: run, pollInterval: pollInterval}
+}
+
+func (e *systemdExecutor) Run(ctx context.Context, command *Command) (int, error) {
+	unit := unitName(command)
+
+	props, err := e.showUnit(unit)
+	if err != nil {
+		return -1, err
+	}
+	if unitRunning(props) {
+		logrus.Infof("[Applyinator] Re-attaching to running unit %s", unit)
+	} else {
+		// clean up the unit of a previous attempt, it is kept loaded to read its result
+		e.removeUnit(unit)
+
+		// the env is passed in a file, arguments of systemd-run and unit properties are readable by every user
+		envFile := filepath.Join(command.ExecutionDir, strings.TrimSuffix(unit, ".service")+".env")
+		if err = writeEnvFile(envFile, command.InstructionEnv); err != nil {
+			return -1, fmt.Errorf("writing env of unit %s: %w", unit, err)
+		}
+		defer os.Remove(envFile) // nolint: errcheck
+
+		args := []string{
+			"--unit", unit,
+			"--description", fmt.Sprintf("llmos plan instruction %s", command.Instruction),
+			"--property", "RemainAfterExit=yes",
+			"--property", "EnvironmentFile=" + envFile,
+			"--working-directory", command.Dir,
+			"--quiet",
+		}
+		args = append(args, unitProperties(command)...)
+		args = append(args, "--", command.Path)
+		args = append(args, command.Args...)
+
+		logrus.Infof("[Applyinator] Starting unit %s", unit)
+		if _, err := e.run("systemd-run", args...); err != nil {
+			return -1, fmt.Errorf("starting unit %s: %w%s", unit, err, commandStderr(err))
+		}
+		if props, err = e.showUnit(unit); err != nil {
+			return -1, err
+		}
+	}
+
+	for !unitFinished(props) {
+		select {
+		case <-ctx.Done():
+			// only stop the unit on timeouts, a cancelled applyinator re-attaches to the unit the next time
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				e.removeUnit(unit)
+			}
+			return -1, ctx.Err()
+		case <-time.After(e.pollInterval):
+		}
+		if props, err = e.showUnit(unit); err != nil {
+			return -1, err
+		}
+	}
+
+	output, err := e.run("journalctl", "--no-pager", "--output", "cat",
+		"_SYSTEMD_INVOCATION_ID="+props["InvocationID"])
+	if err != nil {
+		logrus.Errorf("error reading journal of unit %s: %v", unit, err)
+	}
+	if _, err = command.Stdout.Write(output); err != nil {
+		return -1, err
+	}
+	e.removeUnit(unit)
+
+	switch props["Result"] {
+	case "success":
+		return 0, nil
+	case "exit-code":
+		exitCode, err := strconv.Atoi(props["ExecMainStatus"])
+		if err != nil {
+			return -1, fmt.Errorf("parsing exit code of unit %s: %w", unit, err)
+		}
+		return exitCode, fmt.Errorf("unit %s exited with code %d", unit, exitCode)
+	default:
+		return -1, fmt.Errorf("unit %s failed with result %s", unit, props["Result"])
+	}
+}
+
+// unitProperties returns the systemd-run arguments applying the credentials and limits of the command.
+func unitProperties(command *Command) []string {
+	var args []string
+	if command.User != "" {
+		args = append(args, "--uid", command.User)
+	}
+	if command.Group != "" {
+		args = append(args, "--gid", command.Group)
+	}
+	if command.CPUQuota != "" {
+		args = append(args, "--property", "CPUQuota="+command.CPUQuota)
+	}
+	if command.MemoryMax != "" {
+		args = append(args, "--property", "MemoryMax="+command.MemoryMax)
+	}
+	if command.NoNewPrivileges {
+		args = append(args, "--property", "NoNewPrivileges=yes")
+	}
+	if command.Rootfs != "" {
+		args = append(args, "--property", "RootDirectory="+command.Rootfs, "--property", "MountAPIVFS=yes")
+		for _, mount := range rootfsMounts(command) {
+			if mount.Source == "/proc" || mount.Source == "/sys" || mount.Source == "/dev" {
+				// mounted by MountAPIVFS
+				continue
+			}
+			property := "BindPaths="
+			if mount.ReadOnly {
+				property = "BindReadOnlyPaths="
+			}
+			source := mount.Source
+			if mount.optional {
+				source = "-" + source
+			}
+			args = append(args, "--property", property+source+":"+mount.Target)
+		}
+	}
+	return args
+}
+
+// unitName returns the name of the transient unit of the command, it is the same for every attempt of an instruction.
+func unitName(command *Command) string {
+	name := unitNameInvalidChars.ReplaceAllString(command.Instruction, "-")
+	if name == "" {
+		name = "instruction"
+	}
+	sum := sha256.Sum256([]byte(command.Name))
+	return fmt.Sprintf("llmos-%s-%x.service", name, sum[:6])
+}
+
+// writeEnvFile writes the env to a systemd environment file readable by root only, the values are quoted.
+func writeEnvFile(path string, env []string) error {
+	var buf bytes.Buffer
+	for _, e := range env {
+		key, value, ok := strings.Cut(e, "=")
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&buf, "%s=\"%s\"\n", key, envFileEscaper.Replace(value))
+	}
+	// a file left by a killed applyinator might have other permissions, they are only set when it is created
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0600)
+}
+
+var envFileEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`", `$`, `\$`)
+
+// commandStderr returns the stderr of the failed command for error messages.
+func commandStderr(err error) string {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+		return ": " + strings.TrimSpace(string(exitErr.Stderr))
+	}
+	return ""
+}
+
+func (e *systemdExecutor) showUnit(unit string) (map[string]string, error) {
+	output, err := e.run("systemctl", "show", unit,
+		"--property", "ActiveState,SubState,Result,ExecMainStatus,InvocationID")
+	if err != nil {
+		return nil, fmt.Errorf("reading state of unit %s: %w", unit, err)
+	}
+	props := map[string]string{}
+	for _, line := range strings.Split(string(output), "\n") {
+		if k, v, ok := strings.Cut(line, "="); ok {
+			props[k] = v
+		}
+	}
+	return props, nil
+}
+
+func unitRunning(props map[string]string) bool {
+	switch props["ActiveState"] {
+	case "activating", "deactivating", "reloading":
+		return true
+	case "active":
+		return props["SubState"] == "running"
+	}
+	return false
+}
+
+func unitFinished(props map[string]string) bool {
+	return props["ActiveState"] == "failed" || (props["ActiveState"] == "active" && props["SubState"] == "exited")
+}
+
+func (e *systemdExecutor) removeUnit(unit string) {
+	_, _ = e.run("systemctl", "stop", unit)
+	_, _ = e.run("systemctl", "reset-failed", unit)
+}
@@ -0,0 +1,162 @@
+package applyinator_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"golang.org/x/sys/unix"
+
+	"github.com/llmos-ai/llmos/pkg/applyinator"
+)
+
+var _ = Describe("instruction executors", Label("applyinator", "executor"), func() {
+	var (
+		fake *applyinator.FakeExecutor
+		a    *applyinator.Applyinator
+	)
+
+	var workDir string
+
+	BeforeEach(func() {
+		fake = applyinator.NewFakeExecutor()
+		workDir = filepath.Join(GinkgoT().TempDir(), "work")
+		a = applyinator.NewApplyinator(workDir, false, "", "", nil)
+		a.RegisterExecutor("fake", fake)
+	})
+
+	apply := func(plan applyinator.Plan) (applyinator.ApplyOutput, error) {
+		raw, err := json.Marshal(plan)
+		Expect(err).NotTo(HaveOccurred())
+		calculated, err := applyinator.CalculatePlan(raw)
+		Expect(err).NotTo(HaveOccurred())
+		return a.Apply(context.Background(), applyinator.ApplyInput{
+			CalculatedPlan:         calculated,
+			RunOneTimeInstructions: true,
+		})
+	}
+
+	It("runs the instructions with the executor of the plan", func() {
+		fake.SetResult("install", applyinator.FakeResult{Stdout: "installed\n"})
+		first := instruction("install", "ignored")
+		first.SaveOutput = true
+
+		output, err := apply(applyinator.Plan{
+			Executor:            "fake",
+			OneTimeInstructions: []applyinator.OneTimeInstruction{first, instruction("configure", "ignored")},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output.OneTimeApplySucceeded).To(BeTrue())
+
+		commands := fake.Commands()
+		Expect(commands).To(HaveLen(2))
+		Expect(commands[0].Instruction).To(Equal("install"))
+		Expect(commands[0].Path).To(Equal("/bin/sh"))
+		Expect(commands[0].Args).To(Equal([]string{"-c", "ignored"}))
+		Expect(commands[0].Env).To(ContainElement(HavePrefix("CATTLE_AGENT_ATTEMPT_NUMBER=")))
+		Expect(commands[1].Instruction).To(Equal("configure"))
+	})
+
+	It("lets instructions select their own executor", func() {
+		local := instruction("local", "true")
+		local.Executor = applyinator.ExecutorLocal
+		fake.SetResult("failing", applyinator.FakeResult{ExitCode: 2})
+
+		output, err := apply(applyinator.Plan{
+			Executor:            "fake",
+			OneTimeInstructions: []applyinator.OneTimeInstruction{local, instruction("failing", "true")},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output.OneTimeApplySucceeded).To(BeFalse())
+
+		commands := fake.Commands()
+		Expect(commands).To(HaveLen(1))
+		Expect(commands[0].Instruction).To(Equal("failing"))
+	})
+
+	It("rejects unknown executors", func() {
+		_, err := apply(applyinator.Plan{Executor: "missing"})
+		Expect(err).To(MatchError(ContainSubstring("unknown executor missing")))
+	})
+
+	It("passes the env of systemd units in a file readable by root only", func() {
+		GinkgoT().Setenv("LLMOS_HOST_SECRET", "h0st-secret")
+		runner := applyinator.NewFakeCommandRunner()
+		runner.Handle("systemctl", func([]string) ([]byte, error) {
+			return []byte("ActiveState=active\nSubState=exited\nResult=success\nExecMainStatus=0\nInvocationID=1\n"), nil
+		})
+		var (
+			envFile    string
+			envContent []byte
+			envMode    os.FileMode
+		)
+		runner.Handle("systemd-run", func(args []string) ([]byte, error) {
+			for _, arg := range args {
+				if file, ok := strings.CutPrefix(arg, "EnvironmentFile="); ok {
+					envFile = file
+				}
+			}
+			info, err := os.Stat(envFile)
+			if err != nil {
+				return nil, err
+			}
+			envMode = info.Mode().Perm()
+			envContent, err = os.ReadFile(envFile)
+			return nil, err
+		})
+		a = applyinator.NewApplyinator(workDir, true, "", "", nil)
+		a.RegisterExecutor(applyinator.ExecutorSystemd, applyinator.NewSystemdExecutor(runner.Run, time.Millisecond))
+
+		install := instruction("install", `echo "$K3S_TOKEN"`)
+		install.Env = []string{"K3S_TOKEN=s3cr3t-token", `INSTALL_K3S_EXEC=server --node-label "a=$b"`}
+		install.SensitiveEnv = []string{"K3S_TOKEN"}
+		output, err := apply(applyinator.Plan{
+			Executor:            applyinator.ExecutorSystemd,
+			OneTimeInstructions: []applyinator.OneTimeInstruction{install},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output.OneTimeApplySucceeded).To(BeTrue())
+
+		commands := runner.Commands()
+		Expect(commands).To(ContainElement(ContainElements("systemd-run", "EnvironmentFile="+envFile)))
+		for _, command := range commands {
+			for _, arg := range command {
+				Expect(arg).NotTo(ContainSubstring("s3cr3t-token"))
+				Expect(arg).NotTo(ContainSubstring("h0st-secret"))
+			}
+		}
+		Expect(envMode).To(Equal(os.FileMode(0600)))
+		Expect(string(envContent)).To(ContainSubstring("K3S_TOKEN=\"s3cr3t-token\"\n"))
+		Expect(string(envContent)).To(ContainSubstring(`INSTALL_K3S_EXEC="server --node-label \"a=\$b\""`))
+		Expect(string(envContent)).NotTo(ContainSubstring("h0st-secret"))
+		Expect(envFile).NotTo(BeAnExistingFile())
+	})
+
+	It("never removes the host files mounted into the work directory", func() {
+		if runtime.GOOS != "linux" || os.Geteuid() != 0 {
+			Skip("mounting requires root on linux")
+		}
+		host := GinkgoT().TempDir()
+		Expect(os.WriteFile(filepath.Join(host, "data"), []byte("keep"), 0o600)).To(Succeed())
+		// a mount left by a command whose llmos was killed
+		target := filepath.Join(workDir, "rootfs", "var", "lib", "llmos")
+		Expect(os.MkdirAll(target, 0o755)).To(Succeed())
+		if err := unix.Mount(host, target, "", unix.MS_BIND, ""); err != nil {
+			Skip("bind mounts are not permitted: " + err.Error())
+		}
+		DeferCleanup(func() { _ = unix.Unmount(target, unix.MNT_DETACH) })
+
+		_, err := apply(applyinator.Plan{Executor: "fake", OneTimeInstructions: []applyinator.OneTimeInstruction{
+			instruction("install", "ignored"),
+		}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filepath.Join(workDir, "rootfs")).NotTo(BeAnExistingFile())
+		Expect(os.ReadFile(filepath.Join(host, "data"))).To(Equal([]byte("keep")))
+	})
+})
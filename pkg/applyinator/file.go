@@ -2,23 +2,21 @@ package applyinator
 
 import (
 	"bytes"
-	"encoding/base64"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
 
 	"github.com/sirupsen/logrus"
+
+	"github.com/llmos-ai/llmos/pkg/utils/atomicfile"
 )
 
 const defaultDirectoryPermissions os.FileMode = 0755
 const defaultFilePermissions os.FileMode = 0600
 
-func writeBase64ContentToFile(file File) error {
-	content, err := base64.StdEncoding.DecodeString(file.Content)
-	if err != nil {
-		return err
-	}
+// writeFile writes the resolved content of the plan file with its permissions and ownership.
+func writeFile(file File, content []byte) error {
 	var fileMode os.FileMode
 	if file.Permissions == "" {
 		logrus.Debugf("[Applyinator] Requested file permission for %s was %s, defaulting to %d",
@@ -31,7 +29,11 @@ func writeBase64ContentToFile(file File) error {
 		}
 		fileMode = parsedPerm
 	}
-	return writeContentToFile(file.Path, file.UID, file.GID, fileMode, content)
+	uid, gid, err := fileOwnership(file)
+	if err != nil {
+		return fmt.Errorf("resolving owner of %s: %w", file.Path, err)
+	}
+	return writeContentToFile(file.Path, uid, gid, fileMode, content)
 }
 
 func writeContentToFile(path string, uid int, gid int, perm os.FileMode, content []byte) error {
@@ -47,7 +49,7 @@ func writeContentToFile(path string, uid int, gid int, perm os.FileMode, content
 		if err := os.MkdirAll(dir, defaultDirectoryPermissions); err != nil {
 			return err
 		}
-		if err := os.WriteFile(path, content, perm); err != nil {
+		if err := atomicfile.WriteFile(path, content, perm); err != nil {
 			return err
 		}
 	}
@@ -71,11 +73,15 @@ func CreateDirectory(file File) error {
 		fileMode = parsedPerm
 	}
 
+	uid, gid, err := fileOwnership(file)
+	if err != nil {
+		return fmt.Errorf("resolving owner of %s: %w", file.Path, err)
+	}
 	if err := os.MkdirAll(file.Path, fileMode); err != nil {
 		return err
 	}
 
-	return reconcileFilePermissions(file.Path, file.UID, file.GID, fileMode)
+	return reconcileFilePermissions(file.Path, uid, gid, fileMode)
 }
 
 func parsePerm(perm string) (os.FileMode, error) {
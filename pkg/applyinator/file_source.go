@@ -0,0 +1,251 @@
+package applyinator
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	FileEncodingBase64     = "base64"
+	FileEncodingPlain      = "plain"
+	FileEncodingGzipBase64 = "gzip+base64"
+)
+
+// fileFetchTimeout bounds the download of a file source URL.
+const fileFetchTimeout = 5 * time.Minute
+
+// DecodeContent returns the inline content of the file decoded with its encoding, base64 by default.
+func DecodeContent(file File) ([]byte, error) {
+	switch file.Encoding {
+	case "", FileEncodingBase64:
+		return base64.StdEncoding.DecodeString(file.Content)
+	case FileEncodingPlain:
+		return []byte(file.Content), nil
+	case FileEncodingGzipBase64:
+		compressed, err := base64.StdEncoding.DecodeString(file.Content)
+		if err != nil {
+			return nil, err
+		}
+		gz, err := gzip.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		return io.ReadAll(gz)
+	default:
+		return nil, fmt.Errorf("unknown encoding %s", file.Encoding)
+	}
+}
+
+// isURLSource returns whether the source of the file is downloaded instead of read from an image.
+func isURLSource(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// validateFile checks the state, content, source, checksum, template and ownership settings of the file.
+func validateFile(file File) error {
+	if file.Path == "" {
+		return fmt.Errorf("path is required")
+	}
+	switch file.State {
+	case "", FileStatePresent:
+	case FileStateAbsent:
+		if file.Content != "" || file.Source != "" || file.Symlink != "" {
+			return fmt.Errorf("an absent file can't have content, a source or a symlink target")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown state %s, supported: %s, %s", file.State, FileStatePresent, FileStateAbsent)
+	}
+	if file.Directory {
+		if file.Content != "" || file.Source != "" || file.Template || file.Symlink != "" {
+			return fmt.Errorf("a directory can't have content, a source, a symlink target or be a template")
+		}
+	}
+	if file.Symlink != "" && (file.Content != "" || file.Source != "" || file.Template) {
+		return fmt.Errorf("a symlink can't have content, a source or be a template")
+	}
+
+	switch file.Encoding {
+	case "", FileEncodingBase64, FileEncodingPlain, FileEncodingGzipBase64:
+	default:
+		return fmt.Errorf("unknown encoding %s, supported: %s, %s, %s",
+			file.Encoding, FileEncodingBase64, FileEncodingPlain, FileEncodingGzipBase64)
+	}
+
+	switch {
+	case file.Source != "" && file.Content != "":
+		return fmt.Errorf("only one of content and source can be set")
+	case file.Source != "" && file.Encoding != "":
+		return fmt.Errorf("encoding only applies to the inline content")
+	case isURLSource(file.Source):
+		if _, err := url.ParseRequestURI(file.Source); err != nil {
+			return fmt.Errorf("invalid source URL: %w", err)
+		}
+		if file.Image != "" {
+			return fmt.Errorf("image can't be set for a source URL")
+		}
+	case file.Source != "":
+		if strings.Contains(file.Source, "://") {
+			return fmt.Errorf("unsupported source %s, only http and https URLs are supported", file.Source)
+		}
+		if file.Image == "" || !filepath.IsAbs(file.Source) {
+			return fmt.Errorf("source %s must be an absolute path inside the image", file.Source)
+		}
+	case file.Image != "":
+		return fmt.Errorf("image requires a source path inside the image")
+	}
+
+	if file.SHA256 != "" {
+		if sum, err := hex.DecodeString(file.SHA256); err != nil || len(sum) != sha256.Size {
+			return fmt.Errorf("sha256 must be a hex encoded SHA-256 checksum")
+		}
+	}
+
+	if file.Template && file.Source == "" {
+		content, err := DecodeContent(file)
+		if err != nil {
+			return fmt.Errorf("decoding content: %w", err)
+		}
+		if _, err = template.New(file.Path).Parse(string(content)); err != nil {
+			return fmt.Errorf("invalid template: %w", err)
+		}
+	}
+
+	if file.Owner != "" && file.UID != 0 {
+		return fmt.Errorf("only one of owner and uid can be set")
+	}
+	if file.Group != "" && file.GID != 0 {
+		return fmt.Errorf("only one of group and gid can be set")
+	}
+	return nil
+}
+
+// fileContent returns the content the file is written with. The content is read from the source or decoded from
+// the inline content, verified against the checksum and rendered with the facts if the file is a template.
+func (a *Applyinator) fileContent(ctx context.Context, file File, facts Facts) ([]byte, error) {
+	var (
+		content []byte
+		err     error
+	)
+	switch {
+	case isURLSource(file.Source):
+		content, err = fetchURL(ctx, file.Source)
+	case file.Source != "":
+		content, err = a.readFromImage(file.Image, file.Source)
+	default:
+		content, err = DecodeContent(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if file.SHA256 != "" {
+		sum := sha256.Sum256(content)
+		if actual := hex.EncodeToString(sum[:]); !strings.EqualFold(actual, file.SHA256) {
+			return nil, fmt.Errorf("sha256 checksum mismatch, expected %s but got %s", file.SHA256, actual)
+		}
+	}
+
+	if !file.Template {
+		return content, nil
+	}
+	tmpl, err := template.New(file.Path).Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		return nil, err
+	}
+	var rendered bytes.Buffer
+	if err = tmpl.Execute(&rendered, map[string]interface{}(facts)); err != nil {
+		return nil, fmt.Errorf("rendering template: %w", err)
+	}
+	return rendered.Bytes(), nil
+}
+
+func fetchURL(ctx context.Context, source string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, fileFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading %s: unexpected status %s", source, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// readFromImage stages the image to a temporary directory and reads the file at the path inside of it.
+func (a *Applyinator) readFromImage(image, path string) ([]byte, error) {
+	if a.imageUtil == nil {
+		return nil, fmt.Errorf("no image utility is configured to stage image %s", image)
+	}
+	dir, err := os.MkdirTemp("", "llmos-file-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	if err = a.imageUtil.Stage(dir, image); err != nil {
+		return nil, fmt.Errorf("staging image %s: %w", image, err)
+	}
+	// the path must not escape the staged image through a symlink
+	resolved, err := filepath.EvalSymlinks(filepath.Join(dir, path))
+	if err != nil {
+		return nil, err
+	}
+	if rel, err := filepath.Rel(dir, resolved); err != nil || strings.HasPrefix(rel, "..") {
+		return nil, fmt.Errorf("path %s escapes image %s", path, image)
+	}
+	return os.ReadFile(resolved)
+}
+
+// fileOwnership returns the uid and gid the file is owned by, resolving the owner and group names.
+func fileOwnership(file File) (int, int, error) {
+	uid, gid := file.UID, file.GID
+	if file.Owner != "" {
+		u, err := user.Lookup(file.Owner)
+		if err != nil {
+			return 0, 0, err
+		}
+		if uid, err = strconv.Atoi(u.Uid); err != nil {
+			return 0, 0, fmt.Errorf("parsing uid of user %s: %w", file.Owner, err)
+		}
+		// the primary group of the owner is used unless a group is set
+		if file.Group == "" && file.GID == 0 {
+			if gid, err = strconv.Atoi(u.Gid); err != nil {
+				return 0, 0, fmt.Errorf("parsing gid of user %s: %w", file.Owner, err)
+			}
+		}
+	}
+	if file.Group != "" {
+		g, err := user.LookupGroup(file.Group)
+		if err != nil {
+			return 0, 0, err
+		}
+		if gid, err = strconv.Atoi(g.Gid); err != nil {
+			return 0, 0, fmt.Errorf("parsing gid of group %s: %w", file.Group, err)
+		}
+	}
+	return uid, gid, nil
+}
@@ -0,0 +1,142 @@
+package applyinator_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/llmos-ai/llmos/pkg/applyinator"
+)
+
+var _ = Describe("file sources", Label("applyinator", "file"), func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+	})
+
+	calculateFiles := func(files ...applyinator.File) (applyinator.CalculatedPlan, error) {
+		raw, err := json.Marshal(applyinator.Plan{Files: files})
+		Expect(err).NotTo(HaveOccurred())
+		return applyinator.CalculatePlan(raw)
+	}
+
+	applyFiles := func(files ...applyinator.File) error {
+		plan, err := calculateFiles(files...)
+		Expect(err).NotTo(HaveOccurred())
+		a := applyinator.NewApplyinator(filepath.Join(dir, "work"), false, "", "", nil)
+		_, err = a.Apply(context.Background(), applyinator.ApplyInput{
+			CalculatedPlan: plan,
+			ReconcileFiles: true,
+			Facts:          applyinator.Facts{"nodeName": "node-1"},
+		})
+		return err
+	}
+
+	sum := func(content string) string {
+		s := sha256.Sum256([]byte(content))
+		return hex.EncodeToString(s[:])
+	}
+
+	It("decodes plain and gzipped content and renders templates with the node facts", func() {
+		var compressed bytes.Buffer
+		gz := gzip.NewWriter(&compressed)
+		_, err := gz.Write([]byte("compressed\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(gz.Close()).To(Succeed())
+
+		Expect(applyFiles(
+			applyinator.File{Path: filepath.Join(dir, "plain"), Encoding: applyinator.FileEncodingPlain, Content: "plain\n"},
+			applyinator.File{Path: filepath.Join(dir, "gzip"), Encoding: applyinator.FileEncodingGzipBase64,
+				Content: base64.StdEncoding.EncodeToString(compressed.Bytes())},
+			applyinator.File{Path: filepath.Join(dir, "template"), Encoding: applyinator.FileEncodingPlain,
+				Content: "node-name: {{ .nodeName }}\n", Template: true, SHA256: sum("node-name: {{ .nodeName }}\n")},
+		)).To(Succeed())
+
+		Expect(os.ReadFile(filepath.Join(dir, "plain"))).To(Equal([]byte("plain\n")))
+		Expect(os.ReadFile(filepath.Join(dir, "gzip"))).To(Equal([]byte("compressed\n")))
+		Expect(os.ReadFile(filepath.Join(dir, "template"))).To(Equal([]byte("node-name: node-1\n")))
+	})
+
+	It("downloads the content from a URL and verifies its checksum", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte("artifact"))
+		}))
+		defer server.Close()
+
+		Expect(applyFiles(applyinator.File{
+			Path: filepath.Join(dir, "artifact"), Source: server.URL, SHA256: sum("artifact"), Owner: "root",
+		})).To(Succeed())
+		Expect(os.ReadFile(filepath.Join(dir, "artifact"))).To(Equal([]byte("artifact")))
+
+		err := applyFiles(applyinator.File{Path: filepath.Join(dir, "other"), Source: server.URL, SHA256: sum("other")})
+		Expect(err).To(MatchError(ContainSubstring("sha256 checksum mismatch")))
+		Expect(filepath.Join(dir, "other")).NotTo(BeAnExistingFile())
+	})
+
+	It("owns the files and directories by the named owner and group", func() {
+		if os.Geteuid() != 0 {
+			Skip("changing the owner requires root")
+		}
+		nobody, err := user.Lookup("nobody")
+		if err != nil {
+			Skip("the nobody user does not exist")
+		}
+		root, err := user.LookupGroupId("0")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(applyFiles(
+			applyinator.File{Path: filepath.Join(dir, "file"), Encoding: applyinator.FileEncodingPlain, Content: "a",
+				Owner: "nobody", Group: root.Name},
+			applyinator.File{Path: filepath.Join(dir, "directory"), Directory: true, Owner: "nobody"},
+			applyinator.File{Path: filepath.Join(dir, "group"), Directory: true, Group: root.Name},
+		)).To(Succeed())
+
+		owner := func(path string) (string, string) {
+			info, err := os.Stat(path)
+			Expect(err).NotTo(HaveOccurred())
+			stat := info.Sys().(*syscall.Stat_t)
+			return strconv.Itoa(int(stat.Uid)), strconv.Itoa(int(stat.Gid))
+		}
+		uid, gid := owner(filepath.Join(dir, "file"))
+		Expect([]string{uid, gid}).To(Equal([]string{nobody.Uid, "0"}))
+		// the primary group of the owner is used unless a group is set
+		uid, gid = owner(filepath.Join(dir, "directory"))
+		Expect([]string{uid, gid}).To(Equal([]string{nobody.Uid, nobody.Gid}))
+		uid, gid = owner(filepath.Join(dir, "group"))
+		Expect([]string{uid, gid}).To(Equal([]string{"0", "0"}))
+
+		err = applyFiles(applyinator.File{Path: filepath.Join(dir, "unknown"), Directory: true, Owner: "missing-user"})
+		Expect(err).To(MatchError(ContainSubstring("resolving owner of")))
+	})
+
+	DescribeTable("rejects invalid files",
+		func(file applyinator.File, message string) {
+			file.Path = "/etc/llmos/file"
+			_, err := calculateFiles(file)
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		},
+		Entry("unknown encoding", applyinator.File{Encoding: "hex"}, "unknown encoding hex"),
+		Entry("content and source", applyinator.File{Content: "YQ==", Source: "https://example.com/a"}, "only one of content and source"),
+		Entry("relative image path", applyinator.File{Source: "bin/tool", Image: "busybox"}, "absolute path inside the image"),
+		Entry("image path without image", applyinator.File{Source: "/bin/tool"}, "absolute path inside the image"),
+		Entry("unsupported scheme", applyinator.File{Source: "ftp://example.com/a"}, "unsupported source"),
+		Entry("invalid checksum", applyinator.File{Content: "YQ==", SHA256: "abc"}, "hex encoded SHA-256"),
+		Entry("invalid template", applyinator.File{Encoding: "plain", Content: "{{ .a", Template: true}, "invalid template"),
+		Entry("owner and uid", applyinator.File{Owner: "root", UID: 1}, "only one of owner and uid"),
+	)
+})
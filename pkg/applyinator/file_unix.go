@@ -5,6 +5,7 @@ package applyinator
 
 import (
 	"os"
+	"syscall"
 
 	"github.com/sirupsen/logrus"
 )
@@ -17,3 +18,11 @@ func reconcileFilePermissions(path string, uid int, gid int, perm os.FileMode) e
 	}
 	return os.Chown(path, uid, gid)
 }
+
+// fileOwner returns the uid and gid of the file.
+func fileOwner(info os.FileInfo) (int, int) {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return int(stat.Uid), int(stat.Gid)
+	}
+	return 0, 0
+}
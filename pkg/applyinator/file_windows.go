@@ -14,3 +14,8 @@ func reconcileFilePermissions(path string, uid int, gid int, perm os.FileMode) e
 	logrus.Debugf("windows file permissions for %s will not be reconciled to %d:%d %d", path, uid, gid, perm)
 	return nil
 }
+
+// fileOwner returns no owner on Windows, file ownership is not reconciled.
+func fileOwner(_ os.FileInfo) (int, int) {
+	return 0, 0
+}
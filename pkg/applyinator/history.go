@@ -0,0 +1,152 @@
+package applyinator
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/llmos-ai/llmos/pkg/utils/crypt"
+)
+
+// AppliedPlan is a plan recorded in the applied plan history.
+type AppliedPlan struct {
+	// Name is the name of the history file, its time stamp identifies the plan in the history
+	Name    string
+	Applied time.Time
+	CalculatedPlan
+	// Signed holds the signed contents the plan was calculated from, the history records them for signed plans only
+	Signed []SignedContent
+	// Unredacted is the plan with its sensitive values, the history records it for unsigned plans if it is encrypted
+	Unredacted *Plan
+}
+
+// SignedContent is a plan as it was signed, with its detached signature.
+type SignedContent struct {
+	Content   []byte `json:"content"`
+	Signature []byte `json:"signature"`
+}
+
+// Original returns the plan calculated again from its signed contents or its unredacted record, with the sensitive
+// values the history redacts. The signatures are verified when the plan is applied by an applyinator enforcing them.
+func (p AppliedPlan) Original() (CalculatedPlan, error) {
+	if len(p.Signed) == 0 {
+		if p.Unredacted == nil {
+			return CalculatedPlan{}, fmt.Errorf("the history does not record the sensitive values of plan %s", p.Checksum)
+		}
+		raw, err := json.Marshal(p.Unredacted)
+		if err != nil {
+			return CalculatedPlan{}, err
+		}
+		original, err := CalculatePlan(raw)
+		if err != nil {
+			return original, err
+		}
+		if original.Checksum != p.Checksum {
+			return original, fmt.Errorf("the unredacted plan %s has checksum %s", p.Checksum, original.Checksum)
+		}
+		return original, nil
+	}
+
+	parts := make([]CalculatedPlan, 0, len(p.Signed))
+	for _, signed := range p.Signed {
+		raw := signed.Content
+		if !json.Valid(raw) {
+			var err error
+			if raw, err = yaml.YAMLToJSON(signed.Content); err != nil {
+				return CalculatedPlan{}, err
+			}
+		}
+		cp, err := CalculatePlan(raw)
+		if err != nil {
+			return cp, err
+		}
+		cp.signed = []signedContent{{content: signed.Content, signature: signed.Signature}}
+		parts = append(parts, cp)
+	}
+	original, err := MergePlans(parts...)
+	if err != nil {
+		return original, err
+	}
+	if original.Checksum != p.Checksum {
+		return original, fmt.Errorf("the signed content of plan %s has checksum %s", p.Checksum, original.Checksum)
+	}
+	original.SignedBy = p.SignedBy
+	return original, nil
+}
+
+// Timestamp returns the time stamp of the history file, e.g. 20240102-150405.
+func (p AppliedPlan) Timestamp() string {
+	return strings.TrimSuffix(p.Name, appliedPlanFileSuffix)
+}
+
+// ReadAppliedPlans returns the plans recorded in the applied plan history directory, the most recent first.
+// Encrypted history files are decrypted transparently.
+func ReadAppliedPlans(appliedPlanDir string) ([]AppliedPlan, error) {
+	entries, err := os.ReadDir(appliedPlanDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var plans []AppliedPlan
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), appliedPlanFileSuffix) {
+			continue
+		}
+		plan, err := ReadAppliedPlan(appliedPlanDir, strings.TrimSuffix(entry.Name(), appliedPlanFileSuffix))
+		if err != nil {
+			return nil, err
+		}
+		plans = append(plans, plan)
+	}
+	sort.Slice(plans, func(i, j int) bool {
+		return plans[i].Name > plans[j].Name
+	})
+	return plans, nil
+}
+
+// ReadAppliedPlan returns the plan recorded in the applied plan history with the time stamp.
+func ReadAppliedPlan(appliedPlanDir, timestamp string) (AppliedPlan, error) {
+	name := timestamp + appliedPlanFileSuffix
+	plan := AppliedPlan{Name: name}
+	applied, err := time.ParseInLocation(applyinatorDateCodeLayout, timestamp, time.Local)
+	if err != nil {
+		return plan, fmt.Errorf("invalid applied plan time stamp %s: %w", timestamp, err)
+	}
+	plan.Applied = applied
+
+	content, err := crypt.ReadFile(filepath.Join(appliedPlanDir, name))
+	if err != nil {
+		return plan, err
+	}
+	if err = json.Unmarshal(content, &plan.CalculatedPlan); err != nil {
+		return plan, fmt.Errorf("decoding applied plan %s: %w", name, err)
+	}
+
+	content, err = crypt.ReadFile(filepath.Join(appliedPlanDir, timestamp+signedPlanFileSuffix))
+	if err == nil {
+		if err = json.Unmarshal(content, &plan.Signed); err != nil {
+			return plan, fmt.Errorf("decoding the signed content of applied plan %s: %w", name, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return plan, err
+	}
+
+	content, err = crypt.ReadFile(filepath.Join(appliedPlanDir, timestamp+originalPlanFileSuffix))
+	if err == nil {
+		plan.Unredacted = &Plan{}
+		if err = json.Unmarshal(content, plan.Unredacted); err != nil {
+			return plan, fmt.Errorf("decoding the unredacted applied plan %s: %w", name, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return plan, err
+	}
+	return plan, nil
+}
@@ -0,0 +1,120 @@
+package applyinator_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/llmos-ai/llmos/pkg/applyinator"
+	"github.com/llmos-ai/llmos/pkg/utils/crypt"
+)
+
+var _ = Describe("applied plan history", Label("applyinator", "history"), func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+	})
+
+	It("reads the redacted applied plans, the most recent first", func() {
+		a := applyinator.NewApplyinator(filepath.Join(dir, "work"), false, filepath.Join(dir, "applied"), "", nil)
+		raw, err := json.Marshal(applyinator.Plan{
+			OneTimeInstructions: []applyinator.OneTimeInstruction{{
+				CommonInstruction: applyinator.CommonInstruction{
+					Name:         "install",
+					Command:      "/bin/true",
+					Env:          []string{"TOKEN=secret"},
+					SensitiveEnv: []string{"TOKEN"},
+				},
+			}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		plan, err := applyinator.CalculatePlan(raw)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = a.Apply(context.Background(), applyinator.ApplyInput{CalculatedPlan: plan})
+		Expect(err).NotTo(HaveOccurred())
+
+		// an older plan recorded before
+		older, err := json.Marshal(applyinator.CalculatedPlan{Checksum: "older"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.WriteFile(filepath.Join(dir, "applied", "20000101-000000-applied.plan"), older, 0600)).To(Succeed())
+
+		applied, err := applyinator.ReadAppliedPlans(filepath.Join(dir, "applied"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(applied).To(HaveLen(2))
+		Expect(applied[0].Checksum).To(Equal(plan.Checksum))
+		Expect(applied[0].Plan.Redacted).To(BeTrue())
+		Expect(applied[0].Plan.OneTimeInstructions[0].Env).To(Equal([]string{"TOKEN=" + applyinator.Redacted}))
+		Expect(applied[1].Checksum).To(Equal("older"))
+		Expect(applied[1].Timestamp()).To(Equal("20000101-000000"))
+		Expect(applied[1].Applied.Year()).To(Equal(2000))
+
+		recorded, err := applyinator.ReadAppliedPlan(filepath.Join(dir, "applied"), applied[0].Timestamp())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorded.Checksum).To(Equal(plan.Checksum))
+	})
+
+	It("keeps the unredacted unsigned plans if the history is encrypted", func() {
+		cipher, err := crypt.Open(&crypt.Config{Enabled: true, KeyFile: filepath.Join(dir, "encryption.key")})
+		Expect(err).NotTo(HaveOccurred())
+		raw, err := json.Marshal(applyinator.Plan{
+			OneTimeInstructions: []applyinator.OneTimeInstruction{{
+				CommonInstruction: applyinator.CommonInstruction{
+					Name:         "install",
+					Command:      "/bin/true",
+					Env:          []string{"TOKEN=secret"},
+					SensitiveEnv: []string{"TOKEN"},
+				},
+			}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		plan, err := applyinator.CalculatePlan(raw)
+		Expect(err).NotTo(HaveOccurred())
+
+		apply := func(cipher *crypt.Cipher) applyinator.AppliedPlan {
+			appliedDir := GinkgoT().TempDir()
+			a := applyinator.NewApplyinator(filepath.Join(dir, "work"), false, appliedDir, "", nil)
+			a.SetCipher(cipher)
+			_, err := a.Apply(context.Background(), applyinator.ApplyInput{CalculatedPlan: plan})
+			Expect(err).NotTo(HaveOccurred())
+			applied, err := applyinator.ReadAppliedPlans(appliedDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(applied).To(HaveLen(1))
+
+			files, err := filepath.Glob(filepath.Join(appliedDir, "*"))
+			Expect(err).NotTo(HaveOccurred())
+			for _, file := range files {
+				content, err := os.ReadFile(file)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(content)).NotTo(ContainSubstring("secret"))
+			}
+			return applied[0]
+		}
+
+		encrypted := apply(cipher)
+		Expect(encrypted.Plan.OneTimeInstructions[0].Env).To(Equal([]string{"TOKEN=" + applyinator.Redacted}))
+		Expect(encrypted.Unredacted).NotTo(BeNil())
+		original, err := encrypted.Original()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(original.Checksum).To(Equal(plan.Checksum))
+		Expect(original.Plan.OneTimeInstructions[0].Env).To(Equal([]string{"TOKEN=secret"}))
+
+		plain := apply(nil)
+		Expect(plain.Unredacted).To(BeNil())
+		_, err = plain.Original()
+		Expect(err).To(MatchError(ContainSubstring("does not record the sensitive values")))
+	})
+
+	It("returns no plans without a history", func() {
+		Expect(applyinator.ReadAppliedPlans(filepath.Join(dir, "missing"))).To(BeEmpty())
+	})
+
+	It("rejects an invalid time stamp", func() {
+		_, err := applyinator.ReadAppliedPlan(dir, "yesterday")
+		Expect(err).To(MatchError(ContainSubstring("invalid applied plan time stamp")))
+	})
+})
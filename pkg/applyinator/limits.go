@@ -0,0 +1,95 @@
+package applyinator
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cpuPeriod is the cgroup cpu.max period in microseconds a CPUQuota is applied to.
+const cpuPeriod = 100000
+
+// hasLimits returns true if the command asks for resource limits.
+func (c *Command) hasLimits() bool {
+	return c.CPUQuota != "" || c.MemoryMax != ""
+}
+
+// validateLimits checks the resource limits and privilege settings of the instruction.
+func validateLimits(instruction CommonInstruction) error {
+	if _, err := parseCPUQuota(instruction.CPUQuota); err != nil {
+		return err
+	}
+	if _, err := parseMemoryMax(instruction.MemoryMax); err != nil {
+		return err
+	}
+	if instruction.Group != "" && instruction.User == "" {
+		return fmt.Errorf("group %s requires a user", instruction.Group)
+	}
+	if instruction.Rootfs && instruction.Image == "" {
+		return fmt.Errorf("rootfs requires an image")
+	}
+	if len(instruction.BindMounts) > 0 && !instruction.Rootfs {
+		return fmt.Errorf("bindMounts require rootfs")
+	}
+	for _, mount := range instruction.BindMounts {
+		if !filepath.IsAbs(mount.Source) || (mount.Target != "" && !filepath.IsAbs(mount.Target)) {
+			return fmt.Errorf("bind mount %s:%s must use absolute paths", mount.Source, mount.Target)
+		}
+	}
+	return nil
+}
+
+// rootfsMounts returns the bind mounts of the rootfs of the command, including the default mounts.
+func rootfsMounts(command *Command) []BindMount {
+	mounts := []BindMount{
+		{Source: "/proc"},
+		{Source: "/sys"},
+		{Source: "/dev"},
+		{Source: "/etc/resolv.conf", ReadOnly: true, optional: true},
+	}
+	mounts = append(mounts, command.BindMounts...)
+	for i := range mounts {
+		if mounts[i].Target == "" {
+			mounts[i].Target = mounts[i].Source
+		}
+	}
+	return mounts
+}
+
+// parseCPUQuota parses a systemd style CPU quota, e.g. 50% for half a CPU or 200% for two CPUs,
+// into the cgroup cpu.max quota in microseconds per cpuPeriod. 0 is returned for no quota.
+func parseCPUQuota(quota string) (int64, error) {
+	if quota == "" {
+		return 0, nil
+	}
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(quota, "%"), 64)
+	if err != nil || !strings.HasSuffix(quota, "%") || percent <= 0 {
+		return 0, fmt.Errorf("invalid cpuQuota %s, must be a positive percentage such as 50%%", quota)
+	}
+	return int64(percent / 100 * cpuPeriod), nil
+}
+
+// parseMemoryMax parses a systemd style memory limit, e.g. 512M or 2G with 1024 based suffixes K, M, G and T,
+// into bytes. 0 is returned for no limit.
+func parseMemoryMax(memory string) (int64, error) {
+	if memory == "" || memory == "infinity" {
+		return 0, nil
+	}
+	multiplier := int64(1)
+	number := memory
+	if i := strings.IndexAny(memory, "KMGT"); i == len(memory)-1 {
+		number = memory[:i]
+		for _, suffix := range "KMGT" {
+			multiplier *= 1024
+			if byte(suffix) == memory[i] {
+				break
+			}
+		}
+	}
+	value, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid memoryMax %s, must be a positive number of bytes with an optional K, M, G or T suffix", memory)
+	}
+	return value * multiplier, nil
+}
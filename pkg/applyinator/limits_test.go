@@ -0,0 +1,46 @@
+package applyinator_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/llmos-ai/llmos/pkg/applyinator"
+)
+
+var _ = Describe("instruction limits", Label("applyinator", "limits"), func() {
+	limited := func(modify func(*applyinator.OneTimeInstruction)) error {
+		inst := instruction("a", "true")
+		modify(&inst)
+		_, err := calculate(inst)
+		return err
+	}
+
+	It("accepts systemd style limits", func() {
+		Expect(limited(func(i *applyinator.OneTimeInstruction) {
+			i.CPUQuota = "150%"
+			i.MemoryMax = "512M"
+		})).To(Succeed())
+	})
+
+	It("rejects invalid limits", func() {
+		Expect(limited(func(i *applyinator.OneTimeInstruction) { i.CPUQuota = "0.5" })).
+			To(MatchError(ContainSubstring("invalid cpuQuota 0.5")))
+		Expect(limited(func(i *applyinator.OneTimeInstruction) { i.MemoryMax = "12X" })).
+			To(MatchError(ContainSubstring("invalid memoryMax 12X")))
+		Expect(limited(func(i *applyinator.OneTimeInstruction) { i.Group = "nogroup" })).
+			To(MatchError(ContainSubstring("group nogroup requires a user")))
+	})
+
+	It("requires an image for rootfs instructions", func() {
+		Expect(limited(func(i *applyinator.OneTimeInstruction) { i.Rootfs = true })).
+			To(MatchError(ContainSubstring("rootfs requires an image")))
+		Expect(limited(func(i *applyinator.OneTimeInstruction) {
+			i.BindMounts = []applyinator.BindMount{{Source: "/etc/rancher"}}
+		})).To(MatchError(ContainSubstring("bindMounts require rootfs")))
+		Expect(limited(func(i *applyinator.OneTimeInstruction) {
+			i.Image = "installer"
+			i.Rootfs = true
+			i.BindMounts = []applyinator.BindMount{{Source: "/etc/rancher"}, {Source: "/var/lib/llmos", Target: "data"}}
+		})).To(MatchError(ContainSubstring("bind mount /var/lib/llmos:data must use absolute paths")))
+	})
+})
@@ -0,0 +1,98 @@
+package applyinator
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/llmos-ai/llmos/pkg/applyinator/prober"
+)
+
+// MergePlans merges the plans in order into a single plan, the way drop-in files override each other: a file,
+// instruction or probe of a later plan replaces the one with the same path or name of an earlier plan at its
+// position, the others are appended. The default executor of each plan is set on its instructions. The merged plan
+// is signed if all the plans are signed.
+func MergePlans(plans ...CalculatedPlan) (CalculatedPlan, error) {
+	if len(plans) == 1 {
+		return plans[0], nil
+	}
+
+	var (
+		merged   Plan
+		files    = map[string]int{}
+		oneTime  = map[string]int{}
+		periodic = map[string]int{}
+		signed   []signedContent
+		signers  = map[string]bool{}
+	)
+	for _, cp := range plans {
+		for _, file := range cp.Plan.Files {
+			if index, ok := files[file.Path]; ok {
+				merged.Files[index] = file
+				continue
+			}
+			files[file.Path] = len(merged.Files)
+			merged.Files = append(merged.Files, file)
+		}
+		for _, instruction := range cp.Plan.OneTimeInstructions {
+			instruction.CommonInstruction = withExecutor(instruction.CommonInstruction, cp.Plan.Executor)
+			if index, ok := oneTime[instruction.Name]; ok && instruction.Name != "" {
+				merged.OneTimeInstructions[index] = instruction
+				continue
+			}
+			oneTime[instruction.Name] = len(merged.OneTimeInstructions)
+			merged.OneTimeInstructions = append(merged.OneTimeInstructions, instruction)
+		}
+		for _, instruction := range cp.Plan.PeriodicInstructions {
+			instruction.CommonInstruction = withExecutor(instruction.CommonInstruction, cp.Plan.Executor)
+			if index, ok := periodic[instruction.Name]; ok && instruction.Name != "" {
+				merged.PeriodicInstructions[index] = instruction
+				continue
+			}
+			periodic[instruction.Name] = len(merged.PeriodicInstructions)
+			merged.PeriodicInstructions = append(merged.PeriodicInstructions, instruction)
+		}
+		for name, probe := range cp.Plan.Probes {
+			if merged.Probes == nil {
+				merged.Probes = map[string]prober.Probe{}
+			}
+			merged.Probes[name] = probe
+		}
+
+		signed = append(signed, cp.signed...)
+		for _, name := range strings.Split(cp.SignedBy, ",") {
+			if name != "" {
+				signers[name] = true
+			}
+		}
+	}
+
+	raw, err := json.Marshal(merged)
+	if err != nil {
+		return CalculatedPlan{}, err
+	}
+	cp, err := CalculatePlan(raw)
+	if err != nil {
+		return cp, fmt.Errorf("invalid merged plan: %w", err)
+	}
+	if allSigned(plans) {
+		names := make([]string, 0, len(signers))
+		for name := range signers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		cp.SignedBy = strings.Join(names, ",")
+		cp.signed = signed
+	}
+	return cp, nil
+}
+
+func allSigned(plans []CalculatedPlan) bool {
+	for _, cp := range plans {
+		if len(cp.signed) == 0 {
+			return false
+		}
+	}
+	return true
+}
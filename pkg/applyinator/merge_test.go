@@ -0,0 +1,112 @@
+package applyinator_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/llmos-ai/llmos/pkg/applyinator"
+	"github.com/llmos-ai/llmos/pkg/applyinator/prober"
+	"github.com/llmos-ai/llmos/pkg/utils/signature"
+)
+
+var _ = Describe("merged plans", Label("applyinator", "merge"), func() {
+	calculate := func(plan applyinator.Plan) applyinator.CalculatedPlan {
+		raw, err := json.Marshal(plan)
+		Expect(err).NotTo(HaveOccurred())
+		calculated, err := applyinator.CalculatePlan(raw)
+		Expect(err).NotTo(HaveOccurred())
+		return calculated
+	}
+
+	instruction := func(name, command string) applyinator.CommonInstruction {
+		return applyinator.CommonInstruction{Name: name, Command: command}
+	}
+
+	It("overrides the files, instructions and probes of the earlier plans", func() {
+		base := calculate(applyinator.Plan{
+			Files: []applyinator.File{
+				{Path: "/etc/sysctl.d/90-llmos.conf", Content: "dm0uc3dhcHBpbmVzcz0w"},
+				{Path: "/etc/modules-load.d/llmos.conf", Content: "YnJfbmV0ZmlsdGVy"},
+			},
+			OneTimeInstructions: []applyinator.OneTimeInstruction{
+				{CommonInstruction: instruction("sysctl", "sysctl")},
+				{CommonInstruction: instruction("modprobe", "modprobe")},
+			},
+			Probes: map[string]prober.Probe{
+				"kubelet": {TCPSocketAction: &prober.TCPSocketAction{Port: 10250}},
+			},
+		})
+		override := calculate(applyinator.Plan{
+			Executor: applyinator.ExecutorSystemd,
+			Files: []applyinator.File{
+				{Path: "/etc/sysctl.d/90-llmos.conf", Content: "dm0uc3dhcHBpbmVzcz0x"},
+			},
+			OneTimeInstructions: []applyinator.OneTimeInstruction{
+				{CommonInstruction: instruction("sysctl", "/usr/sbin/sysctl")},
+				{CommonInstruction: instruction("driver", "nvidia-smi")},
+			},
+			Probes: map[string]prober.Probe{
+				"driver": {FileExistsAction: &prober.FileExistsAction{Path: "/dev/nvidia0"}},
+			},
+		})
+
+		merged, err := applyinator.MergePlans(base, override)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(merged.Plan.Files).To(HaveLen(2))
+		Expect(merged.Plan.Files[0].Content).To(Equal("dm0uc3dhcHBpbmVzcz0x"))
+
+		var names, commands, executors []string
+		for _, instruction := range merged.Plan.OneTimeInstructions {
+			names = append(names, instruction.Name)
+			commands = append(commands, instruction.Command)
+			executors = append(executors, instruction.Executor)
+		}
+		Expect(names).To(Equal([]string{"sysctl", "modprobe", "driver"}))
+		Expect(commands).To(Equal([]string{"/usr/sbin/sysctl", "modprobe", "nvidia-smi"}))
+		Expect(executors).To(Equal([]string{applyinator.ExecutorSystemd, "", applyinator.ExecutorSystemd}))
+		Expect(merged.Plan.Probes).To(HaveKey("kubelet"))
+		Expect(merged.Plan.Probes).To(HaveKey("driver"))
+
+		single, err := applyinator.MergePlans(base)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(single.Checksum).To(Equal(base.Checksum))
+	})
+
+	It("is signed only if all the plans are signed", func() {
+		dir := GinkgoT().TempDir()
+		Expect(signature.GenerateKey(filepath.Join(dir, "trust", "ops.key"))).To(Succeed())
+		key, err := signature.LoadPrivateKey(filepath.Join(dir, "trust", "ops.key"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.Remove(filepath.Join(dir, "trust", "ops.key"))).To(Succeed())
+		trust, err := signature.LoadTrustStore(filepath.Join(dir, "trust"))
+		Expect(err).NotTo(HaveOccurred())
+
+		signed := func(content string) applyinator.CalculatedPlan {
+			plan, err := applyinator.CalculateSignedPlan([]byte(content), signature.Sign([]byte(content), key), trust)
+			Expect(err).NotTo(HaveOccurred())
+			return plan
+		}
+		first := signed(`{"files":[{"path":"` + filepath.Join(dir, "first") + `"}]}`)
+		second := signed(`{"files":[{"path":"` + filepath.Join(dir, "second") + `"}]}`)
+
+		a := applyinator.NewApplyinator(filepath.Join(dir, "work"), false, "", "", nil)
+		a.SetTrustStore(trust)
+
+		merged, err := applyinator.MergePlans(first, second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(merged.SignedBy).To(Equal("ops"))
+		_, err = a.Apply(context.Background(), applyinator.ApplyInput{CalculatedPlan: merged, ReconcileFiles: true})
+		Expect(err).NotTo(HaveOccurred())
+
+		merged, err = applyinator.MergePlans(first, calculate(applyinator.Plan{}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(merged.SignedBy).To(BeEmpty())
+		_, err = a.Apply(context.Background(), applyinator.ApplyInput{CalculatedPlan: merged, ReconcileFiles: true})
+		Expect(err).To(MatchError(signature.ErrUnsigned))
+	})
+})
@@ -1,18 +1,23 @@
 package prober
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
 	"net/http"
 	"net/url"
 	"os"
+	"os/exec"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	k8sprobe "k8s.io/kubernetes/pkg/probe"
+	k8sgrpc "k8s.io/kubernetes/pkg/probe/grpc"
 	k8shttp "k8s.io/kubernetes/pkg/probe/http"
+	k8stcp "k8s.io/kubernetes/pkg/probe/tcp"
 )
 
 type HTTPGetAction struct {
@@ -23,82 +28,122 @@ type HTTPGetAction struct {
 	CACert     string `json:"caCert,omitempty"`
 }
 
+// TCPSocketAction succeeds if a TCP connection to the port can be established.
+type TCPSocketAction struct {
+	Host string `json:"host,omitempty"` // default 127.0.0.1
+	Port int    `json:"port,omitempty"`
+}
+
+// ExecAction succeeds if the command exits with code 0.
+type ExecAction struct {
+	Command []string `json:"command,omitempty"`
+}
+
+// GRPCAction succeeds if the gRPC health service reports the service as serving.
+type GRPCAction struct {
+	Host    string `json:"host,omitempty"` // default 127.0.0.1
+	Port    int    `json:"port,omitempty"`
+	Service string `json:"service,omitempty"`
+}
+
+// FileExistsAction succeeds if the path exists, it can be a regular file, a directory, a device or a socket.
+type FileExistsAction struct {
+	Path string `json:"path,omitempty"`
+}
+
+// Probe checks the health of a component with exactly one of its actions.
 type Probe struct {
-	Name                string        `json:"name,omitempty"`
-	InitialDelaySeconds int           `json:"initialDelaySeconds,omitempty"` // default 0
-	TimeoutSeconds      int           `json:"timeoutSeconds,omitempty"`      // default 1
-	SuccessThreshold    int           `json:"successThreshold,omitempty"`    // default 1
-	FailureThreshold    int           `json:"failureThreshold,omitempty"`    // default 3
-	HTTPGetAction       HTTPGetAction `json:"httpGet,omitempty"`
+	Name                string            `json:"name,omitempty"`
+	InitialDelaySeconds int               `json:"initialDelaySeconds,omitempty"` // default 0
+	TimeoutSeconds      int               `json:"timeoutSeconds,omitempty"`      // default 1
+	SuccessThreshold    int               `json:"successThreshold,omitempty"`    // default 1
+	FailureThreshold    int               `json:"failureThreshold,omitempty"`    // default 3
+	HTTPGetAction       *HTTPGetAction    `json:"httpGet,omitempty"`
+	TCPSocketAction     *TCPSocketAction  `json:"tcpSocket,omitempty"`
+	ExecAction          *ExecAction       `json:"exec,omitempty"`
+	GRPCAction          *GRPCAction       `json:"grpc,omitempty"`
+	FileExistsAction    *FileExistsAction `json:"fileExists,omitempty"`
 }
 
 type ProbeStatus struct {
 	Healthy      bool `json:"healthy,omitempty"`
 	SuccessCount int  `json:"successCount,omitempty"`
 	FailureCount int  `json:"failureCount,omitempty"`
+	// LastOutput and LastError are the output and the error of the last probe run
+	LastOutput string `json:"lastOutput,omitempty"`
+	LastError  string `json:"lastError,omitempty"`
 }
 
-func DoProbe(probe Probe, probeStatus *ProbeStatus, initial bool) error {
-	logrus.Tracef("Running probe %+v", probe)
-	if initial {
-		initialDelayDuration := time.Duration(probe.InitialDelaySeconds) * time.Second
-		logrus.Debugf("[Probe: %s] Sleeping for %.0f seconds before running probe", probe.Name, initialDelayDuration.Seconds())
-		time.Sleep(initialDelayDuration)
+// ValidateProbe checks that the probe has exactly one action and the fields the action requires.
+func ValidateProbe(probe Probe) error {
+	var actions []string
+	if probe.HTTPGetAction != nil {
+		actions = append(actions, "httpGet")
+		if _, err := url.Parse(probe.HTTPGetAction.URL); err != nil || probe.HTTPGetAction.URL == "" {
+			return fmt.Errorf("httpGet requires a valid url")
+		}
 	}
-
-	var k8sProber k8shttp.Prober
-
-	if probe.HTTPGetAction.Insecure {
-		k8sProber = k8shttp.New(false)
-	} else {
-		tlsConfig := tls.Config{}
-		if probe.HTTPGetAction.ClientCert != "" && probe.HTTPGetAction.ClientKey != "" {
-			clientCert, err := tls.LoadX509KeyPair(probe.HTTPGetAction.ClientCert, probe.HTTPGetAction.ClientKey)
-			if err != nil {
-				logrus.Errorf("error loading x509 client cert/key for probe %s (%s/%s): %v", probe.Name, probe.HTTPGetAction.ClientCert, probe.HTTPGetAction.ClientKey, err)
-			}
-			tlsConfig.Certificates = []tls.Certificate{clientCert}
+	if probe.TCPSocketAction != nil {
+		actions = append(actions, "tcpSocket")
+		if !validPort(probe.TCPSocketAction.Port) {
+			return fmt.Errorf("tcpSocket requires a port between 1 and 65535")
 		}
-
-		caCertPool, err := GetSystemCertPool(probe.Name)
-		if err != nil || caCertPool == nil {
-			caCertPool = x509.NewCertPool()
-			logrus.Errorf("error loading system cert pool for probe (%s): %v", probe.Name, err)
+	}
+	if probe.ExecAction != nil {
+		actions = append(actions, "exec")
+		if len(probe.ExecAction.Command) == 0 {
+			return fmt.Errorf("exec requires a command")
 		}
-
-		if probe.HTTPGetAction.CACert != "" {
-			logrus.Debugf("[DoProbe] adding CA certificate [%s] for probe (%s)", probe.HTTPGetAction.CACert, probe.Name)
-			caCert, err := os.ReadFile(probe.HTTPGetAction.CACert)
-			if err != nil {
-				logrus.Errorf("error loading CA cert for probe (%s) %s: %v", probe.Name, probe.HTTPGetAction.CACert, err)
-			}
-			if !caCertPool.AppendCertsFromPEM(caCert) {
-				logrus.Errorf("error while appending ca cert to pool for probe %s", probe.Name)
-			}
+	}
+	if probe.GRPCAction != nil {
+		actions = append(actions, "grpc")
+		if !validPort(probe.GRPCAction.Port) {
+			return fmt.Errorf("grpc requires a port between 1 and 65535")
+		}
+	}
+	if probe.FileExistsAction != nil {
+		actions = append(actions, "fileExists")
+		if probe.FileExistsAction.Path == "" {
+			return fmt.Errorf("fileExists requires a path")
 		}
-
-		tlsConfig.RootCAs = caCertPool
-		k8sProber = k8shttp.NewWithTLSConfig(&tlsConfig, false)
 	}
 
-	probeURL, err := url.Parse(probe.HTTPGetAction.URL)
-	if err != nil {
-		return err
+	switch len(actions) {
+	case 0:
+		return fmt.Errorf("one of httpGet, tcpSocket, exec, grpc or fileExists is required")
+	case 1:
+		return nil
+	default:
+		return fmt.Errorf("only one action can be set, got %s", strings.Join(actions, ", "))
 	}
+}
 
-	probeRequest, err := k8shttp.NewProbeRequest(probeURL, http.Header{})
-	if err != nil {
-		return err
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
+}
+
+func DoProbe(probe Probe, probeStatus *ProbeStatus, initial bool) error {
+	logrus.Tracef("Running probe %+v", probe)
+	if initial {
+		initialDelayDuration := time.Duration(probe.InitialDelaySeconds) * time.Second
+		logrus.Debugf("[Probe: %s] Sleeping for %.0f seconds before running probe", probe.Name, initialDelayDuration.Seconds())
+		time.Sleep(initialDelayDuration)
 	}
 
 	probeDuration := time.Duration(probe.TimeoutSeconds) * time.Second
+	if probeDuration <= 0 {
+		probeDuration = time.Second
+	}
 	logrus.Tracef("[Probe: %s] timeout duration: %.0f seconds", probe.Name, probeDuration.Seconds())
 
-	probeResult, output, err := k8sProber.Probe(probeRequest, probeDuration)
+	probeResult, output, err := runAction(probe, probeDuration)
+	probeStatus.LastOutput = output
 	if err != nil {
 		logrus.Errorf("error while running probe (%s): %v", probe.Name, err)
+		probeStatus.LastError = err.Error()
 		return err
 	}
+	probeStatus.LastError = ""
 
 	logrus.Debugf("[Probe: %s] output was %s", probe.Name, output)
 
@@ -144,6 +189,102 @@ func DoProbe(probe Probe, probeStatus *ProbeStatus, initial bool) error {
 	return nil
 }
 
+// runAction runs the action of the probe once and returns its result and output.
+func runAction(probe Probe, timeout time.Duration) (k8sprobe.Result, string, error) {
+	switch {
+	case probe.HTTPGetAction != nil:
+		return doHTTPGet(probe.Name, probe.HTTPGetAction, timeout)
+	case probe.TCPSocketAction != nil:
+		return k8stcp.New().Probe(orLocalhost(probe.TCPSocketAction.Host), probe.TCPSocketAction.Port, timeout)
+	case probe.ExecAction != nil:
+		return doExec(probe.ExecAction, timeout)
+	case probe.GRPCAction != nil:
+		return k8sgrpc.New().Probe(orLocalhost(probe.GRPCAction.Host), probe.GRPCAction.Service, probe.GRPCAction.Port, timeout)
+	case probe.FileExistsAction != nil:
+		return doFileExists(probe.FileExistsAction)
+	default:
+		return k8sprobe.Unknown, "", fmt.Errorf("probe %s has no action", probe.Name)
+	}
+}
+
+func orLocalhost(host string) string {
+	if host == "" {
+		return "127.0.0.1"
+	}
+	return host
+}
+
+func doHTTPGet(probeName string, action *HTTPGetAction, timeout time.Duration) (k8sprobe.Result, string, error) {
+	var k8sProber k8shttp.Prober
+
+	if action.Insecure {
+		k8sProber = k8shttp.New(false)
+	} else {
+		tlsConfig := tls.Config{}
+		if action.ClientCert != "" && action.ClientKey != "" {
+			clientCert, err := tls.LoadX509KeyPair(action.ClientCert, action.ClientKey)
+			if err != nil {
+				logrus.Errorf("error loading x509 client cert/key for probe %s (%s/%s): %v", probeName, action.ClientCert, action.ClientKey, err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{clientCert}
+		}
+
+		caCertPool, err := GetSystemCertPool(probeName)
+		if err != nil || caCertPool == nil {
+			caCertPool = x509.NewCertPool()
+			logrus.Errorf("error loading system cert pool for probe (%s): %v", probeName, err)
+		}
+
+		if action.CACert != "" {
+			logrus.Debugf("[DoProbe] adding CA certificate [%s] for probe (%s)", action.CACert, probeName)
+			caCert, err := os.ReadFile(action.CACert)
+			if err != nil {
+				logrus.Errorf("error loading CA cert for probe (%s) %s: %v", probeName, action.CACert, err)
+			}
+			if !caCertPool.AppendCertsFromPEM(caCert) {
+				logrus.Errorf("error while appending ca cert to pool for probe %s", probeName)
+			}
+		}
+
+		tlsConfig.RootCAs = caCertPool
+		k8sProber = k8shttp.NewWithTLSConfig(&tlsConfig, false)
+	}
+
+	probeURL, err := url.Parse(action.URL)
+	if err != nil {
+		return k8sprobe.Unknown, "", err
+	}
+
+	probeRequest, err := k8shttp.NewProbeRequest(probeURL, http.Header{})
+	if err != nil {
+		return k8sprobe.Unknown, "", err
+	}
+
+	return k8sProber.Probe(probeRequest, timeout)
+}
+
+func doExec(action *ExecAction, timeout time.Duration) (k8sprobe.Result, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, action.Command[0], action.Command[1:]...).CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return k8sprobe.Failure, fmt.Sprintf("command timed out after %v", timeout), nil
+	}
+	if err != nil {
+		return k8sprobe.Failure, fmt.Sprintf("%s%v", output, err), nil
+	}
+	return k8sprobe.Success, string(output), nil
+}
+
+func doFileExists(action *FileExistsAction) (k8sprobe.Result, string, error) {
+	_, err := os.Stat(action.Path)
+	if err != nil {
+		return k8sprobe.Failure, err.Error(), nil
+	}
+	return k8sprobe.Success, action.Path + " exists", nil
+}
+
 // GetSystemCertPool returns a x509.CertPool that contains the
 // root CA certificates if they are present at runtime
 func GetSystemCertPool(probeName string) (*x509.CertPool, error) {
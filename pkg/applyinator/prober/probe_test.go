@@ -0,0 +1,52 @@
+package prober_test
+
+import (
+	"net"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/llmos-ai/llmos/pkg/applyinator/prober"
+)
+
+var _ = Describe("probe actions", Label("prober"), func() {
+	It("requires exactly one action", func() {
+		Expect(prober.ValidateProbe(prober.Probe{})).To(MatchError(ContainSubstring("is required")))
+		Expect(prober.ValidateProbe(prober.Probe{
+			ExecAction:       &prober.ExecAction{Command: []string{"true"}},
+			FileExistsAction: &prober.FileExistsAction{Path: "/"},
+		})).To(MatchError(ContainSubstring("only one action can be set, got exec, fileExists")))
+		Expect(prober.ValidateProbe(prober.Probe{
+			TCPSocketAction: &prober.TCPSocketAction{},
+		})).To(MatchError(ContainSubstring("tcpSocket requires a port")))
+	})
+
+	DescribeTable("reports the health of the action",
+		func(probe prober.Probe, healthy bool) {
+			status := prober.ProbeStatus{}
+			probe.FailureThreshold = 1
+			Expect(prober.DoProbe(probe, &status, true)).To(Succeed())
+			Expect(status.Healthy).To(Equal(healthy))
+		},
+		Entry("exec succeeds", prober.Probe{ExecAction: &prober.ExecAction{Command: []string{"/bin/sh", "-c", "exit 0"}}}, true),
+		Entry("exec fails", prober.Probe{ExecAction: &prober.ExecAction{Command: []string{"/bin/sh", "-c", "exit 1"}}}, false),
+		Entry("file exists", prober.Probe{FileExistsAction: &prober.FileExistsAction{Path: "/"}}, true),
+		Entry("file does not exist", prober.Probe{FileExistsAction: &prober.FileExistsAction{Path: filepath.Join("/nonexistent", "file")}}, false),
+	)
+
+	It("connects to tcp sockets", func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		port := listener.Addr().(*net.TCPAddr).Port
+
+		status := prober.ProbeStatus{}
+		probe := prober.Probe{TCPSocketAction: &prober.TCPSocketAction{Port: port}, FailureThreshold: 1}
+		Expect(prober.DoProbe(probe, &status, true)).To(Succeed())
+		Expect(status.Healthy).To(BeTrue())
+
+		Expect(listener.Close()).To(Succeed())
+		Expect(prober.DoProbe(probe, &status, false)).To(Succeed())
+		Expect(status.Healthy).To(BeFalse())
+	})
+})
@@ -0,0 +1,189 @@
+package applyinator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/llmos-ai/llmos/pkg/utils/atomicfile"
+)
+
+const (
+	FileStatePresent = "present"
+	FileStateAbsent  = "absent"
+)
+
+// managedFile is a file written by an applied plan, recorded so that it is removed once a plan drops it.
+type managedFile struct {
+	Path      string `json:"path"`
+	Directory bool   `json:"directory,omitempty"`
+}
+
+// reconcileFiles creates, links and removes the files of the plan, and removes the files of the previous plan
+// that are no longer part of it.
+func (a *Applyinator) reconcileFiles(ctx context.Context, input ApplyInput) error {
+	checksum := input.CalculatedPlan.Checksum
+	facts := withHostFacts(input.Facts)
+	for _, file := range input.CalculatedPlan.Plan.Files {
+		switch {
+		case file.State == FileStateAbsent:
+			if err := a.removeFile(checksum, file.Path, file.Directory); err != nil {
+				return err
+			}
+		case file.Directory:
+			logrus.Debugf("[Applyinator] Creating directory %s", file.Path)
+			if err := CreateDirectory(file); err != nil {
+				return err
+			}
+		case file.Symlink != "":
+			if target, err := os.Readlink(file.Path); err == nil && target == file.Symlink {
+				logrus.Debugf("[Applyinator] Symlink %s does not need to be created", file.Path)
+				continue
+			}
+			if err := a.backups.backup(checksum, file.Path); err != nil {
+				return fmt.Errorf("backing up file %s: %w", file.Path, err)
+			}
+			logrus.Debugf("[Applyinator] Creating symlink %s to %s", file.Path, file.Symlink)
+			if err := createSymlink(file.Path, file.Symlink); err != nil {
+				return fmt.Errorf("creating symlink %s: %w", file.Path, err)
+			}
+		default:
+			content, err := a.fileContent(ctx, file, facts)
+			if err != nil {
+				return fmt.Errorf("resolving content of file %s: %w", file.Path, err)
+			}
+			if existing, err := os.ReadFile(file.Path); err != nil || !bytes.Equal(existing, content) || isSymlink(file.Path) {
+				if err := a.backups.backup(checksum, file.Path); err != nil {
+					return fmt.Errorf("backing up file %s: %w", file.Path, err)
+				}
+			}
+			if isSymlink(file.Path) {
+				// replace the link instead of writing to its target
+				if err := os.Remove(file.Path); err != nil {
+					return err
+				}
+			}
+			logrus.Debugf("[Applyinator] Writing file %s", file.Path)
+			if err := writeFile(file, content); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := a.removeDroppedFiles(input.ManagedFilesFile, input.CalculatedPlan); err != nil {
+		return err
+	}
+	if a.backups != nil {
+		if err := a.backups.prune(backupRetentionPolicy); err != nil {
+			logrus.Errorf("error while pruning file backups: %v", err)
+		}
+	}
+	return nil
+}
+
+// removeFile removes the file, a directory is removed with its content.
+func (a *Applyinator) removeFile(checksum, path string, directory bool) error {
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		return nil
+	}
+	if err := a.backups.backup(checksum, path); err != nil {
+		return fmt.Errorf("backing up file %s: %w", path, err)
+	}
+
+	logrus.Infof("[Applyinator] Removing file %s", path)
+	if directory {
+		return os.RemoveAll(path)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// removeDroppedFiles removes the files of the previously applied plan that are not part of the plan anymore,
+// and records the files of the plan for the next one. Dropped directories are only removed if they are empty.
+func (a *Applyinator) removeDroppedFiles(path string, plan CalculatedPlan) error {
+	if path == "" {
+		return nil
+	}
+
+	var previous []managedFile
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	} else if err == nil {
+		if err = json.Unmarshal(content, &previous); err != nil {
+			return fmt.Errorf("decoding managed files %s: %w", path, err)
+		}
+	}
+
+	current := make([]managedFile, 0, len(plan.Plan.Files))
+	present := map[string]bool{}
+	for _, file := range plan.Plan.Files {
+		if file.State == FileStateAbsent {
+			continue
+		}
+		current = append(current, managedFile{Path: file.Path, Directory: file.Directory})
+		present[filepath.Clean(file.Path)] = true
+	}
+
+	// remove the files before the directories holding them
+	for i := len(previous) - 1; i >= 0; i-- {
+		dropped := previous[i]
+		if present[filepath.Clean(dropped.Path)] {
+			continue
+		}
+		if !dropped.Directory {
+			if err = a.removeFile(plan.Checksum, dropped.Path, false); err != nil {
+				return fmt.Errorf("removing dropped file %s: %w", dropped.Path, err)
+			}
+			continue
+		}
+		if err = os.Remove(dropped.Path); err != nil && !os.IsNotExist(err) {
+			if errors.Is(err, syscall.ENOTEMPTY) || errors.Is(err, syscall.EEXIST) {
+				logrus.Warnf("[Applyinator] Keeping dropped directory %s as it is not empty", dropped.Path)
+				continue
+			}
+			return fmt.Errorf("removing dropped directory %s: %w", dropped.Path, err)
+		}
+		logrus.Infof("[Applyinator] Removed dropped directory %s", dropped.Path)
+	}
+
+	content, err = json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), defaultDirectoryPermissions); err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(path, content, 0600)
+}
+
+// createSymlink points the link at the path to the target, replacing whatever is at the path.
+func createSymlink(path, target string) error {
+	if err := os.MkdirAll(filepath.Dir(path), defaultDirectoryPermissions); err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp-link")
+	_ = os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return atomicfile.SyncDir(filepath.Dir(path))
+}
+
+func isSymlink(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && info.Mode()&os.ModeSymlink != 0
+}
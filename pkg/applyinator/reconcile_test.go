@@ -0,0 +1,108 @@
+package applyinator_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/llmos-ai/llmos/pkg/applyinator"
+)
+
+var _ = Describe("file reconciliation", Label("applyinator", "file"), func() {
+	var (
+		dir   string
+		store *applyinator.BackupStore
+		a     *applyinator.Applyinator
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		store = applyinator.NewBackupStore(filepath.Join(dir, "backup"), nil)
+		a = applyinator.NewApplyinator(filepath.Join(dir, "work"), false, "", "", nil)
+		a.SetBackupStore(store)
+	})
+
+	path := func(name string) string {
+		return filepath.Join(dir, "etc", name)
+	}
+
+	apply := func(files ...applyinator.File) string {
+		raw, err := json.Marshal(applyinator.Plan{Files: files})
+		Expect(err).NotTo(HaveOccurred())
+		plan, err := applyinator.CalculatePlan(raw)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = a.Apply(context.Background(), applyinator.ApplyInput{
+			CalculatedPlan:   plan,
+			ReconcileFiles:   true,
+			ManagedFilesFile: filepath.Join(dir, "managed-files.json"),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return plan.Checksum
+	}
+
+	plain := func(name, content string) applyinator.File {
+		return applyinator.File{Path: path(name), Encoding: applyinator.FileEncodingPlain, Content: content}
+	}
+
+	It("creates symlinks and removes absent files", func() {
+		Expect(os.MkdirAll(path(""), 0755)).To(Succeed())
+		Expect(os.WriteFile(path("stale"), []byte("stale"), 0600)).To(Succeed())
+
+		apply(
+			applyinator.File{Path: path("kubeconfig.yaml"), Symlink: "/etc/rancher/k3s/k3s.yaml"},
+			applyinator.File{Path: path("stale"), State: applyinator.FileStateAbsent},
+		)
+
+		Expect(os.Readlink(path("kubeconfig.yaml"))).To(Equal("/etc/rancher/k3s/k3s.yaml"))
+		Expect(path("stale")).NotTo(BeAnExistingFile())
+	})
+
+	It("removes the files dropped from the previous plan and restores them from the backup", func() {
+		apply(
+			applyinator.File{Path: path("charts"), Directory: true},
+			plain("charts/values.yaml", "a: b\n"),
+			plain("config.yaml", "token: a\n"),
+			applyinator.File{Path: path("kubeconfig.yaml"), Symlink: "/etc/rancher/k3s/k3s.yaml"},
+		)
+		checksum := apply(plain("config.yaml", "token: a\n"))
+
+		Expect(path("charts")).NotTo(BeADirectory())
+		Expect(path("kubeconfig.yaml")).NotTo(BeAnExistingFile())
+		Expect(path("config.yaml")).To(BeARegularFile())
+
+		set, err := store.Get(checksum)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = store.Restore(*set)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.ReadFile(path("charts/values.yaml"))).To(Equal([]byte("a: b\n")))
+		Expect(os.Readlink(path("kubeconfig.yaml"))).To(Equal("/etc/rancher/k3s/k3s.yaml"))
+	})
+
+	It("keeps dropped directories that are not empty", func() {
+		apply(applyinator.File{Path: path("manifests"), Directory: true})
+		Expect(os.WriteFile(path("manifests/custom.yaml"), []byte("custom"), 0600)).To(Succeed())
+
+		apply()
+		Expect(path("manifests/custom.yaml")).To(BeARegularFile())
+	})
+
+	It("rejects invalid states", func() {
+		raw, err := json.Marshal(applyinator.Plan{Files: []applyinator.File{
+			{Path: path("a"), State: "gone"},
+		}})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = applyinator.CalculatePlan(raw)
+		Expect(err).To(MatchError(ContainSubstring("unknown state gone")))
+
+		raw, err = json.Marshal(applyinator.Plan{Files: []applyinator.File{
+			{Path: path("a"), Symlink: "/b", Content: "YQ=="},
+		}})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = applyinator.CalculatePlan(raw)
+		Expect(err).To(MatchError(ContainSubstring("a symlink can't have content")))
+	})
+})
@@ -0,0 +1,147 @@
+package applyinator
+
+import (
+	"encoding/base64"
+	"sort"
+	"strings"
+)
+
+// Redacted replaces sensitive values in logs, outputs and plan files.
+const Redacted = "<redacted>"
+
+// minSensitiveValueLength avoids masking short values such as "1" or "true" all over the output.
+const minSensitiveValueLength = 4
+
+// Redactor masks sensitive values in text.
+type Redactor struct {
+	replacer *strings.Replacer
+}
+
+// NewRedactor returns a redactor masking the values, values shorter than 4 characters are ignored.
+func NewRedactor(values ...string) *Redactor {
+	// replace longer values first, so a value containing another one is masked completely
+	sorted := append([]string(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return len(sorted[i]) > len(sorted[j])
+	})
+
+	var pairs []string
+	for _, value := range sorted {
+		if len(value) >= minSensitiveValueLength {
+			pairs = append(pairs, value, Redacted)
+		}
+	}
+	if len(pairs) == 0 {
+		return &Redactor{}
+	}
+	return &Redactor{replacer: strings.NewReplacer(pairs...)}
+}
+
+// String returns s with the sensitive values masked.
+func (r *Redactor) String(s string) string {
+	if r == nil || r.replacer == nil {
+		return s
+	}
+	return r.replacer.Replace(s)
+}
+
+// Bytes returns b with the sensitive values masked.
+func (r *Redactor) Bytes(b []byte) []byte {
+	if r == nil || r.replacer == nil {
+		return b
+	}
+	return []byte(r.replacer.Replace(string(b)))
+}
+
+// SensitiveValues returns the values of the sensitive env vars of the plan instructions
+// and the content of sensitive single line files, such as token files.
+func SensitiveValues(plan Plan) []string {
+	var values []string
+	addEnv := func(instruction CommonInstruction) {
+		for _, env := range instruction.Env {
+			if key, value, ok := strings.Cut(env, "="); ok && instruction.isSensitiveEnv(key) {
+				values = append(values, value)
+			}
+		}
+	}
+	for _, instruction := range plan.OneTimeInstructions {
+		addEnv(instruction.CommonInstruction)
+	}
+	for _, instruction := range plan.PeriodicInstructions {
+		addEnv(instruction.CommonInstruction)
+	}
+	for _, file := range plan.Files {
+		if !file.Sensitive || file.Source != "" {
+			continue
+		}
+		content, err := DecodeContent(file)
+		if err != nil {
+			continue
+		}
+		if value := strings.TrimSpace(string(content)); value != "" && !strings.Contains(value, "\n") {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// RedactPlan returns a copy of the plan with the values of sensitive env vars and the content of sensitive files
+// masked. The redacted plan is marked as such and can't be applied.
+func RedactPlan(plan Plan) Plan {
+	redactor := NewRedactor(SensitiveValues(plan)...)
+	result := plan
+	result.Redacted = true
+
+	result.Files = make([]File, len(plan.Files))
+	for i, file := range plan.Files {
+		if file.Sensitive && file.Content != "" {
+			file.Content = base64.StdEncoding.EncodeToString([]byte(Redacted + "\n"))
+			file.Encoding = ""
+		}
+		result.Files[i] = file
+	}
+
+	result.OneTimeInstructions = make([]OneTimeInstruction, len(plan.OneTimeInstructions))
+	for i, instruction := range plan.OneTimeInstructions {
+		instruction.CommonInstruction = redactInstruction(instruction.CommonInstruction, redactor)
+		result.OneTimeInstructions[i] = instruction
+	}
+	result.PeriodicInstructions = make([]PeriodicInstruction, len(plan.PeriodicInstructions))
+	for i, instruction := range plan.PeriodicInstructions {
+		instruction.CommonInstruction = redactInstruction(instruction.CommonInstruction, redactor)
+		result.PeriodicInstructions[i] = instruction
+	}
+	return result
+}
+
+// RedactEnv returns the env with the values of the sensitive keys masked.
+func RedactEnv(env []string, sensitiveKeys []string) []string {
+	return redactInstruction(CommonInstruction{Env: env, SensitiveEnv: sensitiveKeys}, nil).Env
+}
+
+func redactInstruction(instruction CommonInstruction, redactor *Redactor) CommonInstruction {
+	env := make([]string, len(instruction.Env))
+	for i, e := range instruction.Env {
+		if key, _, ok := strings.Cut(e, "="); ok && instruction.isSensitiveEnv(key) {
+			e = key + "=" + Redacted
+		}
+		env[i] = e
+	}
+	instruction.Env = env
+
+	args := make([]string, len(instruction.Args))
+	for i, arg := range instruction.Args {
+		args[i] = redactor.String(arg)
+	}
+	instruction.Args = args
+	return instruction
+}
+
+func (c CommonInstruction) isSensitiveEnv(key string) bool {
+	for _, sensitive := range c.SensitiveEnv {
+		if sensitive == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package applyinator_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/llmos-ai/llmos/pkg/applyinator"
+)
+
+var _ = Describe("secret redaction", Label("applyinator", "redact"), func() {
+	secretInstruction := func() applyinator.OneTimeInstruction {
+		inst := instruction("install", `echo "token is $TOKEN"`)
+		inst.Env = []string{"TOKEN=s3cr3t-token", "DEBUG=true"}
+		inst.SensitiveEnv = []string{"TOKEN"}
+		inst.SaveOutput = true
+		return inst
+	}
+	tokenFile := func(dir string) applyinator.File {
+		return applyinator.File{
+			Path:      filepath.Join(dir, "token"),
+			Content:   base64.StdEncoding.EncodeToString([]byte("file-token\n")),
+			Sensitive: true,
+		}
+	}
+
+	It("masks sensitive env values and file content in the plan", func() {
+		inst := secretInstruction()
+		inst.Args = []string{"--token", "file-token"}
+		redacted := applyinator.RedactPlan(applyinator.Plan{
+			Files:               []applyinator.File{tokenFile("/var/lib/llmos")},
+			OneTimeInstructions: []applyinator.OneTimeInstruction{inst},
+		})
+
+		Expect(redacted.Redacted).To(BeTrue())
+		Expect(redacted.OneTimeInstructions[0].Env).To(Equal([]string{"TOKEN=" + applyinator.Redacted, "DEBUG=true"}))
+		Expect(redacted.OneTimeInstructions[0].Args).To(Equal([]string{"--token", applyinator.Redacted}))
+		content, err := base64.StdEncoding.DecodeString(redacted.Files[0].Content)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(content)).To(Equal(applyinator.Redacted + "\n"))
+		// the original plan is left untouched
+		Expect(inst.Env[0]).To(Equal("TOKEN=s3cr3t-token"))
+
+		raw, err := json.Marshal(redacted)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = applyinator.CalculatePlan(raw)
+		Expect(err).To(MatchError(ContainSubstring("redacted")))
+	})
+
+	It("masks sensitive values in the output and the applied plan history", func() {
+		dir := GinkgoT().TempDir()
+		raw, err := json.Marshal(applyinator.Plan{
+			Files:               []applyinator.File{tokenFile(dir)},
+			OneTimeInstructions: []applyinator.OneTimeInstruction{secretInstruction()},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		plan, err := applyinator.CalculatePlan(raw)
+		Expect(err).NotTo(HaveOccurred())
+
+		appliedDir := filepath.Join(dir, "applied")
+		a := applyinator.NewApplyinator(filepath.Join(dir, "work"), false, appliedDir, "", nil)
+		output, err := a.Apply(context.Background(), applyinator.ApplyInput{
+			CalculatedPlan:         plan,
+			ReconcileFiles:         true,
+			RunOneTimeInstructions: true,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output.OneTimeApplySucceeded).To(BeTrue())
+
+		gz, err := gzip.NewReader(bytes.NewReader(output.OneTimeOutput))
+		Expect(err).NotTo(HaveOccurred())
+		decompressed, err := io.ReadAll(gz)
+		Expect(err).NotTo(HaveOccurred())
+		outputs := map[string][]byte{}
+		Expect(json.Unmarshal(decompressed, &outputs)).To(Succeed())
+		Expect(string(outputs["install"])).To(Equal("token is " + applyinator.Redacted + "\n"))
+
+		// the file itself is written with its real content
+		Expect(os.ReadFile(filepath.Join(dir, "token"))).To(Equal([]byte("file-token\n")))
+
+		history, err := os.ReadDir(appliedDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(history).To(HaveLen(1))
+		applied, err := os.ReadFile(filepath.Join(appliedDir, history[0].Name()))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(applied)).NotTo(ContainSubstring("s3cr3t-token"))
+		Expect(string(applied)).NotTo(ContainSubstring(base64.StdEncoding.EncodeToString([]byte("file-token\n"))))
+	})
+})
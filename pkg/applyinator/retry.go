@@ -0,0 +1,100 @@
+package applyinator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultBackoffInitialSeconds = 5
+	defaultBackoffMaxSeconds     = 60
+	defaultBackoffMultiplier     = 2
+)
+
+// Backoff is the delay between two attempts of an instruction. The delay starts at InitialSeconds
+// and is multiplied by Multiplier after every failed attempt, up to MaxSeconds.
+type Backoff struct {
+	InitialSeconds int     `json:"initialSeconds,omitempty"` // default 5
+	MaxSeconds     int     `json:"maxSeconds,omitempty"`     // default 60
+	Multiplier     float64 `json:"multiplier,omitempty"`     // default 2
+}
+
+// delay returns the duration to wait after the given failed attempt, attempts start at 1.
+func (b *Backoff) delay(attempt int) time.Duration {
+	initial, maxSeconds, multiplier := defaultBackoffInitialSeconds, defaultBackoffMaxSeconds, float64(defaultBackoffMultiplier)
+	if b != nil {
+		if b.InitialSeconds > 0 {
+			initial = b.InitialSeconds
+		}
+		if b.MaxSeconds > 0 {
+			maxSeconds = b.MaxSeconds
+		}
+		if b.Multiplier >= 1 {
+			multiplier = b.Multiplier
+		}
+	}
+	seconds := float64(initial) * math.Pow(multiplier, float64(attempt-1))
+	if seconds > float64(maxSeconds) {
+		seconds = float64(maxSeconds)
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// executeWithRetry executes the instruction until it succeeds or maxAttempts is reached, waiting for the instruction
+// backoff between attempts. firstAttempt is the attempt number passed to the first execution, and onAttempt, if set,
+// is called before every attempt. When more than one attempt is allowed, the result of every attempt is recorded in
+// the returned stdout.
+func (a *Applyinator) executeWithRetry(ctx context.Context, prefix string, redactor *Redactor, executionDir string, instruction CommonInstruction, combinedOutput bool, maxAttempts, firstAttempt int, onAttempt func(attempt int)) ([]byte, []byte, int, error) {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	var (
+		stdoutBuffer bytes.Buffer
+		stderrBuffer bytes.Buffer
+		exitCode     int
+		err          error
+	)
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if onAttempt != nil {
+			onAttempt(attempt)
+		}
+		start := time.Now()
+		var stdout, stderr []byte
+		stdout, stderr, exitCode, err = a.execute(ctx, prefix, redactor, executionDir, instruction, combinedOutput, firstAttempt+attempt-1)
+		duration := time.Since(start).Round(time.Millisecond)
+
+		if maxAttempts == 1 {
+			return stdout, stderr, exitCode, err
+		}
+
+		stdoutBuffer.Write(stdout)
+		stderrBuffer.Write(stderr)
+		result := fmt.Sprintf("exited with code %d", exitCode)
+		if err != nil {
+			result = fmt.Sprintf("%s: %v", result, err)
+		}
+		fmt.Fprintf(&stdoutBuffer, "--- attempt %d/%d %s after %s ---\n", attempt, maxAttempts, result, duration)
+
+		if err == nil && exitCode == 0 {
+			break
+		}
+		if attempt == maxAttempts || ctx.Err() != nil {
+			logrus.Errorf("[Applyinator] Instruction %s failed after %d attempt(s)", instruction.Name, attempt)
+			break
+		}
+
+		delay := instruction.Backoff.delay(attempt)
+		logrus.Infof("[Applyinator] Instruction %s attempt %d/%d failed, retrying in %s", instruction.Name, attempt, maxAttempts, delay)
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+	}
+	return stdoutBuffer.Bytes(), stderrBuffer.Bytes(), exitCode, err
+}
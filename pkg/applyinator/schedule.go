@@ -0,0 +1,350 @@
+package applyinator
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxScheduleLookahead bounds the search of the next time of a schedule, a schedule that does not match within
+// it, e.g. on February 30th, never runs.
+const maxScheduleLookahead = 5 * 366 * 24 * time.Hour
+
+// Window is a daily time range a periodic instruction is allowed to run in, in the local time of the node.
+type Window struct {
+	Days  []string `json:"days,omitempty"` // days the window starts on, mon to sun, default every day
+	Start string   `json:"start"`          // HH:MM
+	End   string   `json:"end"`            // HH:MM, before the start if the window spans midnight
+}
+
+var (
+	weekdays = map[string]time.Weekday{
+		"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+		"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+	}
+	// names of the months and days of week in schedules
+	scheduleMonths = map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}
+	scheduleWeekdays = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+)
+
+// NextRunTime returns when the periodic instruction runs next given the output of its previous runs: its period or
+// the next time of its schedule after the last successful run delayed by its jitter, but not before the failure
+// cooldown of the last failed run elapsed, and at the earliest in one of its allowed windows. An instruction that
+// never succeeded runs right away with a period, or at the next time of its schedule. The instruction is due if the
+// time is not after now.
+func NextRunTime(instruction PeriodicInstruction, po PeriodicInstructionOutput, now time.Time) (time.Time, error) {
+	next := now
+	if po.LastSuccessfulRunTime != "" || instruction.Schedule != "" {
+		last := now
+		var err error
+		if po.LastSuccessfulRunTime != "" {
+			if last, err = time.Parse(time.UnixDate, po.LastSuccessfulRunTime); err != nil {
+				return now, fmt.Errorf("parsing last successful run time: %w", err)
+			}
+		}
+		if next, err = scheduledAfter(instruction, last); err != nil {
+			return now, err
+		}
+		next = next.Add(jitter(instruction, next, instruction.JitterSeconds))
+	}
+	if po.LastFailedRunTime != "" {
+		failed, err := time.Parse(time.UnixDate, po.LastFailedRunTime)
+		if err != nil {
+			return now, fmt.Errorf("parsing last failed run time: %w", err)
+		}
+		if retry := failed.Add(failureCooldown(po.Failures)); retry.After(next) {
+			next = retry
+		}
+	}
+	next = next.In(time.Local)
+	if len(instruction.AllowedWindows) == 0 {
+		return next, nil
+	}
+
+	start, end, err := nextWindow(instruction.AllowedWindows, next)
+	if err != nil {
+		return now, err
+	}
+	if start.After(next) {
+		// the instructions of the nodes are spread over the window instead of all starting when it opens
+		next = start.Add(jitter(instruction, start, min(instruction.JitterSeconds, int(end.Sub(start).Seconds())-1)))
+	}
+	return next, nil
+}
+
+// scheduledAfter returns the time the instruction is scheduled at after its last successful run.
+func scheduledAfter(instruction PeriodicInstruction, last time.Time) (time.Time, error) {
+	if instruction.Schedule == "" {
+		period := instruction.PeriodSeconds
+		if period == 0 {
+			period = defaultPeriodSeconds
+		}
+		return last.Add(time.Duration(period) * time.Second), nil
+	}
+
+	schedule, err := parseSchedule(instruction.Schedule)
+	if err != nil {
+		return last, err
+	}
+	next := schedule.next(last.In(time.Local))
+	if next.IsZero() {
+		return last, fmt.Errorf("schedule %q never runs", instruction.Schedule)
+	}
+	return next, nil
+}
+
+// failureCooldown returns the delay before a failed periodic instruction runs again, 30s per failure up to 3 minutes.
+func failureCooldown(failures int) time.Duration {
+	if failures > 6 {
+		failures = 6
+	} else if failures == 0 {
+		failures = 1
+	}
+	return time.Duration(30*failures) * time.Second
+}
+
+// jitter returns a delay of up to the given seconds for the instruction. It is random across the nodes and the
+// instructions but stable for a given scheduled time, so that the next run does not move each time it is computed.
+func jitter(instruction PeriodicInstruction, scheduled time.Time, seconds int) time.Duration {
+	if seconds <= 0 {
+		return 0
+	}
+	hostname, _ := os.Hostname()
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s/%s/%d", hostname, instruction.Name, scheduled.Unix())
+	return time.Duration(h.Sum64()%uint64(seconds+1)) * time.Second
+}
+
+// nextWindow returns the start and end of the first allowed window containing the time or starting after it. The
+// start is the time itself if a window contains it.
+func nextWindow(windows []Window, t time.Time) (time.Time, time.Time, error) {
+	t = t.In(time.Local)
+	var start, end time.Time
+	for _, window := range windows {
+		days, from, to, err := parseWindow(window)
+		if err != nil {
+			return t, t, err
+		}
+		// a window that started the day before might still be open
+		for offset := -1; offset <= 7; offset++ {
+			day := time.Date(t.Year(), t.Month(), t.Day()+offset, 0, 0, 0, 0, time.Local)
+			if len(days) > 0 && !days[day.Weekday()] {
+				continue
+			}
+			windowStart := day.Add(from)
+			windowEnd := day.Add(to)
+			if to <= from {
+				windowEnd = windowEnd.Add(24 * time.Hour)
+			}
+			if !windowEnd.After(t) {
+				continue
+			}
+			if windowStart.Before(t) {
+				windowStart = t
+			}
+			if start.IsZero() || windowStart.Before(start) {
+				start, end = windowStart, windowEnd
+			}
+			break
+		}
+	}
+	if start.IsZero() {
+		return t, t, fmt.Errorf("no allowed window after %s", t.Format(time.UnixDate))
+	}
+	return start, end, nil
+}
+
+func parseWindow(window Window) (map[time.Weekday]bool, time.Duration, time.Duration, error) {
+	days := map[time.Weekday]bool{}
+	for _, day := range window.Days {
+		weekday, ok := weekdays[strings.ToLower(day)]
+		if !ok {
+			return nil, 0, 0, fmt.Errorf("invalid day %q of window, expected mon to sun", day)
+		}
+		days[weekday] = true
+	}
+	from, err := parseTimeOfDay(window.Start)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("invalid start of window: %w", err)
+	}
+	to, err := parseTimeOfDay(window.End)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("invalid end of window: %w", err)
+	}
+	if from == to {
+		return nil, 0, 0, fmt.Errorf("window %s-%s is empty", window.Start, window.End)
+	}
+	return days, from, to, nil
+}
+
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a HH:MM time", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// validateSchedule checks the schedule, jitter and windows of the periodic instruction.
+func validateSchedule(instruction PeriodicInstruction) error {
+	if instruction.Schedule != "" {
+		if instruction.PeriodSeconds != 0 {
+			return fmt.Errorf("either a period or a schedule can be set")
+		}
+		schedule, err := parseSchedule(instruction.Schedule)
+		if err != nil {
+			return err
+		}
+		if schedule.next(time.Now()).IsZero() {
+			return fmt.Errorf("schedule %q never runs", instruction.Schedule)
+		}
+	}
+	if instruction.PeriodSeconds < 0 {
+		return fmt.Errorf("period must not be negative")
+	}
+	if instruction.JitterSeconds < 0 {
+		return fmt.Errorf("jitter must not be negative")
+	}
+	for _, window := range instruction.AllowedWindows {
+		if _, _, _, err := parseWindow(window); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cronSchedule is a standard 5 field cron expression: minute, hour, day of month, month and day of week.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// the day matches either the day of month or the day of week if both are restricted, like cron does
+	domAny, dowAny bool
+}
+
+var scheduleMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+func parseSchedule(expression string) (*cronSchedule, error) {
+	if macro, ok := scheduleMacros[strings.TrimSpace(expression)]; ok {
+		expression = macro
+	}
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q, expected minute, hour, day of month, month and day of week", expression)
+	}
+
+	var (
+		s   cronSchedule
+		err error
+	)
+	if s.minute, err = parseScheduleField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("invalid minute of schedule %q: %w", expression, err)
+	}
+	if s.hour, err = parseScheduleField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("invalid hour of schedule %q: %w", expression, err)
+	}
+	if s.dom, err = parseScheduleField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("invalid day of month of schedule %q: %w", expression, err)
+	}
+	if s.month, err = parseScheduleField(fields[3], 1, 12, scheduleMonths); err != nil {
+		return nil, fmt.Errorf("invalid month of schedule %q: %w", expression, err)
+	}
+	if s.dow, err = parseScheduleField(fields[4], 0, 7, scheduleWeekdays); err != nil {
+		return nil, fmt.Errorf("invalid day of week of schedule %q: %w", expression, err)
+	}
+	// 7 is Sunday as well
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domAny = strings.HasPrefix(fields[2], "*")
+	s.dowAny = strings.HasPrefix(fields[4], "*")
+	return &s, nil
+}
+
+// parseScheduleField parses a comma separated list of values, ranges and steps, e.g. 1,15-20,*/5, into a bit set.
+// The values can be given by their name as well.
+func parseScheduleField(field string, lowest, highest int, names map[string]int) (uint64, error) {
+	value := func(v string) (int, error) {
+		if named, ok := names[strings.ToLower(v)]; ok {
+			return named, nil
+		}
+		return strconv.Atoi(v)
+	}
+
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+		}
+
+		from, to := lowest, highest
+		if rangePart != "*" {
+			first, last, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if from, err = value(first); err != nil {
+				return 0, fmt.Errorf("invalid value %q", first)
+			}
+			to = from
+			if isRange {
+				if to, err = value(last); err != nil {
+					return 0, fmt.Errorf("invalid value %q", last)
+				}
+			} else if hasStep {
+				to = highest
+			}
+		}
+		if from < lowest || to > highest || from > to {
+			return 0, fmt.Errorf("%q is out of the range %d-%d", part, lowest, highest)
+		}
+		for value := from; value <= to; value += step {
+			bits |= 1 << value
+		}
+	}
+	return bits, nil
+}
+
+// next returns the first time after t matching the schedule, zero if there is none within the lookahead.
+func (s *cronSchedule) next(t time.Time) time.Time {
+	limit := t.Add(maxScheduleLookahead)
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
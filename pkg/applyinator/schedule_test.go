@@ -0,0 +1,169 @@
+package applyinator_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/llmos-ai/llmos/pkg/applyinator"
+)
+
+var _ = Describe("periodic instruction schedules", Label("applyinator", "schedule"), func() {
+	at := func(day, hour, minute int) time.Time {
+		// Wednesday, January 1st 2025 is day 1
+		return time.Date(2025, time.January, day, hour, minute, 0, 0, time.Local)
+	}
+
+	ranAt := func(t time.Time) applyinator.PeriodicInstructionOutput {
+		return applyinator.PeriodicInstructionOutput{Name: "gc", LastSuccessfulRunTime: t.Format(time.UnixDate)}
+	}
+
+	next := func(instruction applyinator.PeriodicInstruction, po applyinator.PeriodicInstructionOutput, now time.Time) time.Time {
+		instruction.Name = "gc"
+		t, err := applyinator.NextRunTime(instruction, po, now)
+		Expect(err).NotTo(HaveOccurred())
+		return t
+	}
+
+	It("runs an instruction with a period that never ran right away", func() {
+		Expect(next(applyinator.PeriodicInstruction{PeriodSeconds: 3600}, applyinator.PeriodicInstructionOutput{}, at(1, 12, 0))).
+			To(Equal(at(1, 12, 0)))
+	})
+
+	It("runs an instruction with a schedule that never ran at the next time of the schedule", func() {
+		Expect(next(applyinator.PeriodicInstruction{Schedule: "0 3 * * *"}, applyinator.PeriodicInstructionOutput{}, at(1, 12, 0))).
+			To(Equal(at(2, 3, 0)))
+		instruction := applyinator.PeriodicInstruction{Schedule: "0 3 * * *", JitterSeconds: 600}
+		t := next(instruction, applyinator.PeriodicInstructionOutput{}, at(1, 12, 0))
+		Expect(t).To(BeTemporally(">=", at(2, 3, 0)))
+		Expect(t).To(BeTemporally("<=", at(2, 3, 10)))
+	})
+
+	It("runs the period after the last successful run", func() {
+		Expect(next(applyinator.PeriodicInstruction{}, ranAt(at(1, 12, 0)), at(1, 12, 1))).To(Equal(at(1, 12, 10)))
+		Expect(next(applyinator.PeriodicInstruction{PeriodSeconds: 3600}, ranAt(at(1, 12, 0)), at(1, 12, 1))).To(Equal(at(1, 13, 0)))
+	})
+
+	DescribeTable("runs on the schedule",
+		func(schedule string, last, expected time.Time) {
+			Expect(next(applyinator.PeriodicInstruction{Schedule: schedule}, ranAt(last), last)).To(Equal(expected))
+		},
+		Entry("daily", "0 3 * * *", at(1, 3, 0), at(2, 3, 0)),
+		Entry("later the same day", "0 3 * * *", at(1, 1, 30), at(1, 3, 0)),
+		Entry("steps", "*/15 * * * *", at(1, 3, 7), at(1, 3, 15)),
+		Entry("lists and ranges", "30 1,22-23 * * *", at(1, 2, 0), at(1, 22, 30)),
+		Entry("day of week", "0 4 * * sat", at(1, 0, 0), at(4, 4, 0)),
+		Entry("day of week 7 is Sunday", "0 4 * * 7", at(1, 0, 0), at(5, 4, 0)),
+		Entry("day of month or day of week", "0 0 15 * 0", at(1, 0, 0), at(5, 0, 0)),
+		Entry("next month", "0 0 1 * *", at(1, 0, 0), time.Date(2025, time.February, 1, 0, 0, 0, 0, time.Local)),
+		Entry("macro", "@weekly", at(1, 0, 0), at(5, 0, 0)),
+	)
+
+	It("delays the scheduled runs by the jitter", func() {
+		instruction := applyinator.PeriodicInstruction{Schedule: "0 3 * * *", JitterSeconds: 600}
+		t := next(instruction, ranAt(at(1, 3, 0)), at(1, 3, 0))
+		Expect(t).To(BeTemporally(">=", at(2, 3, 0)))
+		Expect(t).To(BeTemporally("<=", at(2, 3, 10)))
+		// the jitter does not change each time the next run is computed
+		Expect(next(instruction, ranAt(at(1, 3, 0)), at(1, 18, 0))).To(Equal(t))
+	})
+
+	It("waits for the failure cooldown", func() {
+		po := ranAt(at(1, 3, 0))
+		po.LastFailedRunTime = at(2, 3, 0).Format(time.UnixDate)
+		po.Failures = 2
+		Expect(next(applyinator.PeriodicInstruction{Schedule: "0 3 * * *"}, po, at(2, 3, 0))).To(Equal(at(2, 3, 1)))
+	})
+
+	Context("allowed windows", func() {
+		night := []applyinator.Window{{Start: "22:00", End: "02:00"}}
+
+		It("runs in the next window", func() {
+			instruction := applyinator.PeriodicInstruction{AllowedWindows: night}
+			Expect(next(instruction, applyinator.PeriodicInstructionOutput{}, at(1, 12, 0))).To(Equal(at(1, 22, 0)))
+			Expect(next(instruction, applyinator.PeriodicInstructionOutput{}, at(1, 23, 0))).To(Equal(at(1, 23, 0)))
+			// the window spans midnight
+			Expect(next(instruction, applyinator.PeriodicInstructionOutput{}, at(2, 1, 0))).To(Equal(at(2, 1, 0)))
+			Expect(next(instruction, ranAt(at(2, 1, 55)), at(2, 1, 55))).To(Equal(at(2, 22, 0)))
+		})
+
+		It("runs on the days of the window", func() {
+			instruction := applyinator.PeriodicInstruction{AllowedWindows: []applyinator.Window{
+				{Days: []string{"sat", "sun"}, Start: "02:00", End: "06:00"},
+				{Days: []string{"fri"}, Start: "23:00", End: "23:30"},
+			}}
+			Expect(next(instruction, applyinator.PeriodicInstructionOutput{}, at(1, 12, 0))).To(Equal(at(3, 23, 0)))
+			Expect(next(instruction, applyinator.PeriodicInstructionOutput{}, at(3, 23, 45))).To(Equal(at(4, 2, 0)))
+		})
+
+		It("spreads the runs over the window", func() {
+			instruction := applyinator.PeriodicInstruction{AllowedWindows: night, JitterSeconds: 24 * 3600}
+			t := next(instruction, applyinator.PeriodicInstructionOutput{}, at(1, 12, 0))
+			Expect(t).To(BeTemporally(">=", at(1, 22, 0)))
+			Expect(t).To(BeTemporally("<", at(2, 2, 0)))
+		})
+	})
+
+	DescribeTable("rejects invalid schedules",
+		func(instruction applyinator.PeriodicInstruction, message string) {
+			instruction.Name = "gc"
+			instruction.Command = "crictl"
+			raw, err := json.Marshal(applyinator.Plan{PeriodicInstructions: []applyinator.PeriodicInstruction{instruction}})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = applyinator.CalculatePlan(raw)
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		},
+		Entry("fields", applyinator.PeriodicInstruction{Schedule: "0 3 * *"}, "expected minute, hour"),
+		Entry("range", applyinator.PeriodicInstruction{Schedule: "0 24 * * *"}, "out of the range 0-23"),
+		Entry("never", applyinator.PeriodicInstruction{Schedule: "0 0 30 2 *"}, "never runs"),
+		Entry("period and schedule", applyinator.PeriodicInstruction{Schedule: "@daily", PeriodSeconds: 60}, "either a period or a schedule"),
+		Entry("window", applyinator.PeriodicInstruction{AllowedWindows: []applyinator.Window{{Start: "25:00", End: "02:00"}}}, "not a HH:MM time"),
+		Entry("day", applyinator.PeriodicInstruction{AllowedWindows: []applyinator.Window{{Days: []string{"someday"}, Start: "01:00", End: "02:00"}}}, "invalid day"),
+	)
+
+	It("reports the next run and does not run scheduled instructions when the plan is applied", func() {
+		dir := GinkgoT().TempDir()
+		a := applyinator.NewApplyinator(filepath.Join(dir, "work"), false, "", "", nil)
+		raw, err := json.Marshal(applyinator.Plan{PeriodicInstructions: []applyinator.PeriodicInstruction{{
+			CommonInstruction: applyinator.CommonInstruction{Name: "gc", Command: "/bin/true"},
+			Schedule:          "0 3 * * *",
+		}}})
+		Expect(err).NotTo(HaveOccurred())
+		plan, err := applyinator.CalculatePlan(raw)
+		Expect(err).NotTo(HaveOccurred())
+
+		apply := func(existing []byte) ([]byte, applyinator.PeriodicInstructionOutput) {
+			output, err := a.Apply(context.Background(), applyinator.ApplyInput{
+				CalculatedPlan:         plan,
+				RunOneTimeInstructions: true,
+				ExistingPeriodicOutput: existing,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			gz, err := gzip.NewReader(bytes.NewReader(output.PeriodicOutput))
+			Expect(err).NotTo(HaveOccurred())
+			decompressed, err := io.ReadAll(gz)
+			Expect(err).NotTo(HaveOccurred())
+			outputs := map[string]applyinator.PeriodicInstructionOutput{}
+			Expect(json.Unmarshal(decompressed, &outputs)).To(Succeed())
+			return output.PeriodicOutput, outputs["gc"]
+		}
+
+		existing, first := apply(nil)
+		Expect(first.LastSuccessfulRunTime).To(BeEmpty())
+		nextRun, err := time.Parse(time.UnixDate, first.NextRunTime)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nextRun.In(time.Local).Hour()).To(Equal(3))
+		Expect(nextRun).To(BeTemporally(">", time.Now()))
+
+		_, second := apply(existing)
+		Expect(second.LastSuccessfulRunTime).To(BeEmpty())
+		Expect(second.NextRunTime).To(Equal(first.NextRunTime))
+	})
+})
@@ -0,0 +1,60 @@
+package applyinator
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/llmos-ai/llmos/pkg/utils/signature"
+)
+
+// CalculateSignedPlan verifies the detached signature of the plan content against the trusted keys and calculates
+// the plan. The content is the plan as it was signed, JSON or YAML.
+func CalculateSignedPlan(content, sig []byte, trust *signature.TrustStore) (CalculatedPlan, error) {
+	keyName, err := trust.Verify(content, sig)
+	if err != nil {
+		return CalculatedPlan{}, err
+	}
+
+	rawPlan := content
+	if !json.Valid(rawPlan) {
+		if rawPlan, err = yaml.YAMLToJSON(content); err != nil {
+			return CalculatedPlan{}, err
+		}
+	}
+	cp, err := CalculatePlan(rawPlan)
+	if err != nil {
+		return cp, err
+	}
+	cp.SignedBy = keyName
+	cp.signed = []signedContent{{content: content, signature: sig}}
+	return cp, nil
+}
+
+type signedContent struct {
+	content   []byte
+	signature []byte
+}
+
+// SetTrustStore enforces that the applied plans are signed with one of the keys of the trust store.
+func (a *Applyinator) SetTrustStore(trust *signature.TrustStore) {
+	a.trust = trust
+}
+
+// verifySignature checks the signature of the plan again if signatures are enforced, so that only plans
+// calculated from content signed with a key the applyinator trusts are applied.
+func (a *Applyinator) verifySignature(cp CalculatedPlan) error {
+	if a.trust == nil {
+		return nil
+	}
+	if len(cp.signed) == 0 {
+		return fmt.Errorf("refusing to apply plan %s: %w", cp.Checksum, signature.ErrUnsigned)
+	}
+	for _, signed := range cp.signed {
+		if _, err := a.trust.Verify(signed.content, signed.signature); err != nil {
+			return fmt.Errorf("refusing to apply plan %s: %w", cp.Checksum, err)
+		}
+	}
+	return nil
+}
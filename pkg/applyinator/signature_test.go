@@ -0,0 +1,110 @@
+package applyinator_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/llmos-ai/llmos/pkg/applyinator"
+	"github.com/llmos-ai/llmos/pkg/utils/signature"
+)
+
+var _ = Describe("signed plans", Label("applyinator", "signature"), func() {
+	var (
+		dir   string
+		trust *signature.TrustStore
+		sign  func([]byte) []byte
+		a     *applyinator.Applyinator
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		Expect(signature.GenerateKey(filepath.Join(dir, "trust", "ops.key"))).To(Succeed())
+		key, err := signature.LoadPrivateKey(filepath.Join(dir, "trust", "ops.key"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.Remove(filepath.Join(dir, "trust", "ops.key"))).To(Succeed())
+		trust, err = signature.LoadTrustStore(filepath.Join(dir, "trust"))
+		Expect(err).NotTo(HaveOccurred())
+		sign = func(content []byte) []byte { return signature.Sign(content, key) }
+
+		a = applyinator.NewApplyinator(filepath.Join(dir, "work"), false, "", "", nil)
+		a.SetTrustStore(trust)
+	})
+
+	It("applies a YAML plan signed with a trusted key", func() {
+		content := []byte("files:\n- path: " + filepath.Join(dir, "sysctl.conf") + "\n  content: vm.swappiness=0\n  encoding: plain\n")
+		plan, err := applyinator.CalculateSignedPlan(content, sign(content), trust)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan.SignedBy).To(Equal("ops"))
+
+		_, err = a.Apply(context.Background(), applyinator.ApplyInput{CalculatedPlan: plan, ReconcileFiles: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.ReadFile(filepath.Join(dir, "sysctl.conf"))).To(Equal([]byte("vm.swappiness=0")))
+	})
+
+	It("rejects a tampered plan", func() {
+		content := []byte(`{"instructions":[{"name":"sysctl","command":"sysctl"}]}`)
+		sig := sign(content)
+		_, err := applyinator.CalculateSignedPlan([]byte(`{"instructions":[{"name":"sysctl","command":"sh"}]}`), sig, trust)
+		Expect(err).To(MatchError(ContainSubstring("does not match a trusted key")))
+	})
+
+	It("refuses to apply an unsigned plan when signatures are enforced", func() {
+		raw, err := json.Marshal(applyinator.Plan{Files: []applyinator.File{{Path: filepath.Join(dir, "unsigned")}}})
+		Expect(err).NotTo(HaveOccurred())
+		plan, err := applyinator.CalculatePlan(raw)
+		Expect(err).NotTo(HaveOccurred())
+		// a forged key name does not make the plan signed
+		plan.SignedBy = "ops"
+
+		_, err = a.Apply(context.Background(), applyinator.ApplyInput{CalculatedPlan: plan, ReconcileFiles: true})
+		Expect(err).To(MatchError(signature.ErrUnsigned))
+		Expect(filepath.Join(dir, "unsigned")).NotTo(BeAnExistingFile())
+	})
+
+	It("applies a signed plan of the history again with its sensitive content", func() {
+		path := filepath.Join(dir, "token")
+		content := []byte("files:\n- path: " + path + "\n  content: secret\n  encoding: plain\n  sensitive: true\n")
+		plan, err := applyinator.CalculateSignedPlan(content, sign(content), trust)
+		Expect(err).NotTo(HaveOccurred())
+		a = applyinator.NewApplyinator(filepath.Join(dir, "work"), false, filepath.Join(dir, "applied"), "", nil)
+		a.SetTrustStore(trust)
+		_, err = a.Apply(context.Background(), applyinator.ApplyInput{CalculatedPlan: plan, ReconcileFiles: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.WriteFile(path, []byte("changed"), 0600)).To(Succeed())
+
+		applied, err := applyinator.ReadAppliedPlans(filepath.Join(dir, "applied"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(applied).To(HaveLen(1))
+		Expect(applied[0].Plan.Redacted).To(BeTrue())
+		original, err := applied[0].Original()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(original.Checksum).To(Equal(plan.Checksum))
+		Expect(original.SignedBy).To(Equal("ops"))
+
+		_, err = a.Apply(context.Background(), applyinator.ApplyInput{CalculatedPlan: original, ReconcileFiles: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.ReadFile(path)).To(Equal([]byte("secret")))
+	})
+
+	It("does not record the content of unsigned plans in the history", func() {
+		raw, err := json.Marshal(applyinator.Plan{Files: []applyinator.File{{Path: filepath.Join(dir, "unsigned")}}})
+		Expect(err).NotTo(HaveOccurred())
+		plan, err := applyinator.CalculatePlan(raw)
+		Expect(err).NotTo(HaveOccurred())
+		a = applyinator.NewApplyinator(filepath.Join(dir, "work"), false, filepath.Join(dir, "applied"), "", nil)
+		_, err = a.Apply(context.Background(), applyinator.ApplyInput{CalculatedPlan: plan})
+		Expect(err).NotTo(HaveOccurred())
+
+		applied, err := applyinator.ReadAppliedPlans(filepath.Join(dir, "applied"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(applied).To(HaveLen(1))
+		Expect(applied[0].Signed).To(BeEmpty())
+		_, err = applied[0].Original()
+		Expect(err).To(MatchError(ContainSubstring("does not record the sensitive values")))
+	})
+})
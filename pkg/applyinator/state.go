@@ -0,0 +1,165 @@
+package applyinator
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// InstructionState is the execution state of a one-time instruction.
+type InstructionState string
+
+const (
+	InstructionPending   InstructionState = "pending"
+	InstructionRunning   InstructionState = "running"
+	InstructionSucceeded InstructionState = "succeeded"
+	InstructionFailed    InstructionState = "failed"
+	InstructionSkipped   InstructionState = "skipped"
+)
+
+// InstructionStatus is the recorded progress of a single one-time instruction.
+type InstructionStatus struct {
+	State      InstructionState `json:"state"`
+	Attempts   int              `json:"attempts,omitempty"`   // Attempts is the number of times the instruction was run for the plan
+	ExitCode   int              `json:"exitCode"`             // ExitCode is the exit code of the last attempt
+	StartTime  string           `json:"startTime,omitempty"`  // StartTime is a time.UnixDate formatted string of when the last attempt started
+	FinishTime string           `json:"finishTime,omitempty"` // FinishTime is a time.UnixDate formatted string of when the last attempt finished
+}
+
+// PlanState is the per-instruction completion record of a plan, keyed by instruction name.
+// It is only valid for the plan with the recorded checksum.
+type PlanState struct {
+	Checksum     string                       `json:"checksum"`
+	Instructions map[string]InstructionStatus `json:"instructions"`
+}
+
+// ReadPlanState reads the plan state from path, an empty state is returned if the file does not exist.
+func ReadPlanState(path string) (*PlanState, error) {
+	state := &PlanState{
+		Instructions: map[string]InstructionStatus{},
+	}
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, state); err != nil {
+		return nil, err
+	}
+	if state.Instructions == nil {
+		state.Instructions = map[string]InstructionStatus{}
+	}
+	return state, nil
+}
+
+// Succeeded returns true if the named instruction already completed successfully.
+func (s *PlanState) Succeeded(name string) bool {
+	status, ok := s.Instructions[name]
+	return ok && status.State == InstructionSucceeded
+}
+
+// planStateRecorder keeps the plan state file in sync while one-time instructions are running.
+type planStateRecorder struct {
+	mu    sync.Mutex
+	path  string
+	state *PlanState
+}
+
+func newPlanStateRecorder(path, checksum string) (*planStateRecorder, error) {
+	r := &planStateRecorder{path: path}
+	if path == "" {
+		r.state = &PlanState{Checksum: checksum, Instructions: map[string]InstructionStatus{}}
+		return r, nil
+	}
+
+	state, err := ReadPlanState(path)
+	if err != nil {
+		return nil, err
+	}
+	if state.Checksum != checksum {
+		logrus.Debugf("[Applyinator] Plan checksum changed from %s to %s, resetting plan state %s", state.Checksum, checksum, path)
+		state = &PlanState{Checksum: checksum, Instructions: map[string]InstructionStatus{}}
+	}
+	r.state = state
+	return r, r.write()
+}
+
+func (r *planStateRecorder) succeeded(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return name != "" && r.state.Succeeded(name)
+}
+
+func (r *planStateRecorder) start(name string, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if name == "" {
+		return
+	}
+	status := r.state.Instructions[name]
+	status.State = InstructionRunning
+	status.Attempts++
+	status.StartTime = now.Format(time.UnixDate)
+	status.FinishTime = ""
+	r.state.Instructions[name] = status
+	r.save()
+}
+
+func (r *planStateRecorder) finish(name string, exitCode int, succeeded bool, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if name == "" {
+		return
+	}
+	status := r.state.Instructions[name]
+	status.State = InstructionFailed
+	if succeeded {
+		status.State = InstructionSucceeded
+	}
+	status.ExitCode = exitCode
+	status.FinishTime = now.Format(time.UnixDate)
+	r.state.Instructions[name] = status
+	r.save()
+}
+
+// skip records that the named instruction was skipped as its when expression was false.
+func (r *planStateRecorder) skip(name string, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if name == "" {
+		return
+	}
+	status := r.state.Instructions[name]
+	status.State = InstructionSkipped
+	status.FinishTime = now.Format(time.UnixDate)
+	r.state.Instructions[name] = status
+	r.save()
+}
+
+// reset forgets the progress of the named instruction so that it is run again.
+func (r *planStateRecorder) reset(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.state.Instructions, name)
+}
+
+func (r *planStateRecorder) save() {
+	if err := r.write(); err != nil {
+		logrus.Errorf("error writing plan state file %s: %v", r.path, err)
+	}
+}
+
+func (r *planStateRecorder) write() error {
+	if r.path == "" {
+		return nil
+	}
+	content, err := json.Marshal(r.state)
+	if err != nil {
+		return err
+	}
+	return writeContentToFile(r.path, os.Getuid(), os.Getgid(), 0600, content)
+}
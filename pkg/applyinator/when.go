@@ -0,0 +1,100 @@
+package applyinator
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// Facts are the node facts the `when` expressions of instructions are evaluated against,
+// e.g. `role == "agent" && file.exists("/dev/nvidia0")`.
+type Facts map[string]interface{}
+
+// HostFacts returns the facts discovered from the host the applyinator is running on.
+func HostFacts() Facts {
+	hostname, _ := os.Hostname()
+	return Facts{
+		"arch":     runtime.GOARCH,
+		"os":       runtime.GOOS,
+		"hostname": hostname,
+	}
+}
+
+// withHostFacts returns the host facts overridden by the given facts.
+func withHostFacts(facts Facts) Facts {
+	result := HostFacts()
+	for k, v := range facts {
+		result[k] = v
+	}
+	return result
+}
+
+// fileFunctions declares the `file.exists(path)` function.
+func fileFunctions() cel.EnvOption {
+	return cel.Function("file.exists",
+		cel.Overload("file_exists_string", []*cel.Type{cel.StringType}, cel.BoolType,
+			cel.UnaryBinding(func(path ref.Val) ref.Val {
+				p, ok := path.Value().(string)
+				if !ok {
+					return types.MaybeNoSuchOverloadErr(path)
+				}
+				_, err := os.Stat(p)
+				return types.Bool(err == nil)
+			}),
+		),
+	)
+}
+
+// validateWhen checks the syntax of a `when` expression, the referenced facts are only known when it is evaluated.
+func validateWhen(expression string) error {
+	env, err := cel.NewEnv(fileFunctions())
+	if err != nil {
+		return err
+	}
+	if _, iss := env.Parse(expression); iss.Err() != nil {
+		return fmt.Errorf("invalid when expression %q: %w", expression, iss.Err())
+	}
+	return nil
+}
+
+// evaluateWhen evaluates the `when` expression against the facts, an empty expression is always true.
+func evaluateWhen(expression string, facts Facts) (bool, error) {
+	if expression == "" {
+		return true, nil
+	}
+
+	opts := []cel.EnvOption{fileFunctions()}
+	for name := range facts {
+		opts = append(opts, cel.Variable(name, cel.DynType))
+	}
+	env, err := cel.NewEnv(opts...)
+	if err != nil {
+		return false, err
+	}
+
+	ast, iss := env.Compile(expression)
+	if iss.Err() != nil {
+		return false, fmt.Errorf("compiling when expression %q: %w", expression, iss.Err())
+	}
+	if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+		return false, fmt.Errorf("when expression %q must evaluate to a bool, not %s", expression, ast.OutputType())
+	}
+
+	program, err := env.Program(ast)
+	if err != nil {
+		return false, err
+	}
+	result, _, err := program.Eval(map[string]interface{}(facts))
+	if err != nil {
+		return false, fmt.Errorf("evaluating when expression %q: %w", expression, err)
+	}
+	value, ok := result.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("when expression %q must evaluate to a bool, not %v", expression, result.Type())
+	}
+	return value, nil
+}
@@ -0,0 +1,47 @@
+package applyinator_test
+
+import (
+	"context"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/llmos-ai/llmos/pkg/applyinator"
+)
+
+func conditional(name, script, when string) applyinator.OneTimeInstruction {
+	inst := instruction(name, script)
+	inst.When = when
+	return inst
+}
+
+var _ = Describe("instruction when expressions", Label("applyinator", "when"), func() {
+	It("rejects invalid expressions", func() {
+		_, err := calculate(conditional("a", "true", "role =="))
+		Expect(err).To(MatchError(ContainSubstring("invalid one-time instruction a")))
+	})
+
+	It("skips instructions whose expression is false", func() {
+		dir := GinkgoT().TempDir()
+		marker := filepath.Join(dir, "marker")
+
+		plan, err := calculate(
+			conditional("server-only", "touch "+marker+".server", `role == "server"`),
+			conditional("agent-only", "touch "+marker+".agent", `role == "agent" && !file.exists("/nonexistent")`),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		a := applyinator.NewApplyinator(filepath.Join(dir, "work"), false, "", "", nil)
+		output, err := a.Apply(context.Background(), applyinator.ApplyInput{
+			CalculatedPlan:         plan,
+			RunOneTimeInstructions: true,
+			Facts:                  applyinator.Facts{"role": "agent"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output.OneTimeApplySucceeded).To(BeTrue())
+
+		Expect(marker + ".server").NotTo(BeAnExistingFile())
+		Expect(marker + ".agent").To(BeAnExistingFile())
+	})
+})
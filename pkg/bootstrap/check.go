@@ -13,6 +13,7 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/llmos-ai/llmos/pkg/bootstrap/config"
+	"github.com/llmos-ai/llmos/pkg/cli/probe"
 )
 
 func mergeConfigs(cfg Config, result config.Config) config.Config {
@@ -68,6 +69,18 @@ func validateConfig(cfg *config.Config) error {
 		return fmt.Errorf("server URL is defined but token is not, skipping bootstrap")
 	}
 
+	if err := probe.ValidateConfigProbes(cfg.Probes); err != nil {
+		return err
+	}
+
+	if err := cfg.Encryption.Validate(); err != nil {
+		return fmt.Errorf("invalid encryption config: %w", err)
+	}
+
+	if err := cfg.PlanSignature.Validate(); err != nil {
+		return fmt.Errorf("invalid plan signature config: %w", err)
+	}
+
 	return nil
 }
 
@@ -15,6 +15,9 @@ import (
 
 	"github.com/llmos-ai/llmos/pkg/applyinator"
 	"github.com/llmos-ai/llmos/pkg/applyinator/image"
+	"github.com/llmos-ai/llmos/pkg/applyinator/prober"
+	"github.com/llmos-ai/llmos/pkg/utils/crypt"
+	"github.com/llmos-ai/llmos/pkg/utils/signature"
 )
 
 var (
@@ -54,12 +57,28 @@ type Config struct {
 	PreInstructions     []applyinator.OneTimeInstruction `json:"preInstructions,omitempty"`
 	PostInstructions    []applyinator.OneTimeInstruction `json:"postInstructions,omitempty"`
 	Resources           []GenericMap                     `json:"manifest,omitempty"`
+	// InstructionConcurrency is the maximum number of plan instructions run in parallel
+	InstructionConcurrency int `json:"instructionConcurrency,omitempty"`
+	// Probes are added to the node plan next to the built-in probes, the bootstrap waits for them to be healthy
+	Probes map[string]ProbeConfig `json:"probes,omitempty"`
 
 	RuntimeInstallerImage string               `json:"runtimeInstallerImage,omitempty"`
 	LLMOSInstallerImage   string               `json:"llmosInstallerImage,omitempty"`
 	GlobalImageRegistry   string               `json:"globalImageRegistry,omitempty"`
 	Registries            *registries.Registry `json:"registries,omitempty"`
 	ImageUtility          *image.Utility       `json:"imageUtility,omitempty"`
+	// Encryption encrypts the plan files and stamps under the data dir
+	Encryption *crypt.Config `json:"encryption,omitempty"`
+	// PlanSignature enforces signed plans for `llmos plan apply`
+	PlanSignature *signature.Config `json:"planSignature,omitempty"`
+}
+
+// ProbeConfig is a plan probe declared in the config file. Roles limits the probe to the nodes with one of the
+// roles, either a node role (cluster-init, server, agent) or a component (etcd, control-plane, worker).
+// A %s in the file paths and the command of the probe is replaced by the kubernetes runtime, e.g. k3s.
+type ProbeConfig struct {
+	prober.Probe
+	Roles []string `json:"roles,omitempty"`
 }
 
 func paths() (result []string) {
@@ -21,6 +21,8 @@ import (
 const (
 	helmAPIVersion     = "helm.cattle.io/v1"
 	helmConfigKindName = "HelmChartConfig"
+
+	installInstructionName = "install-llmos-operator"
 )
 
 var defaultValues = map[string]interface{}{
@@ -80,7 +82,7 @@ func ToInstruction(imageOverride, systemDefaultRegistry, k8sVersion,
 	operatorVersion string) (*applyinator.OneTimeInstruction, error) {
 	return &applyinator.OneTimeInstruction{
 		CommonInstruction: applyinator.CommonInstruction{
-			Name:  "install-llmos-operator",
+			Name:  installInstructionName,
 			Image: images.GetLLMOSInstallerImage(imageOverride, systemDefaultRegistry, operatorVersion),
 			Env:   kubectl.Env(k8sVersion),
 		},
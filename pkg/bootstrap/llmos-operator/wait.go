@@ -25,6 +25,8 @@ func ToWaitOperatorInstruction(k8sVersion string) (*applyinator.OneTimeInstructi
 			Command: cmd,
 		},
 		SaveOutput: true,
+		// the rollouts are independent of each other and can be waited for in parallel
+		DependsOn: []string{installInstructionName},
 	}, nil
 }
 
@@ -42,6 +44,8 @@ func ToWaitOperatorWebhookInstruction(k8sVersion string) (*applyinator.OneTimeIn
 			Command: cmd,
 		},
 		SaveOutput: true,
+		// the rollouts are independent of each other and can be waited for in parallel
+		DependsOn: []string{installInstructionName},
 	}, nil
 }
 
@@ -59,5 +63,7 @@ func ToWaitSUCInstruction(_, _, k8sVersion string) (*applyinator.OneTimeInstruct
 			Command: cmd,
 		},
 		SaveOutput: true,
+		// the rollouts are independent of each other and can be waited for in parallel
+		DependsOn: []string{installInstructionName},
 	}, nil
 }
@@ -49,7 +49,7 @@ func ToBootstrapFile(config *llmosCfg.Config, path string, runtime llmosCfg.Runt
 	}
 
 	resources := config.Resources
-	return ToFile(append(resources,
+	file, err := ToFile(append(resources,
 		llmosCfg.GenericMap{
 			Data: map[string]interface{}{
 				"kind":       "Node",
@@ -90,6 +90,12 @@ func ToBootstrapFile(config *llmosCfg.Config, path string, runtime llmosCfg.Runt
 				},
 			},
 		}), path)
+	if err != nil {
+		return nil, err
+	}
+	// the manifests contain the cluster token secret
+	file.Sensitive = true
+	return file, nil
 }
 func ToFile(resources []llmosCfg.GenericMap, path string) (*applyinator.File, error) {
 	if len(resources) == 0 {
@@ -3,10 +3,13 @@ package plan
 import (
 	"context"
 	"fmt"
+	"slices"
+	"sort"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/llmos-ai/llmos/pkg/applyinator"
+	"github.com/llmos-ai/llmos/pkg/applyinator/prober"
 	"github.com/llmos-ai/llmos/pkg/bootstrap/config"
 	"github.com/llmos-ai/llmos/pkg/bootstrap/kubectl"
 	operator "github.com/llmos-ai/llmos/pkg/bootstrap/llmos-operator"
@@ -31,11 +34,11 @@ func toInitPlan(cfg *config.Config, dataDir string) (*applyinator.Plan, error) {
 		return nil, err
 	}
 
-	if err := p.addInstructions(cfg, dataDir, true); err != nil {
+	if err := p.addProbes(cfg); err != nil {
 		return nil, err
 	}
 
-	if err := p.addProbes(cfg); err != nil {
+	if err := p.addInstructions(cfg, dataDir, true); err != nil {
 		return nil, err
 	}
 
@@ -67,19 +70,14 @@ func toJoinPlan(cfg *config.Config, dataDir string) (*applyinator.Plan, error) {
 		return nil, err
 	}
 
+	// add join probes
+	p.addProbesForJoin(cfg)
+
 	// add join instructions
 	if err := p.addInstructions(cfg, dataDir, false); err != nil {
 		return nil, err
 	}
 
-	// add probe instruction
-	if err := p.addInstruction(probe.ToInstruction()); err != nil {
-		return nil, err
-	}
-
-	// add join probes
-	p.addProbesForJoin(cfg)
-
 	return (*applyinator.Plan)(&p), nil
 }
 
@@ -103,14 +101,21 @@ func (p *plan) addInstructions(cfg *config.Config, dataDir string, initRole bool
 		return err
 	}
 
-	// add probe instruction
-	if err = p.addInstruction(probe.ToInstruction()); err != nil {
+	// add probe instruction, the probes from the config are waited for once the node is ready
+	var builtinProbes []string
+	if len(cfg.Probes) > 0 {
+		builtinProbes = p.probeNames()
+	}
+	if err = p.addInstruction(probe.ToInstruction("probes", builtinProbes...)); err != nil {
 		return err
 	}
 
 	if cfg.Role != config.AgentRole {
-		// Copy kubeconfig for cluster-init and server node
-		if err = p.addInstruction(runtime.CopyKubeConfigInstruction(k8sVersion)); err != nil {
+		// Link kubeconfig for cluster-init and server node
+		if err = p.addFile(runtime.ToConfigDirectory()); err != nil {
+			return err
+		}
+		if err = p.addFile(runtime.ToKubeConfigSymlink(k8sVersion)); err != nil {
 			return err
 		}
 	}
@@ -168,30 +173,75 @@ func (p *plan) addInstructions(cfg *config.Config, dataDir string, initRole bool
 		}
 	}
 
+	if err = p.addConfigProbes(cfg, k8sVersion); err != nil {
+		return err
+	}
+
 	p.addPrePostInstructions(cfg, k8sVersion)
 	return nil
 }
 
+// addPrePostInstructions adds the pre- and post-instructions from the config around the generated instructions
+// and wires up the dependencies between them. Pre-instructions without dependencies run in the order of the config
+// before the generated instructions, which run in order unless they declare their own dependencies. Post-instructions
+// without dependencies run in order once all generated instructions are done. Instructions declaring their
+// dependencies run in parallel with the others.
 func (p *plan) addPrePostInstructions(cfg *config.Config, k8sVersion string) {
-	var instructions = make([]applyinator.OneTimeInstruction, 0)
+	var (
+		instructions = make([]applyinator.OneTimeInstruction, 0)
+		// frontier is the set of instructions no other instruction depends on yet
+		frontier []string
+	)
 
-	for _, inst := range cfg.PreInstructions {
+	for i, inst := range cfg.PreInstructions {
 		if k8sVersion != "" {
 			inst.Env = append(inst.Env, kubectl.Env(k8sVersion)...)
 		}
+		if inst.Name == "" {
+			inst.Name = fmt.Sprintf("pre-instruction-%d", i)
+		}
+		if len(inst.DependsOn) == 0 && i > 0 {
+			inst.DependsOn = []string{instructions[i-1].Name}
+		}
+		frontier = advanceFrontier(frontier, inst)
 		instructions = append(instructions, inst)
 	}
 
-	instructions = append(instructions, p.OneTimeInstructions...)
+	for _, inst := range p.OneTimeInstructions {
+		if len(inst.DependsOn) == 0 {
+			inst.DependsOn = frontier
+		}
+		frontier = advanceFrontier(frontier, inst)
+		instructions = append(instructions, inst)
+	}
 
-	for _, inst := range cfg.PostInstructions {
+	previous := frontier
+	for i, inst := range cfg.PostInstructions {
 		inst.Env = append(inst.Env, kubectl.Env(k8sVersion)...)
+		if inst.Name == "" {
+			inst.Name = fmt.Sprintf("post-instruction-%d", i)
+		}
+		if len(inst.DependsOn) == 0 {
+			inst.DependsOn = previous
+		}
+		previous = []string{inst.Name}
 		instructions = append(instructions, inst)
 	}
 
 	p.OneTimeInstructions = instructions
 }
 
+// advanceFrontier removes the dependencies of the instruction from the frontier and adds the instruction itself.
+func advanceFrontier(frontier []string, inst applyinator.OneTimeInstruction) []string {
+	result := make([]string, 0, len(frontier)+1)
+	for _, name := range frontier {
+		if !slices.Contains(inst.DependsOn, name) {
+			result = append(result, name)
+		}
+	}
+	return append(result, inst.Name)
+}
+
 func (p *plan) addInstruction(instruction *applyinator.OneTimeInstruction, err error) error {
 	if err != nil || instruction == nil {
 		return err
@@ -277,3 +327,34 @@ func (p *plan) addProbes(cfg *config.Config) error {
 	p.Probes = probe.AllProbes(config.GetRuntime(k8sVersion))
 	return nil
 }
+
+// addConfigProbes adds the probes declared in the config for the role of the node to the plan,
+// and an instruction that waits for them to be healthy.
+func (p *plan) addConfigProbes(cfg *config.Config, k8sVersion string) error {
+	configProbes := probe.ConfigProbes(cfg, config.GetRuntime(k8sVersion))
+	if len(configProbes) == 0 {
+		return nil
+	}
+
+	if p.Probes == nil {
+		p.Probes = map[string]prober.Probe{}
+	}
+	names := make([]string, 0, len(configProbes))
+	for name, configProbe := range configProbes {
+		p.Probes[name] = configProbe
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return p.addInstruction(probe.ToInstruction("config-probes", names...))
+}
+
+// probeNames returns the sorted names of the probes in the plan.
+func (p *plan) probeNames() []string {
+	names := make([]string, 0, len(p.Probes))
+	for name := range p.Probes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,75 @@
+package plan_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/llmos-ai/llmos/pkg/applyinator"
+	"github.com/llmos-ai/llmos/pkg/bootstrap/config"
+	"github.com/llmos-ai/llmos/pkg/bootstrap/plan"
+)
+
+// agentConfig returns the config of an agent joining a cluster, its plan is generated without network access.
+func agentConfig() config.Config {
+	cfg := config.Config{}
+	cfg.Role = config.AgentRole
+	cfg.Server = "https://10.0.0.1:6443"
+	cfg.Token = "K10-s3cr3t-token"
+	cfg.KubernetesVersion = "v1.30.2+k3s1"
+	return cfg
+}
+
+func command(name string, dependsOn ...string) applyinator.OneTimeInstruction {
+	return applyinator.OneTimeInstruction{
+		CommonInstruction: applyinator.CommonInstruction{Name: name, Command: "true"},
+		DependsOn:         dependsOn,
+	}
+}
+
+var _ = Describe("bootstrap plan", Label("plan", "bootstrap"), func() {
+	dependencies := func(p *applyinator.Plan) map[string][]string {
+		result := map[string][]string{}
+		for _, instruction := range p.OneTimeInstructions {
+			result[instruction.Name] = instruction.DependsOn
+		}
+		return result
+	}
+
+	It("runs the pre- and post-instructions without dependencies in the order of the config", func() {
+		cfg := agentConfig()
+		cfg.PreInstructions = []applyinator.OneTimeInstruction{command("mount-disks"), command("")}
+		cfg.PostInstructions = []applyinator.OneTimeInstruction{command("label-node"), command("")}
+
+		p, err := plan.ToPlan(context.Background(), &cfg, "/var/lib/llmos")
+		Expect(err).NotTo(HaveOccurred())
+
+		names := make([]string, 0, len(p.OneTimeInstructions))
+		for _, instruction := range p.OneTimeInstructions {
+			names = append(names, instruction.Name)
+		}
+		Expect(names).To(Equal([]string{"mount-disks", "pre-instruction-1", "install-k3s", "probes",
+			"wait-agent-node-ready", "label-node", "post-instruction-1"}))
+		deps := dependencies(p)
+		Expect(deps["mount-disks"]).To(BeEmpty())
+		Expect(deps["pre-instruction-1"]).To(Equal([]string{"mount-disks"}))
+		Expect(deps["install-k3s"]).To(Equal([]string{"pre-instruction-1"}))
+		Expect(deps["label-node"]).To(Equal([]string{"wait-agent-node-ready"}))
+		Expect(deps["post-instruction-1"]).To(Equal([]string{"label-node"}))
+	})
+
+	It("runs the pre-instructions declaring their dependencies in parallel", func() {
+		cfg := agentConfig()
+		cfg.PreInstructions = []applyinator.OneTimeInstruction{
+			command("mount-disks"), command("pull-images", "mount-disks"), command("load-modules", "mount-disks"),
+		}
+
+		p, err := plan.ToPlan(context.Background(), &cfg, "/var/lib/llmos")
+		Expect(err).NotTo(HaveOccurred())
+		deps := dependencies(p)
+		Expect(deps["pull-images"]).To(Equal([]string{"mount-disks"}))
+		Expect(deps["load-modules"]).To(Equal([]string{"mount-disks"}))
+		Expect(deps["install-k3s"]).To(Equal([]string{"pull-images", "load-modules"}))
+	})
+})
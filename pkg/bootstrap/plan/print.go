@@ -0,0 +1,197 @@
+package plan
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/llmos-ai/llmos/pkg/applyinator"
+	"github.com/llmos-ai/llmos/pkg/applyinator/prober"
+)
+
+// Print writes a human-readable rendering of the plan to w. File contents are decoded,
+// and instructions are listed in the order the applyinator would run them.
+func Print(w io.Writer, p *applyinator.Plan) error {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "Files (%d):\n", len(p.Files))
+	for _, file := range p.Files {
+		printFile(&buf, file)
+	}
+
+	fmt.Fprintf(&buf, "\nInstructions (%d):\n", len(p.OneTimeInstructions))
+	for i, instruction := range p.OneTimeInstructions {
+		fmt.Fprintf(&buf, "  %d. %s\n", i+1, instruction.Name)
+		printInstruction(&buf, instruction.CommonInstruction)
+		if instruction.When != "" {
+			fmt.Fprintf(&buf, "     when: %s\n", instruction.When)
+		}
+		if len(instruction.DependsOn) > 0 {
+			fmt.Fprintf(&buf, "     dependsOn: %s\n", strings.Join(instruction.DependsOn, ", "))
+		}
+		fmt.Fprintf(&buf, "     saveOutput: %t\n", instruction.SaveOutput)
+	}
+
+	if len(p.PeriodicInstructions) > 0 {
+		fmt.Fprintf(&buf, "\nPeriodic Instructions (%d):\n", len(p.PeriodicInstructions))
+		for i, instruction := range p.PeriodicInstructions {
+			if instruction.Schedule != "" {
+				fmt.Fprintf(&buf, "  %d. %s (schedule %q)\n", i+1, instruction.Name, instruction.Schedule)
+			} else {
+				fmt.Fprintf(&buf, "  %d. %s (every %ds)\n", i+1, instruction.Name, instruction.PeriodSeconds)
+			}
+			printInstruction(&buf, instruction.CommonInstruction)
+			if instruction.When != "" {
+				fmt.Fprintf(&buf, "     when: %s\n", instruction.When)
+			}
+			if instruction.JitterSeconds > 0 {
+				fmt.Fprintf(&buf, "     jitter: %ds\n", instruction.JitterSeconds)
+			}
+			for _, window := range instruction.AllowedWindows {
+				days := "every day"
+				if len(window.Days) > 0 {
+					days = strings.Join(window.Days, ",")
+				}
+				fmt.Fprintf(&buf, "     allowed window: %s-%s %s\n", window.Start, window.End, days)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(p.Probes))
+	for name := range p.Probes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(&buf, "\nProbes (%d):\n", len(p.Probes))
+	for _, name := range names {
+		probe := p.Probes[name]
+		fmt.Fprintf(&buf, "  - %s: %s\n", name, probeAction(probe))
+		fmt.Fprintf(&buf, "     initialDelay: %ds, timeout: %ds, successThreshold: %d, failureThreshold: %d\n",
+			probe.InitialDelaySeconds, probe.TimeoutSeconds, probe.SuccessThreshold, probe.FailureThreshold)
+		if action := probe.HTTPGetAction; action != nil {
+			if action.CACert != "" {
+				fmt.Fprintf(&buf, "     caCert: %s\n", action.CACert)
+			}
+			if action.ClientCert != "" {
+				fmt.Fprintf(&buf, "     clientCert: %s, clientKey: %s\n", action.ClientCert, action.ClientKey)
+			}
+			if action.Insecure {
+				fmt.Fprintf(&buf, "     insecure: true\n")
+			}
+		}
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func printFile(buf *bytes.Buffer, file applyinator.File) {
+	switch {
+	case file.State == applyinator.FileStateAbsent:
+		fmt.Fprintf(buf, "  - %s (absent)\n", file.Path)
+		return
+	case file.Symlink != "":
+		fmt.Fprintf(buf, "  - %s -> %s (symlink)\n", file.Path, file.Symlink)
+		return
+	}
+	if file.Directory {
+		fmt.Fprintf(buf, "  - %s/ (directory, permissions: %s, %s)\n",
+			strings.TrimSuffix(file.Path, "/"), orDefault(file.Permissions, "0755"), ownership(file))
+		return
+	}
+
+	attributes := []string{ownership(file)}
+	if file.Template {
+		attributes = append(attributes, "template")
+	}
+	if file.Sensitive {
+		attributes = append(attributes, "sensitive")
+	}
+	fmt.Fprintf(buf, "  - %s (permissions: %s, %s)\n",
+		file.Path, orDefault(file.Permissions, "0600"), strings.Join(attributes, ", "))
+	if file.SHA256 != "" {
+		fmt.Fprintf(buf, "    sha256: %s\n", file.SHA256)
+	}
+	if file.Source != "" {
+		if file.Image != "" {
+			fmt.Fprintf(buf, "    source: %s (image %s)\n", file.Source, file.Image)
+		} else {
+			fmt.Fprintf(buf, "    source: %s\n", file.Source)
+		}
+		return
+	}
+
+	content, err := applyinator.DecodeContent(file)
+	if err != nil {
+		fmt.Fprintf(buf, "    ! failed to decode content: %v\n", err)
+		return
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(string(content), "\n"), "\n") {
+		fmt.Fprintf(buf, "    | %s\n", line)
+	}
+}
+
+func printInstruction(buf *bytes.Buffer, instruction applyinator.CommonInstruction) {
+	if instruction.Image != "" {
+		fmt.Fprintf(buf, "     image: %s\n", instruction.Image)
+	}
+	if instruction.Command != "" {
+		fmt.Fprintf(buf, "     command: %s\n", instruction.Command)
+	}
+	if len(instruction.Args) > 0 {
+		fmt.Fprintf(buf, "     args: %s\n", strings.Join(instruction.Args, " "))
+	}
+	if instruction.Rootfs {
+		fmt.Fprintf(buf, "     rootfs: true\n")
+		for _, mount := range instruction.BindMounts {
+			fmt.Fprintf(buf, "       - %s:%s\n", mount.Source, orDefault(mount.Target, mount.Source))
+		}
+	}
+	if instruction.Executor != "" {
+		fmt.Fprintf(buf, "     executor: %s\n", instruction.Executor)
+	}
+	if len(instruction.Env) > 0 {
+		fmt.Fprintf(buf, "     env:\n")
+		for _, env := range instruction.Env {
+			fmt.Fprintf(buf, "       - %s\n", env)
+		}
+	}
+}
+
+// ownership returns the owner and group of the file, by name if they are set by name.
+func ownership(file applyinator.File) string {
+	if file.Owner != "" || file.Group != "" {
+		return fmt.Sprintf("owner: %s:%s", orDefault(file.Owner, strconv.Itoa(file.UID)),
+			orDefault(file.Group, strconv.Itoa(file.GID)))
+	}
+	return fmt.Sprintf("uid: %d, gid: %d", file.UID, file.GID)
+}
+
+// probeAction returns a one line description of the probe action.
+func probeAction(probe prober.Probe) string {
+	switch {
+	case probe.HTTPGetAction != nil:
+		return "httpGet " + probe.HTTPGetAction.URL
+	case probe.TCPSocketAction != nil:
+		return fmt.Sprintf("tcpSocket %s:%d", orDefault(probe.TCPSocketAction.Host, "127.0.0.1"), probe.TCPSocketAction.Port)
+	case probe.ExecAction != nil:
+		return "exec " + strings.Join(probe.ExecAction.Command, " ")
+	case probe.GRPCAction != nil:
+		return fmt.Sprintf("grpc %s:%d %s", orDefault(probe.GRPCAction.Host, "127.0.0.1"), probe.GRPCAction.Port, probe.GRPCAction.Service)
+	case probe.FileExistsAction != nil:
+		return "fileExists " + probe.FileExistsAction.Path
+	default:
+		return "<no action>"
+	}
+}
+
+func orDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
@@ -0,0 +1,139 @@
+package plan_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/llmos-ai/llmos/pkg/applyinator"
+	"github.com/llmos-ai/llmos/pkg/applyinator/prober"
+	"github.com/llmos-ai/llmos/pkg/bootstrap/config"
+	"github.com/llmos-ai/llmos/pkg/bootstrap/plan"
+)
+
+var update = flag.Bool("update", false, "update the golden files of the tests")
+
+var _ = Describe("plan print", Label("plan", "print"), func() {
+	// print prints the plan redacted like the dry run and checks that it can be applied.
+	print := func(p *applyinator.Plan) string {
+		raw, err := json.Marshal(p)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = applyinator.CalculatePlan(raw)
+		Expect(err).NotTo(HaveOccurred())
+
+		redacted := applyinator.RedactPlan(*p)
+		var out bytes.Buffer
+		Expect(plan.Print(&out, &redacted)).To(Succeed())
+		return out.String()
+	}
+
+	It("renders the dry-run plan of a cluster-init node like the golden file", func() {
+		cfg := config.Config{}
+		cfg.Role = config.ClusterInitRole
+		cfg.NodeName = "node1"
+		cfg.Token = "K10-s3cr3t-token"
+		cfg.KubernetesVersion = "v1.30.2+k3s1"
+		cfg.LLMOSOperatorVersion = "v0.1.0"
+		cfg.PreInstructions = []applyinator.OneTimeInstruction{{
+			CommonInstruction: applyinator.CommonInstruction{
+				Name:    "load-nvidia-modules",
+				Command: "/usr/sbin/modprobe",
+				Args:    []string{"nvidia"},
+			},
+			When: `file.exists("/dev/nvidia0")`,
+		}}
+		cfg.PostInstructions = []applyinator.OneTimeInstruction{{
+			CommonInstruction: applyinator.CommonInstruction{
+				Name:    "label-node",
+				Command: "/usr/local/bin/kubectl",
+				Args:    []string{"label", "node", "node1", "llmos.ai/gpu=true"},
+			},
+			When: `role != "agent"`,
+		}}
+		cfg.Probes = map[string]config.ProbeConfig{
+			"dcgm-exporter": {Probe: prober.Probe{
+				TimeoutSeconds: 5, SuccessThreshold: 1, FailureThreshold: 3,
+				HTTPGetAction: &prober.HTTPGetAction{URL: "https://127.0.0.1:9400/metrics", CACert: "/etc/llmos/ca.crt"},
+			}},
+		}
+
+		p, err := plan.ToPlan(context.Background(), &cfg, "/var/lib/llmos")
+		Expect(err).NotTo(HaveOccurred())
+		// the plan runs the llmos binary, the test binary here
+		self, err := filepath.Abs(os.Args[0])
+		Expect(err).NotTo(HaveOccurred())
+		out := strings.ReplaceAll(print(p), self, "/usr/local/bin/llmos")
+
+		golden := filepath.Join("testdata", "print.golden")
+		if *update {
+			Expect(os.MkdirAll(filepath.Dir(golden), 0755)).To(Succeed())
+			Expect(os.WriteFile(golden, []byte(out), 0644)).To(Succeed())
+		}
+		expected, err := os.ReadFile(golden)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(Equal(string(expected)))
+		Expect(out).NotTo(ContainSubstring(cfg.Token))
+	})
+
+	It("renders the files and periodic instructions of plans applied with llmos plan apply", func() {
+		out := print(&applyinator.Plan{
+			Files: []applyinator.File{
+				{Path: "/usr/local/bin/helm", Source: "/bin/helm", Image: "alpine/helm:3.14.0", Permissions: "0755",
+					SHA256: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+				{Path: "/var/lib/llmos/models", Directory: true, Owner: "llmos", GID: 1000},
+				{Path: "/etc/llmos/legacy.yaml", State: applyinator.FileStateAbsent},
+			},
+			PeriodicInstructions: []applyinator.PeriodicInstruction{
+				{CommonInstruction: applyinator.CommonInstruction{
+					Name:    "heartbeat",
+					Command: "/usr/local/bin/llmos",
+					Args:    []string{"heartbeat"},
+				}, PeriodSeconds: 600},
+				{CommonInstruction: applyinator.CommonInstruction{
+					Name:    "prune-images",
+					Command: "/usr/local/bin/llmos",
+					Args:    []string{"images", "prune"},
+				}, When: `arch == "amd64"`, Schedule: "0 3 * * *", JitterSeconds: 300, AllowedWindows: []applyinator.Window{
+					{Start: "02:00", End: "05:00"},
+					{Days: []string{"sat", "sun"}, Start: "22:00", End: "06:00"},
+				}},
+			},
+		})
+		Expect(out).To(Equal(`Files (3):
+  - /usr/local/bin/helm (permissions: 0755, uid: 0, gid: 0)
+    sha256: e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855
+    source: /bin/helm (image alpine/helm:3.14.0)
+  - /var/lib/llmos/models/ (directory, permissions: 0755, owner: llmos:1000)
+  - /etc/llmos/legacy.yaml (absent)
+
+Instructions (0):
+
+Periodic Instructions (2):
+  1. heartbeat (every 600s)
+     command: /usr/local/bin/llmos
+     args: heartbeat
+  2. prune-images (schedule "0 3 * * *")
+     command: /usr/local/bin/llmos
+     args: images prune
+     when: arch == "amd64"
+     jitter: 300s
+     allowed window: 02:00-05:00 every day
+     allowed window: 22:00-06:00 sat,sun
+
+Probes (0):
+`))
+	})
+
+	It("renders an empty plan", func() {
+		var out bytes.Buffer
+		Expect(plan.Print(&out, &applyinator.Plan{})).To(Succeed())
+		Expect(out.String()).To(Equal("Files (0):\n\nInstructions (0):\n\nProbes (0):\n"))
+	})
+})
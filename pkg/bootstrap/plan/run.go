@@ -15,100 +15,236 @@ import (
 	"github.com/llmos-ai/llmos/pkg/applyinator"
 	"github.com/llmos-ai/llmos/pkg/applyinator/image"
 	"github.com/llmos-ai/llmos/pkg/bootstrap/config"
+	"github.com/llmos-ai/llmos/pkg/bootstrap/manifest"
 	"github.com/llmos-ai/llmos/pkg/bootstrap/version"
+	"github.com/llmos-ai/llmos/pkg/utils/crypt"
 )
 
-const defaultInsAttempts = 3
+const (
+	defaultInsAttempts    = 3
+	defaultInsConcurrency = 4
+)
 
-func Run(ctx context.Context, cfg *config.Config, plan *applyinator.Plan, dataDir string) error {
+// Run applies the node plan. One-time instructions that already succeeded for the same plan
+// are skipped unless restartFrom names an instruction to resume from.
+func Run(ctx context.Context, cfg *config.Config, plan *applyinator.Plan, dataDir, restartFrom string) error {
 	k8sVersion, err := version.K8sVersion(cfg.KubernetesVersion)
 	if err != nil {
 		return err
 	}
-	return RunWithKubernetesVersion(ctx, cfg, k8sVersion, plan, dataDir)
+	return RunWithKubernetesVersion(ctx, cfg, k8sVersion, plan, dataDir, restartFrom)
 }
 
 func RunWithKubernetesVersion(ctx context.Context, cfg *config.Config, k8sVersion string,
-	plan *applyinator.Plan, dataDir string) error {
+	plan *applyinator.Plan, dataDir, restartFrom string) error {
 	logrus.Infof("Running plan for Kubernetes version %s, plan: %v, datadir: %s",
-		k8sVersion, plan.OneTimeInstructions, dataDir)
+		k8sVersion, applyinator.RedactPlan(*plan).OneTimeInstructions, dataDir)
+
+	cipher, err := crypt.Open(cfg.Encryption)
+	if err != nil {
+		return fmt.Errorf("opening encryption key: %w", err)
+	}
 
-	if err := writePlan(plan, dataDir); err != nil {
+	if err := writePlan(plan, dataDir, cipher); err != nil {
+		return err
+	}
+
+	rawPlan, err := json.Marshal(plan)
+	if err != nil {
+		return err
+	}
+	calculatedPlan, err := applyinator.CalculatePlan(rawPlan)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Applying plan with checksum %s", calculatedPlan.Checksum)
+
+	existingOutput, err := LoadOutput(GetPlanOutput(dataDir))
+	if err != nil {
 		return err
 	}
 
+	concurrency := cfg.InstructionConcurrency
+	if concurrency == 0 {
+		concurrency = defaultInsConcurrency
+	}
+
 	// init apply plan
 	images := image.NewUtility(cfg.ImageUtility)
 	apply := applyinator.NewApplyinator(filepath.Join(dataDir, "plan", "work"),
-		false, filepath.Join(dataDir, "plan", "applied"), "", images)
+		false, GetPlanAppliedDir(dataDir), "", images)
+	apply.SetCipher(cipher)
+	apply.SetBackupStore(applyinator.NewBackupStore(GetPlanBackupDir(dataDir), cipher))
 
 	output, err := apply.Apply(ctx, applyinator.ApplyInput{
-		CalculatedPlan: applyinator.CalculatedPlan{
-			Plan: *plan,
-		},
-		RunOneTimeInstructions:     true,
-		ReconcileFiles:             true,
-		OneTimeInstructionAttempts: defaultInsAttempts,
+		CalculatedPlan:                calculatedPlan,
+		RunOneTimeInstructions:        true,
+		ReconcileFiles:                true,
+		Facts:                         ToFacts(cfg, k8sVersion),
+		OneTimeInstructionAttempts:    defaultInsAttempts,
+		OneTimeInstructionConcurrency: concurrency,
+		ExistingOneTimeOutput:         existingOutput,
+		StateFile:                     GetPlanStateFile(dataDir),
+		ManagedFilesFile:              GetPlanManagedFilesFile(dataDir),
+		RestartFrom:                   restartFrom,
 	})
 
 	if err != nil {
 		return fmt.Errorf("failed to apply plan: %w", err)
-	} else if !output.OneTimeApplySucceeded {
+	}
+
+	// save the output of the instructions that did run before reporting the failure
+	if err = SaveOutput(output.OneTimeOutput, GetPlanOutput(dataDir), cipher); err != nil {
+		return err
+	}
+
+	if !output.OneTimeApplySucceeded {
 		return fmt.Errorf("kubernetes runtime plan is not applied successfully, " +
 			"please check log for more details")
 	}
 
-	return saveOutput(output.OneTimeOutput, dataDir)
+	// the llmos agent keeps the periodic instructions and probes of the node plan running
+	return WriteAgentPlan(plan, ToFacts(cfg, k8sVersion), dataDir, cipher)
 }
 
-func saveOutput(data []byte, dataDir string) error {
-	planOutput := GetPlanOutput(dataDir)
-	f, err := os.OpenFile(planOutput, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+// AgentPlan is the part of the node plan the llmos agent keeps running after the bootstrap, with the facts it
+// was applied with.
+type AgentPlan struct {
+	Plan  applyinator.Plan  `json:"plan"`
+	Facts applyinator.Facts `json:"facts,omitempty"`
+}
+
+// WriteAgentPlan writes the periodic instructions and probes of the plan to the agent plan file of the data dir,
+// encrypted with the cipher. The one-time instructions and files are only applied by the bootstrap.
+func WriteAgentPlan(plan *applyinator.Plan, facts applyinator.Facts, dataDir string, cipher *crypt.Cipher) error {
+	agentPlan := AgentPlan{
+		Plan: applyinator.Plan{
+			Executor:             plan.Executor,
+			PeriodicInstructions: plan.PeriodicInstructions,
+			Probes:               plan.Probes,
+		},
+		Facts: facts,
+	}
+	data, err := json.MarshalIndent(agentPlan, "", "  ")
 	if err != nil {
 		return err
 	}
-	defer func() {
-		err = f.Close()
-		if err != nil {
-			logrus.Fatalln(err)
-		}
-	}()
+	agentPlanFile := GetAgentPlanFile(dataDir)
+	if err = os.MkdirAll(filepath.Dir(agentPlanFile), 0755); err != nil {
+		return err
+	}
+	return cipher.WriteFile(agentPlanFile, append(data, '\n'), 0600)
+}
 
+// ReadAgentPlan reads the agent plan file of the data dir, nil is returned if the node was not bootstrapped.
+func ReadAgentPlan(dataDir string) (*AgentPlan, error) {
+	data, err := crypt.ReadFile(GetAgentPlanFile(dataDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	agentPlan := &AgentPlan{}
+	if err = json.Unmarshal(data, agentPlan); err != nil {
+		return nil, fmt.Errorf("parsing agent plan %s: %w", GetAgentPlanFile(dataDir), err)
+	}
+	return agentPlan, nil
+}
+
+// ToFacts returns the node facts `when` expressions of the plan instructions are evaluated against,
+// the applyinator adds the facts of the host such as arch and os.
+func ToFacts(cfg *config.Config, k8sVersion string) applyinator.Facts {
+	nodeName, err := manifest.GetNodeName(cfg)
+	if err != nil {
+		logrus.Warnf("failed to get node name for plan facts: %v", err)
+	}
+	return applyinator.Facts{
+		"role":                 string(cfg.Role),
+		"runtime":              string(config.GetRuntime(k8sVersion)),
+		"kubernetesVersion":    k8sVersion,
+		"llmosOperatorVersion": cfg.LLMOSOperatorVersion,
+		"nodeName":             nodeName,
+		"server":               cfg.Server,
+	}
+}
+
+// LoadOutput returns the output of a previous run saved at the path gzipped the way the applyinator
+// expects it, so the output of skipped instructions is kept.
+func LoadOutput(path string) ([]byte, error) {
+	data, err := crypt.ReadFile(path)
+	if os.IsNotExist(err) || len(data) == 0 {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err = gz.Write(data); err != nil {
+		return nil, err
+	}
+	if err = gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SaveOutput writes the gzipped output of the applyinator to the path, encrypted with the cipher.
+func SaveOutput(data []byte, path string, cipher *crypt.Cipher) error {
 	in, err := gzip.NewReader(bytes.NewBuffer(data))
 	if err != nil {
 		return err
 	}
-	_, err = io.Copy(f, in)
-	return err
+	output, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	return cipher.WriteFile(path, output, 0600)
 }
 
-func writePlan(plan *applyinator.Plan, dataDir string) error {
+// writePlan writes the plan with its sensitive values redacted to the plan file of the data dir.
+func writePlan(plan *applyinator.Plan, dataDir string, cipher *crypt.Cipher) error {
 	planFile := GetPlanFile(dataDir)
 	if err := os.MkdirAll(filepath.Dir(planFile), 0755); err != nil {
 		return err
 	}
 
 	logrus.Infof("Writing plan file to %s", planFile)
-	f, err := os.OpenFile(planFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	data, err := json.MarshalIndent(applyinator.RedactPlan(*plan), "", "  ")
 	if err != nil {
 		return err
 	}
-	defer func() {
-		err = f.Close()
-		if err != nil {
-			logrus.Fatalln(err)
-		}
-	}()
-
-	enc := json.NewEncoder(f)
-	enc.SetIndent("", "  ")
-	return enc.Encode(plan)
+	return cipher.WriteFile(planFile, append(data, '\n'), 0600)
 }
 
 func GetPlanFile(dataDir string) string {
 	return filepath.Join(dataDir, "plan", "plan.json")
 }
 
+// GetAgentPlanFile returns the part of the node plan kept running by the llmos agent, see WriteAgentPlan.
+func GetAgentPlanFile(dataDir string) string {
+	return filepath.Join(dataDir, "plan", "agent-plan.json")
+}
+
+// GetPlanAppliedDir returns the history of the applied plans.
+func GetPlanAppliedDir(dataDir string) string {
+	return filepath.Join(dataDir, "plan", "applied")
+}
+
+// GetPlanBackupDir returns the directory holding the previous content of the files overwritten by the plans.
+func GetPlanBackupDir(dataDir string) string {
+	return filepath.Join(dataDir, "plan", "backup")
+}
+
+// GetPlanManagedFilesFile returns the record of the files written by the last applied plan.
+func GetPlanManagedFilesFile(dataDir string) string {
+	return filepath.Join(dataDir, "plan", "managed-files.json")
+}
+
 func GetPlanOutput(dataDir string) string {
 	return filepath.Join(dataDir, "plan", "plan-output.json")
 }
+
+func GetPlanStateFile(dataDir string) string {
+	return filepath.Join(dataDir, "plan", "plan-state.json")
+}
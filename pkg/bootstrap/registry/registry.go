@@ -25,6 +25,7 @@ func ToFile(registry *registries.Registry, runtime config.Runtime) (*applyinator
 		Content:     base64.StdEncoding.EncodeToString(data),
 		Path:        GetRuntimeConfigFile(runtime),
 		Permissions: "0400",
+		Sensitive:   true,
 	}, nil
 
 }
@@ -7,12 +7,15 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/rancher/wharfie/pkg/registries"
 	"github.com/sirupsen/logrus"
 	"sigs.k8s.io/yaml"
 
+	"github.com/llmos-ai/llmos/pkg/applyinator"
 	"github.com/llmos-ai/llmos/pkg/bootstrap/config"
 	"github.com/llmos-ai/llmos/pkg/bootstrap/plan"
 	"github.com/llmos-ai/llmos/pkg/bootstrap/version"
+	"github.com/llmos-ai/llmos/pkg/utils/crypt"
 	cliversion "github.com/llmos-ai/llmos/pkg/version"
 )
 
@@ -25,6 +28,8 @@ type Config struct {
 	ClusterInit       bool
 	Role              string
 	KubernetesVersion string
+	DryRun            bool
+	RestartFrom       string
 }
 
 // LLMOS is the main entrypoint to the llmos systemd service
@@ -38,6 +43,10 @@ func New(cfg Config) *LLMOS {
 	}
 }
 func (l *LLMOS) Run(ctx context.Context) error {
+	if l.cfg.DryRun {
+		return l.dryRun(ctx)
+	}
+
 	if done, err := l.done(); err != nil {
 		return fmt.Errorf("checking done stamp [%s]: %w", l.DoneStamp(), err)
 	} else if done {
@@ -52,6 +61,8 @@ func (l *LLMOS) Run(ctx context.Context) error {
 			return nil
 		}
 		logrus.Warnf("failed to bootstrap system, will retry: %v", err)
+		// retries resume from the first failed instruction
+		l.cfg.RestartFrom = ""
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
@@ -61,39 +72,18 @@ func (l *LLMOS) Run(ctx context.Context) error {
 }
 
 func (l *LLMOS) execute(ctx context.Context) error {
-	cfg, err := config.Load(l.cfg.ConfigPath)
+	cfg, err := l.loadConfig()
 	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
-	}
-	cfg = mergeConfigs(l.cfg, cfg)
-
-	if err = validateConfig(&cfg); err != nil {
-		// terminate bootstrap if config is invalid
-		logrus.Fatalf("invalid config: %v", err)
+		return err
 	}
 
 	if err = l.setWorking(cfg); err != nil {
 		return fmt.Errorf("failed to save working config to %s: %w", l.WorkingStamp(), err)
 	}
 
-	var k8sVersion, operatorVersion string
-	if cfg.Role == config.ClusterInitRole {
-		k8sVersion, err = version.K8sVersion(cfg.KubernetesVersion)
-		if err != nil {
-			return err
-		}
-
-		operatorVersion, err = version.OperatorVersion(cfg.ChartRepo, cfg.LLMOSOperatorVersion)
-		if err != nil {
-			return err
-		}
-	} else {
-		k8sVersion, operatorVersion, err = version.GetClusterK8sAndOperatorVersions(cfg.Server, cfg.Token)
-		if err != nil {
-			return err
-		}
-		cfg.KubernetesVersion = k8sVersion
-		cfg.LLMOSOperatorVersion = operatorVersion
+	k8sVersion, operatorVersion, err := resolveVersions(&cfg)
+	if err != nil {
+		return err
 	}
 
 	logrus.Infof("Bootstrapping LLMOS %s(%s)", operatorVersion, k8sVersion)
@@ -102,9 +92,14 @@ func (l *LLMOS) execute(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("generating plan: %w", err)
 	}
-	logrus.Debugf("Generated node plan: %+v", nodePlan)
+	logrus.Debugf("Generated node plan: %+v", applyinator.RedactPlan(*nodePlan))
 
-	if err = plan.Run(ctx, &cfg, nodePlan, l.cfg.DataDir); err != nil {
+	if l.cfg.RestartFrom != "" && !hasInstruction(nodePlan, l.cfg.RestartFrom) {
+		// terminate bootstrap as retrying would not find the instruction either
+		logrus.Fatalf("instruction %s to restart from is not part of the node plan", l.cfg.RestartFrom)
+	}
+
+	if err = plan.Run(ctx, &cfg, nodePlan, l.cfg.DataDir, l.cfg.RestartFrom); err != nil {
 		return fmt.Errorf("running plan error: %w", err)
 	}
 
@@ -116,27 +111,121 @@ func (l *LLMOS) execute(ctx context.Context) error {
 	return nil
 }
 
-func (l *LLMOS) writeConfig(path string, cfg config.Config) error {
-	if err := os.MkdirAll(filepath.Dir(path), 0600); err != nil {
-		return fmt.Errorf("mkdir %s: %w", filepath.Dir(path), err)
+// dryRun generates the node plan the same way execute does and prints it,
+// without writing any stamps or applying the plan to the host.
+func (l *LLMOS) dryRun(ctx context.Context) error {
+	cfg, err := l.loadConfig()
+	if err != nil {
+		return err
 	}
-	f, err := os.Create(path)
+
+	k8sVersion, operatorVersion, err := resolveVersions(&cfg)
 	if err != nil {
 		return err
 	}
-	defer func() {
-		err = f.Close()
+
+	nodePlan, err := plan.ToPlan(ctx, &cfg, l.cfg.DataDir)
+	if err != nil {
+		return fmt.Errorf("generating plan: %w", err)
+	}
+
+	fmt.Printf("Node plan for LLMOS %s(%s), role: %s\n\n", operatorVersion, k8sVersion, cfg.Role)
+	redacted := applyinator.RedactPlan(*nodePlan)
+	return plan.Print(os.Stdout, &redacted)
+}
+
+func hasInstruction(p *applyinator.Plan, name string) bool {
+	for _, instruction := range p.OneTimeInstructions {
+		if instruction.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *LLMOS) loadConfig() (config.Config, error) {
+	cfg, err := config.Load(l.cfg.ConfigPath)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to load config: %w", err)
+	}
+	cfg = mergeConfigs(l.cfg, cfg)
+
+	if err = validateConfig(&cfg); err != nil {
+		// terminate bootstrap if config is invalid
+		logrus.Fatalf("invalid config: %v", err)
+	}
+	return cfg, nil
+}
+
+// resolveVersions resolves the kubernetes and operator versions to bootstrap, joining nodes
+// inherit the versions from the cluster they join.
+func resolveVersions(cfg *config.Config) (k8sVersion, operatorVersion string, err error) {
+	if cfg.Role == config.ClusterInitRole {
+		k8sVersion, err = version.K8sVersion(cfg.KubernetesVersion)
 		if err != nil {
-			logrus.Fatal(err)
+			return "", "", err
 		}
-	}()
 
-	data, err := yaml.Marshal(cfg)
+		operatorVersion, err = version.OperatorVersion(cfg.ChartRepo, cfg.LLMOSOperatorVersion)
+		if err != nil {
+			return "", "", err
+		}
+		return k8sVersion, operatorVersion, nil
+	}
+
+	k8sVersion, operatorVersion, err = version.GetClusterK8sAndOperatorVersions(cfg.Server, cfg.Token)
+	if err != nil {
+		return "", "", err
+	}
+	cfg.KubernetesVersion = k8sVersion
+	cfg.LLMOSOperatorVersion = operatorVersion
+	return k8sVersion, operatorVersion, nil
+}
+
+func (l *LLMOS) writeConfig(path string, cfg config.Config) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0600); err != nil {
+		return fmt.Errorf("mkdir %s: %w", filepath.Dir(path), err)
+	}
+
+	// the key is created on the first write of the working stamp
+	cipher, err := crypt.Open(cfg.Encryption)
+	if err != nil {
+		return fmt.Errorf("opening encryption key: %w", err)
+	}
+
+	data, err := yaml.Marshal(redactConfig(cfg))
 	if err != nil {
 		return err
 	}
-	_, err = f.Write(data)
-	return err
+	return cipher.WriteFile(path, data, 0600)
+}
+
+// redactConfig returns a copy of the config with the token and the registry credentials masked,
+// the stamps only record which config the system was bootstrapped with.
+func redactConfig(cfg config.Config) config.Config {
+	if cfg.Token != "" {
+		cfg.Token = applyinator.Redacted
+	}
+	if cfg.Registries == nil {
+		return cfg
+	}
+
+	registry := *cfg.Registries
+	registry.Configs = make(map[string]registries.RegistryConfig, len(cfg.Registries.Configs))
+	for name, registryConfig := range cfg.Registries.Configs {
+		if registryConfig.Auth != nil {
+			auth := *registryConfig.Auth
+			for _, value := range []*string{&auth.Username, &auth.Password, &auth.Auth, &auth.IdentityToken} {
+				if *value != "" {
+					*value = applyinator.Redacted
+				}
+			}
+			registryConfig.Auth = &auth
+		}
+		registry.Configs[name] = registryConfig
+	}
+	cfg.Registries = &registry
+	return cfg
 }
 
 func (l *LLMOS) setWorking(cfg config.Config) error {
@@ -150,6 +239,8 @@ func (l *LLMOS) setDone(cfg config.Config) error {
 func (l *LLMOS) done() (bool, error) {
 	if l.cfg.Force {
 		_ = os.Remove(l.DoneStamp())
+		// forget completed instructions so that the whole plan is applied again
+		_ = os.Remove(plan.GetPlanStateFile(l.cfg.DataDir))
 		return false, nil
 	}
 	_, err := os.Stat(l.DoneStamp())
@@ -29,6 +29,7 @@ func ToTokenFile(token, dataDir string) (*applyinator.File, error) {
 		Content:     base64.StdEncoding.EncodeToString(tokenByte),
 		Path:        fmt.Sprintf("%s/token", dataDir),
 		Permissions: "600",
+		Sensitive:   true,
 	}, nil
 }
 
@@ -37,9 +38,11 @@ func ToBootstrapFile(config *config.RuntimeConfig, runtime config.Runtime, serve
 	if err != nil {
 		return nil, err
 	}
+	// the runtime config contains the cluster token
 	return &applyinator.File{
-		Content: base64.StdEncoding.EncodeToString(data),
-		Path:    GetConfigLocation(runtime),
+		Content:   base64.StdEncoding.EncodeToString(data),
+		Path:      GetConfigLocation(runtime),
+		Sensitive: true,
 	}, nil
 }
 
@@ -2,10 +2,8 @@ package runtime
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
 
-	"github.com/llmos-ai/llmos/utils/cmd"
 	"github.com/sirupsen/logrus"
 
 	"github.com/llmos-ai/llmos/pkg/applyinator"
@@ -22,13 +20,15 @@ const (
 func ToInstruction(cfg *config.Config, k8sVersion string) (*applyinator.OneTimeInstruction, error) {
 	runtime := config.GetRuntime(k8sVersion)
 	env := addRuntimeEnvConfig(runtime, cfg, k8sVersion)
-	logrus.Debugf("runtime %s instruction envs: %+v", runtime, env)
+	sensitiveEnv := []string{"K3S_TOKEN"}
+	logrus.Debugf("runtime %s instruction envs: %+v", runtime, applyinator.RedactEnv(env, sensitiveEnv))
 
 	return &applyinator.OneTimeInstruction{
 		CommonInstruction: applyinator.CommonInstruction{
-			Name:  fmt.Sprintf("install-%s", runtime),
-			Env:   env,
-			Image: images.GetRuntimeInstallerImage(cfg.RuntimeInstallerImage, cfg.GlobalImageRegistry, k8sVersion),
+			Name:         fmt.Sprintf("install-%s", runtime),
+			Env:          env,
+			SensitiveEnv: sensitiveEnv,
+			Image:        images.GetRuntimeInstallerImage(cfg.RuntimeInstallerImage, cfg.GlobalImageRegistry, k8sVersion),
 		},
 		SaveOutput: true,
 	}, nil
@@ -55,25 +55,19 @@ func addRuntimeEnvConfig(runtime config.Runtime, cfg *config.Config, k8sVersion
 	return env
 }
 
-func CopyKubeConfigInstruction(k8sVersion string) (*applyinator.OneTimeInstruction, error) {
-	runtime := config.GetRuntime(k8sVersion)
-	cmd, err := cmd.Self()
-	if err != nil {
-		return nil, fmt.Errorf("resolving location of %s: %w", os.Args[0], err)
-	}
-
-	if err := applyinator.CreateDirectory(applyinator.File{Directory: true, Path: llmosConfigPath}); err != nil {
-		return nil, fmt.Errorf("error while creating empty config directory: %v", err)
-	}
+// ToKubeConfigSymlink returns the symlink of the runtime kubeconfig in the llmos config directory.
+func ToKubeConfigSymlink(k8sVersion string) (*applyinator.File, error) {
+	return &applyinator.File{
+		Path:    filepath.Join(llmosConfigPath, llmosKubeconfigFile),
+		Symlink: GetKubeconfigPath(config.GetRuntime(k8sVersion)),
+	}, nil
+}
 
-	return &applyinator.OneTimeInstruction{
-		CommonInstruction: applyinator.CommonInstruction{
-			Name: fmt.Sprintf("symlink-kubeconfig-%s", runtime),
-			Args: []string{"retry", "ln", "-sf", GetKubeconfigPath(runtime),
-				filepath.Join(llmosConfigPath, llmosKubeconfigFile)},
-			Command: cmd,
-		},
-		SaveOutput: true,
+// ToConfigDirectory returns the llmos config directory the kubeconfig symlink is created in.
+func ToConfigDirectory() (*applyinator.File, error) {
+	return &applyinator.File{
+		Directory: true,
+		Path:      llmosConfigPath,
 	}, nil
 }
 
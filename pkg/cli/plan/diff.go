@@ -0,0 +1,324 @@
+package plan
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pmezard/go-difflib/difflib"
+
+	"github.com/llmos-ai/llmos/pkg/applyinator"
+)
+
+// DiffOptions selects the plans to compare. A plan is either the time stamp of an applied plan
+// in the history or the path to a plan file.
+type DiffOptions struct {
+	DataDir string
+	// Name of the plan applied with `llmos plan apply` whose history is compared, the node plan if empty
+	Name string
+	// From defaults to the plan applied before To
+	From string
+	// To defaults to the last applied plan
+	To string
+}
+
+type diffPlan struct {
+	label string
+	applyinator.CalculatedPlan
+}
+
+// Diff prints the differences of the files, instructions and probes between two plans. Sensitive values
+// are compared redacted, as the history does not record them.
+func Diff(w io.Writer, opts DiffOptions) error {
+	t, err := historyTarget(opts.DataDir, opts.Name)
+	if err != nil {
+		return err
+	}
+	applied, err := applyinator.ReadAppliedPlans(t.appliedDir)
+	if err != nil {
+		return err
+	}
+
+	var from, to diffPlan
+	switch {
+	case opts.To != "":
+		if to, err = resolvePlan(t, opts.To); err != nil {
+			return err
+		}
+	case len(applied) == 0:
+		return fmt.Errorf("%s was not applied yet", t)
+	default:
+		to = diffPlan{label: applied[0].Timestamp(), CalculatedPlan: applied[0].CalculatedPlan}
+	}
+	switch {
+	case opts.From != "":
+		if from, err = resolvePlan(t, opts.From); err != nil {
+			return err
+		}
+	case len(applied) < 2:
+		return fmt.Errorf("the history has no plan applied before %s", to.label)
+	default:
+		from = diffPlan{label: applied[1].Timestamp(), CalculatedPlan: applied[1].CalculatedPlan}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s (checksum: %s)\n", from.label, from.Checksum)
+	fmt.Fprintf(&buf, "+++ %s (checksum: %s)\n", to.label, to.Checksum)
+	if !DiffPlans(&buf, from.Plan, to.Plan) {
+		fmt.Fprintln(&buf, "\nno differences")
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// resolvePlan reads the plan file at the reference if it exists, or the applied plan of the target with the time stamp.
+func resolvePlan(t target, ref string) (diffPlan, error) {
+	if _, err := os.Stat(ref); err == nil || ref == Stdin {
+		calculated, err := Load(ref, nil)
+		if err != nil {
+			return diffPlan{}, err
+		}
+		calculated.Plan = applyinator.RedactPlan(calculated.Plan)
+		return diffPlan{label: ref, CalculatedPlan: calculated}, nil
+	}
+	applied, err := readAppliedPlan(t, ref)
+	if os.IsNotExist(err) {
+		return diffPlan{}, fmt.Errorf("%s is neither a plan file nor the time stamp of an applied plan", ref)
+	} else if err != nil {
+		return diffPlan{}, err
+	}
+	return diffPlan{label: ref, CalculatedPlan: applied.CalculatedPlan}, nil
+}
+
+// DiffPlans writes the differences between the plans and returns whether there are any.
+func DiffPlans(w io.Writer, from, to applyinator.Plan) bool {
+	changed := false
+	section := func(title string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		changed = true
+		fmt.Fprintf(w, "\n%s:\n", title)
+		for _, line := range lines {
+			fmt.Fprintln(w, line)
+		}
+	}
+
+	if from.Executor != to.Executor {
+		section("Plan", []string{fmt.Sprintf("  ~ executor: %q -> %q", from.Executor, to.Executor)})
+	}
+	section("Files", diffFiles(from.Files, to.Files))
+
+	oneTime := func(instructions []applyinator.OneTimeInstruction) ([]string, map[string]interface{}) {
+		names := make([]string, 0, len(instructions))
+		byName := map[string]interface{}{}
+		for _, instruction := range instructions {
+			names = append(names, instruction.Name)
+			byName[instruction.Name] = instruction
+		}
+		return names, byName
+	}
+	fromNames, fromInstructions := oneTime(from.OneTimeInstructions)
+	toNames, toInstructions := oneTime(to.OneTimeInstructions)
+	lines := diffNamed(fromInstructions, toInstructions)
+	if common(fromNames, toInstructions) != common(toNames, fromInstructions) {
+		lines = append(lines, fmt.Sprintf("  ~ order: %s -> %s",
+			strings.Join(fromNames, ", "), strings.Join(toNames, ", ")))
+	}
+	section("Instructions", lines)
+
+	periodic := func(instructions []applyinator.PeriodicInstruction) map[string]interface{} {
+		byName := map[string]interface{}{}
+		for _, instruction := range instructions {
+			byName[instruction.Name] = instruction
+		}
+		return byName
+	}
+	section("Periodic Instructions", diffNamed(periodic(from.PeriodicInstructions), periodic(to.PeriodicInstructions)))
+
+	fromProbes, toProbes := map[string]interface{}{}, map[string]interface{}{}
+	for name, probe := range from.Probes {
+		fromProbes[name] = probe
+	}
+	for name, probe := range to.Probes {
+		toProbes[name] = probe
+	}
+	section("Probes", diffNamed(fromProbes, toProbes))
+
+	return changed
+}
+
+// common returns the names that are in both plans, in the order of the first one.
+func common(names []string, other map[string]interface{}) string {
+	var result []string
+	for _, name := range names {
+		if _, ok := other[name]; ok {
+			result = append(result, name)
+		}
+	}
+	return strings.Join(result, ",")
+}
+
+func diffFiles(from, to []applyinator.File) []string {
+	fromFiles := map[string]applyinator.File{}
+	for _, file := range from {
+		fromFiles[file.Path] = file
+	}
+	toFiles := map[string]applyinator.File{}
+	for _, file := range to {
+		toFiles[file.Path] = file
+	}
+
+	var lines []string
+	for _, path := range sortedKeys(fromFiles, toFiles) {
+		before, inFrom := fromFiles[path]
+		after, inTo := toFiles[path]
+		switch {
+		case !inTo:
+			lines = append(lines, "  - "+path)
+		case !inFrom:
+			lines = append(lines, "  + "+path)
+			lines = append(lines, contentDiff(applyinator.File{}, after)...)
+		default:
+			// the content is compared decoded, the encoding alone is not a change
+			changes := fieldChanges(before, after, "content", "encoding")
+			changes = append(changes, contentDiff(before, after)...)
+			if len(changes) > 0 {
+				lines = append(lines, "  ~ "+path)
+				lines = append(lines, changes...)
+			}
+		}
+	}
+	return lines
+}
+
+// contentDiff returns a unified diff of the decoded inline content of the files.
+func contentDiff(from, to applyinator.File) []string {
+	before, err := fileText(from)
+	if err != nil {
+		return []string{fmt.Sprintf("      content: %v", err)}
+	}
+	after, err := fileText(to)
+	if err != nil {
+		return []string{fmt.Sprintf("      content: %v", err)}
+	}
+	if before == after {
+		return nil
+	}
+	if !utf8.ValidString(before) || !utf8.ValidString(after) {
+		return []string{"      content: binary content differs"}
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:       splitLines(before),
+		B:       splitLines(after),
+		Context: 2,
+	})
+	if err != nil {
+		return []string{fmt.Sprintf("      content: %v", err)}
+	}
+	lines := []string{"      content:"}
+	for _, line := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+		lines = append(lines, "        "+line)
+	}
+	return lines
+}
+
+// splitLines splits the text ended by a new line into its lines, difflib.SplitLines would add an empty last line.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.SplitAfter(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+func fileText(file applyinator.File) (string, error) {
+	if file.Content == "" {
+		return "", nil
+	}
+	content, err := applyinator.DecodeContent(file)
+	if err != nil {
+		return "", fmt.Errorf("decoding content: %w", err)
+	}
+	text := string(content)
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	return text, nil
+}
+
+// diffNamed compares instructions or probes by their name.
+func diffNamed(from, to map[string]interface{}) []string {
+	var lines []string
+	for _, name := range sortedKeys(from, to) {
+		before, inFrom := from[name]
+		after, inTo := to[name]
+		switch {
+		case !inTo:
+			lines = append(lines, "  - "+name)
+		case !inFrom:
+			lines = append(lines, "  + "+name)
+		default:
+			if changes := fieldChanges(before, after); len(changes) > 0 {
+				lines = append(lines, "  ~ "+name)
+				lines = append(lines, changes...)
+			}
+		}
+	}
+	return lines
+}
+
+// fieldChanges returns the fields whose JSON encoding differs between the values.
+func fieldChanges(from, to interface{}, skip ...string) []string {
+	before, after := toFields(from), toFields(to)
+	var lines []string
+	for _, key := range sortedKeys(before, after) {
+		if slices.Contains(skip, key) || reflect.DeepEqual(before[key], after[key]) {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("      %s: %s -> %s", key, compact(before[key]), compact(after[key])))
+	}
+	return lines
+}
+
+func toFields(value interface{}) map[string]interface{} {
+	fields := map[string]interface{}{}
+	content, err := json.Marshal(value)
+	if err == nil {
+		_ = json.Unmarshal(content, &fields)
+	}
+	return fields
+}
+
+func compact(value interface{}) string {
+	if value == nil {
+		return "<unset>"
+	}
+	content, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(content)
+}
+
+func sortedKeys[V any](maps ...map[string]V) []string {
+	seen := map[string]bool{}
+	var keys []string
+	for _, m := range maps {
+		for key := range m {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,114 @@
+package plan_test
+
+import (
+	"bytes"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/llmos-ai/llmos/pkg/applyinator"
+	"github.com/llmos-ai/llmos/pkg/applyinator/prober"
+	cliplan "github.com/llmos-ai/llmos/pkg/cli/plan"
+)
+
+var _ = Describe("plan diff", Label("plan", "diff"), func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+	})
+
+	instruction := func(name, command string, env ...string) applyinator.OneTimeInstruction {
+		return applyinator.OneTimeInstruction{CommonInstruction: applyinator.CommonInstruction{
+			Name: name, Command: command, Env: env, SensitiveEnv: []string{"TOKEN"},
+		}}
+	}
+
+	It("prints the changes between the last two applied plans", func() {
+		from := recordApplied(dir, "", "20240101-000000", applyinator.Plan{
+			Files: []applyinator.File{
+				{Path: "/etc/llmos/config.yaml", Encoding: "plain", Content: "a: 1\nb: 2\nc: 3\n"},
+				{Path: "/etc/llmos/removed"},
+				{Path: "/etc/llmos/token", Encoding: "plain", Content: "old-token", Sensitive: true},
+			},
+			OneTimeInstructions: []applyinator.OneTimeInstruction{
+				instruction("install", "/bin/install", "TOKEN=old"),
+				instruction("configure", "/bin/configure"),
+			},
+			Probes: map[string]prober.Probe{"kubelet": {FailureThreshold: 1, FileExistsAction: &prober.FileExistsAction{Path: "/run/kubelet"}}},
+		})
+		to := recordApplied(dir, "", "20240102-000000", applyinator.Plan{
+			Files: []applyinator.File{
+				{Path: "/etc/llmos/config.yaml", Encoding: "plain", Content: "a: 1\nb: 20\nc: 3\n", Permissions: "0644"},
+				{Path: "/etc/llmos/added", Encoding: "plain", Content: "new\n"},
+				{Path: "/etc/llmos/token", Encoding: "plain", Content: "new-token", Sensitive: true},
+			},
+			OneTimeInstructions: []applyinator.OneTimeInstruction{
+				instruction("configure", "/bin/configure"),
+				instruction("install", "/bin/install", "TOKEN=new"),
+				instruction("verify", "/bin/verify"),
+			},
+			Probes: map[string]prober.Probe{"kubelet": {FailureThreshold: 3, FileExistsAction: &prober.FileExistsAction{Path: "/run/kubelet"}}},
+		})
+
+		var out bytes.Buffer
+		Expect(cliplan.Diff(&out, cliplan.DiffOptions{DataDir: dir})).To(Succeed())
+		Expect(out.String()).To(Equal(`--- 20240101-000000 (checksum: ` + from.Checksum + `)
++++ 20240102-000000 (checksum: ` + to.Checksum + `)
+
+Files:
+  + /etc/llmos/added
+      content:
+        @@ -0,0 +1 @@
+        +new
+  ~ /etc/llmos/config.yaml
+      permissions: <unset> -> "0644"
+      content:
+        @@ -1,3 +1,3 @@
+         a: 1
+        -b: 2
+        +b: 20
+         c: 3
+  - /etc/llmos/removed
+
+Instructions:
+  + verify
+  ~ order: install, configure -> configure, install, verify
+
+Probes:
+  ~ kubelet
+      failureThreshold: 1 -> 3
+`))
+		// the history is redacted, the changes of the sensitive file and env are not known
+		Expect(out.String()).NotTo(ContainSubstring("token"))
+	})
+
+	It("reports plans without differences", func() {
+		p := applyinator.Plan{OneTimeInstructions: []applyinator.OneTimeInstruction{instruction("install", "/bin/install")}}
+		recordApplied(dir, "", "20240101-000000", p)
+		recordApplied(dir, "", "20240102-000000", p)
+
+		var out bytes.Buffer
+		Expect(cliplan.Diff(&out, cliplan.DiffOptions{DataDir: dir, From: "20240101-000000", To: "20240102-000000"})).To(Succeed())
+		Expect(out.String()).To(HaveSuffix("\nno differences\n"))
+	})
+
+	It("compares the applied plans of one plan only", func() {
+		recordApplied(dir, "", "20240101-000000", applyinator.Plan{})
+		recordApplied(dir, "demo", "20240102-000000", applyinator.Plan{})
+
+		err := cliplan.Diff(&bytes.Buffer{}, cliplan.DiffOptions{DataDir: dir})
+		Expect(err).To(MatchError("the history has no plan applied before 20240101-000000"))
+		err = cliplan.Diff(&bytes.Buffer{}, cliplan.DiffOptions{DataDir: dir, From: "20240102-000000"})
+		Expect(err).To(MatchError("the plan applied at 20240102-000000 is plan demo, not the node plan, select it with --name demo"))
+	})
+
+	It("needs two applied plans", func() {
+		recordApplied(dir, "", "20240101-000000", applyinator.Plan{})
+		err := cliplan.Diff(&bytes.Buffer{}, cliplan.DiffOptions{DataDir: dir})
+		Expect(err).To(MatchError("the history has no plan applied before 20240101-000000"))
+
+		err = cliplan.Diff(&bytes.Buffer{}, cliplan.DiffOptions{DataDir: dir, From: "yesterday"})
+		Expect(err).To(MatchError(ContainSubstring("invalid applied plan time stamp")))
+	})
+})
@@ -0,0 +1,66 @@
+package plan_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/llmos-ai/llmos/pkg/applyinator"
+	cliplan "github.com/llmos-ai/llmos/pkg/cli/plan"
+)
+
+// recordApplied records the plan in the applied plan history of the named plan, or of the node plan if the name is
+// empty, with the time stamp and redacted like the applyinator records it.
+func recordApplied(dataDir, name, timestamp string, p applyinator.Plan) applyinator.CalculatedPlan {
+	raw, err := json.Marshal(p)
+	Expect(err).NotTo(HaveOccurred())
+	calculated, err := applyinator.CalculatePlan(raw)
+	Expect(err).NotTo(HaveOccurred())
+
+	content, err := json.Marshal(applyinator.CalculatedPlan{
+		Plan:     applyinator.RedactPlan(calculated.Plan),
+		Checksum: calculated.Checksum,
+	})
+	Expect(err).NotTo(HaveOccurred())
+	dir := cliplan.GetPlanHistoryDir(dataDir, name)
+	Expect(os.MkdirAll(dir, 0700)).To(Succeed())
+	Expect(os.WriteFile(filepath.Join(dir, timestamp+"-applied.plan"), content, 0600)).To(Succeed())
+	return calculated
+}
+
+var _ = Describe("plan history", Label("plan", "history"), func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		recordApplied(dir, "", "20240101-000000", applyinator.Plan{Files: []applyinator.File{{Path: "/etc/llmos/a"}}})
+		recordApplied(dir, "demo", "20240102-000000", applyinator.Plan{})
+		recordApplied(dir, "", "20240103-000000", applyinator.Plan{})
+	})
+
+	It("lists the applied plans of every plan, the most recent first", func() {
+		var out bytes.Buffer
+		Expect(cliplan.History(&out, dir, "", "")).To(Succeed())
+		lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+		Expect(lines).To(HaveLen(4))
+		Expect(strings.Fields(lines[0])).To(Equal([]string{"TIMESTAMP", "PLAN", "APPLIED", "CHECKSUM", "FILES", "INSTRUCTIONS", "PROBES"}))
+		Expect(strings.Fields(lines[1])[:2]).To(Equal([]string{"20240103-000000", "<node>"}))
+		Expect(strings.Fields(lines[2])[:2]).To(Equal([]string{"20240102-000000", "demo"}))
+		Expect(strings.Fields(lines[3])[:2]).To(Equal([]string{"20240101-000000", "<node>"}))
+	})
+
+	It("lists the applied plans of the named plan", func() {
+		var out bytes.Buffer
+		Expect(cliplan.History(&out, dir, "demo", cliplan.OutputJSON)).To(Succeed())
+		var entries []cliplan.HistoryEntry
+		Expect(json.Unmarshal(out.Bytes(), &entries)).To(Succeed())
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Timestamp).To(Equal("20240102-000000"))
+		Expect(entries[0].Plan).To(Equal("demo"))
+	})
+})
@@ -0,0 +1,447 @@
+package plan
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+
+	"github.com/llmos-ai/llmos/pkg/applyinator"
+	"github.com/llmos-ai/llmos/pkg/applyinator/image"
+	"github.com/llmos-ai/llmos/pkg/bootstrap/config"
+	"github.com/llmos-ai/llmos/pkg/bootstrap/plan"
+	"github.com/llmos-ai/llmos/pkg/utils/crypt"
+	"github.com/llmos-ai/llmos/pkg/utils/signature"
+)
+
+const (
+	OutputJSON = "json"
+	// Stdin reads the plan from the standard input
+	Stdin = "-"
+
+	defaultAttempts = 3
+)
+
+var validName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// ApplyOptions configures the standalone apply of a plan.
+type ApplyOptions struct {
+	File       string
+	DataDir    string
+	ConfigPath string
+	// Name identifies the plan across applies, it defaults to the base name of the plan file
+	Name        string
+	RestartFrom string
+	Concurrency int
+	Facts       applyinator.Facts
+}
+
+// Load reads the JSON or YAML plan at the path and calculates it, see Parse.
+func Load(path string, trust *signature.TrustStore) (applyinator.CalculatedPlan, error) {
+	var (
+		content, sig []byte
+		err          error
+	)
+	if path == Stdin {
+		content, err = io.ReadAll(os.Stdin)
+	} else if content, err = crypt.ReadFile(path); err == nil {
+		sig, err = signature.ReadSignature(path)
+	}
+	if err != nil {
+		return applyinator.CalculatedPlan{}, fmt.Errorf("reading plan %s: %w", path, err)
+	}
+	return Parse(path, content, sig, trust)
+}
+
+// Parse calculates the JSON or YAML plan named name. Unknown fields are rejected, so that typos do not
+// silently change the plan. If the plan is signed and the trust store has keys, the signature is verified; a signed
+// plan is only warned about if the trust store has none, as the signature can't be verified. Without a trust store
+// the signature is ignored.
+func Parse(name string, content, sig []byte, trust *signature.TrustStore) (applyinator.CalculatedPlan, error) {
+	var err error
+	raw := content
+	if !json.Valid(raw) {
+		if raw, err = yaml.YAMLToJSON(content); err != nil {
+			return applyinator.CalculatedPlan{}, fmt.Errorf("decoding plan %s: %w", name, err)
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&applyinator.Plan{}); err != nil {
+		return applyinator.CalculatedPlan{}, fmt.Errorf("decoding plan %s: %w", name, err)
+	}
+
+	var calculated applyinator.CalculatedPlan
+	if sig != nil && len(trust.Keys()) > 0 {
+		calculated, err = applyinator.CalculateSignedPlan(content, sig, trust)
+	} else {
+		if sig != nil && trust != nil {
+			logrus.Warnf("The signature of %s is not verified, no trusted keys are configured", name)
+		}
+		calculated, err = applyinator.CalculatePlan(raw)
+	}
+	if err != nil {
+		return calculated, fmt.Errorf("invalid plan %s: %w", name, err)
+	}
+	return calculated, nil
+}
+
+// Validate checks the plan at the path and its signature without applying it.
+func Validate(w io.Writer, path, configPath string) error {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	trust, _, err := trustStores(&cfg)
+	if err != nil {
+		return err
+	}
+	calculated, err := Load(path, trust)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "plan %s is valid, checksum: %s\n", path, calculated.Checksum)
+	if calculated.SignedBy != "" {
+		fmt.Fprintf(w, "signed by trusted key %s\n", calculated.SignedBy)
+	} else {
+		fmt.Fprintln(w, "not signed")
+	}
+	return nil
+}
+
+// trustStores returns the trusted keys signed plans are verified against, and the same keys if
+// signed plans are enforced.
+func trustStores(cfg *config.Config) (*signature.TrustStore, *signature.TrustStore, error) {
+	enforced, err := signature.Open(cfg.PlanSignature)
+	if err != nil {
+		return nil, nil, err
+	}
+	if enforced != nil {
+		return enforced, enforced, nil
+	}
+	dir := signature.DefaultTrustDir
+	if cfg.PlanSignature != nil && cfg.PlanSignature.TrustDir != "" {
+		dir = cfg.PlanSignature.TrustDir
+	}
+	trust, err := signature.LoadTrustStore(dir)
+	return trust, nil, err
+}
+
+// Show prints the plan at the path with its sensitive values redacted,
+// or the last applied node plan if the path is empty.
+func Show(w io.Writer, path, dataDir string) error {
+	if path != "" {
+		calculated, err := Load(path, nil)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "Plan %s, checksum: %s\n\n", path, calculated.Checksum)
+		redacted := applyinator.RedactPlan(calculated.Plan)
+		return plan.Print(w, &redacted)
+	}
+
+	applied, err := applyinator.ReadAppliedPlans(plan.GetPlanAppliedDir(dataDir))
+	if err != nil {
+		return err
+	}
+	if len(applied) == 0 {
+		return fmt.Errorf("no plan was applied yet")
+	}
+	fmt.Fprintf(w, "Plan applied at %s, checksum: %s\n\n", applied[0].Applied.Format("2006-01-02 15:04:05"), applied[0].Checksum)
+	return plan.Print(w, &applied[0].Plan)
+}
+
+// HistoryEntry is a plan in the applied plan history.
+type HistoryEntry struct {
+	Timestamp string `json:"timestamp"`
+	// Plan is the name of the plan applied with `llmos plan apply`, <node> for the node plan
+	Plan         string `json:"plan"`
+	Applied      string `json:"applied"`
+	Checksum     string `json:"checksum"`
+	Files        int    `json:"files"`
+	Instructions int    `json:"instructions"`
+	Probes       int    `json:"probes"`
+}
+
+// History prints the applied plan history of the plan applied with `llmos plan apply` with the name, or of all the
+// plans if it is empty, the most recent plan first.
+func History(w io.Writer, dataDir, name, output string) error {
+	targets, err := historyTargets(dataDir)
+	if err != nil {
+		return err
+	}
+	if name != "" {
+		t, err := historyTarget(dataDir, name)
+		if err != nil {
+			return err
+		}
+		targets = []target{t}
+	}
+
+	entries := []HistoryEntry{}
+	for _, t := range targets {
+		applied, err := applyinator.ReadAppliedPlans(t.appliedDir)
+		if err != nil {
+			return err
+		}
+		for _, p := range applied {
+			entries = append(entries, HistoryEntry{
+				Timestamp:    p.Timestamp(),
+				Plan:         t.label(),
+				Applied:      p.Applied.Format("2006-01-02 15:04:05"),
+				Checksum:     p.Checksum,
+				Files:        len(p.Plan.Files),
+				Instructions: len(p.Plan.OneTimeInstructions),
+				Probes:       len(p.Plan.Probes),
+			})
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp > entries[j].Timestamp
+	})
+
+	if output == OutputJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIMESTAMP\tPLAN\tAPPLIED\tCHECKSUM\tFILES\tINSTRUCTIONS\tPROBES")
+	for _, e := range entries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\t%d\n", e.Timestamp, e.Plan, e.Applied,
+			e.Checksum[:min(12, len(e.Checksum))], e.Files, e.Instructions, e.Probes)
+	}
+	return tw.Flush()
+}
+
+// Apply applies the plan at the path to the node. The plan gets its own state, output, managed files record and
+// applied plan history under the data dir, named after the plan.
+func Apply(ctx context.Context, opts ApplyOptions) error {
+	name := opts.Name
+	if name == "" && opts.File != Stdin {
+		name = strings.TrimSuffix(filepath.Base(opts.File), filepath.Ext(opts.File))
+	}
+	if !validName.MatchString(name) {
+		return fmt.Errorf("invalid plan name %q, set a name of letters, digits, '.', '_' and '-' with --name", name)
+	}
+
+	// the llmos config provides the encryption, image and plan signature settings
+	cfg, err := config.Load(opts.ConfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	trust, _, err := trustStores(&cfg)
+	if err != nil {
+		return err
+	}
+	calculated, err := Load(opts.File, trust)
+	if err != nil {
+		return err
+	}
+	return applyPlan(ctx, &cfg, standaloneTarget(opts.DataDir, name), calculated, applySettings{
+		facts:       opts.Facts,
+		restartFrom: opts.RestartFrom,
+		concurrency: opts.Concurrency,
+	})
+}
+
+// nodePlanLabel names the node plan in the history, it is not a valid plan name.
+const nodePlanLabel = "<node>"
+
+// target is where the state of the plan is kept between applies.
+type target struct {
+	name string
+	// standalone is set for the plans applied with `llmos plan apply`, a standalone plan may be named node
+	standalone       bool
+	dataDir          string
+	workDir          string
+	appliedDir       string
+	stateFile        string
+	outputFile       string
+	managedFilesFile string
+}
+
+// nodeTarget is the node plan generated by the bootstrap.
+func nodeTarget(dataDir string) target {
+	return target{
+		name:             "node",
+		dataDir:          dataDir,
+		workDir:          filepath.Join(dataDir, "plan", "work"),
+		appliedDir:       plan.GetPlanAppliedDir(dataDir),
+		stateFile:        plan.GetPlanStateFile(dataDir),
+		outputFile:       plan.GetPlanOutput(dataDir),
+		managedFilesFile: plan.GetPlanManagedFilesFile(dataDir),
+	}
+}
+
+// standaloneTarget is a plan applied with `llmos plan apply`.
+func standaloneTarget(dataDir, name string) target {
+	dir := GetStandalonePlanDir(dataDir, name)
+	return target{
+		name:             name,
+		standalone:       true,
+		dataDir:          dataDir,
+		workDir:          filepath.Join(dir, "work"),
+		appliedDir:       GetPlanHistoryDir(dataDir, name),
+		stateFile:        filepath.Join(dir, "state.json"),
+		outputFile:       filepath.Join(dir, "output.json"),
+		managedFilesFile: filepath.Join(dir, "managed-files.json"),
+	}
+}
+
+func (t target) String() string {
+	if t.standalone {
+		return "plan " + t.name
+	}
+	return "the node plan"
+}
+
+// label names the target in the history.
+func (t target) label() string {
+	if t.standalone {
+		return t.name
+	}
+	return nodePlanLabel
+}
+
+// selector returns how the target is selected on the command line.
+func (t target) selector() string {
+	if t.standalone {
+		return "--name " + t.name
+	}
+	return "no --name"
+}
+
+// historyTarget returns the plan applied with `llmos plan apply` with the name, or the node plan if it is empty.
+func historyTarget(dataDir, name string) (target, error) {
+	if name == "" {
+		return nodeTarget(dataDir), nil
+	}
+	if !validName.MatchString(name) {
+		return target{}, fmt.Errorf("invalid plan name %q", name)
+	}
+	return standaloneTarget(dataDir, name), nil
+}
+
+// historyTargets returns the node plan followed by the plans applied with `llmos plan apply` by name.
+func historyTargets(dataDir string) ([]target, error) {
+	targets := []target{nodeTarget(dataDir)}
+	entries, err := os.ReadDir(filepath.Join(dataDir, "plans"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && validName.MatchString(entry.Name()) {
+			targets = append(targets, standaloneTarget(dataDir, entry.Name()))
+		}
+	}
+	return targets, nil
+}
+
+// readAppliedPlan returns the plan of the history of the target applied at the time stamp. It refuses the plans of
+// the other targets, applying them to the target would remove the files it manages.
+func readAppliedPlan(t target, timestamp string) (applyinator.AppliedPlan, error) {
+	applied, err := applyinator.ReadAppliedPlan(t.appliedDir, timestamp)
+	if !os.IsNotExist(err) {
+		return applied, err
+	}
+	targets, terr := historyTargets(t.dataDir)
+	if terr != nil {
+		return applied, terr
+	}
+	for _, other := range targets {
+		if other.appliedDir == t.appliedDir {
+			continue
+		}
+		if _, serr := os.Stat(filepath.Join(other.appliedDir, applied.Name)); serr == nil {
+			return applied, fmt.Errorf("the plan applied at %s is %s, not %s, select it with %s",
+				timestamp, other, t, other.selector())
+		}
+	}
+	return applied, err
+}
+
+type applySettings struct {
+	facts       applyinator.Facts
+	restartFrom string
+	concurrency int
+}
+
+// applyPlan applies the plan with the state of the target, recording it in the history of the target and the
+// shared backups.
+func applyPlan(ctx context.Context, cfg *config.Config, t target, calculated applyinator.CalculatedPlan, settings applySettings) error {
+	cipher, err := crypt.Open(cfg.Encryption)
+	if err != nil {
+		return fmt.Errorf("opening encryption key: %w", err)
+	}
+	_, enforced, err := trustStores(cfg)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(t.stateFile), 0700); err != nil {
+		return err
+	}
+	existingOutput, err := plan.LoadOutput(t.outputFile)
+	if err != nil {
+		return err
+	}
+
+	apply := applyinator.NewApplyinator(t.workDir, false, t.appliedDir, "", image.NewUtility(cfg.ImageUtility))
+	apply.SetCipher(cipher)
+	apply.SetBackupStore(applyinator.NewBackupStore(plan.GetPlanBackupDir(t.dataDir), cipher))
+	apply.SetTrustStore(enforced)
+
+	logrus.Infof("Applying plan %s with checksum %s", t.name, calculated.Checksum)
+	output, err := apply.Apply(ctx, applyinator.ApplyInput{
+		CalculatedPlan:                calculated,
+		RunOneTimeInstructions:        true,
+		ReconcileFiles:                true,
+		Facts:                         settings.facts,
+		OneTimeInstructionAttempts:    defaultAttempts,
+		OneTimeInstructionConcurrency: settings.concurrency,
+		ExistingOneTimeOutput:         existingOutput,
+		StateFile:                     t.stateFile,
+		ManagedFilesFile:              t.managedFilesFile,
+		RestartFrom:                   settings.restartFrom,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to apply plan: %w", err)
+	}
+	if err = plan.SaveOutput(output.OneTimeOutput, t.outputFile, cipher); err != nil {
+		return err
+	}
+
+	if !output.OneTimeApplySucceeded {
+		return fmt.Errorf("plan %s is not applied successfully, run `llmos plan rollback-files --checksum %s` "+
+			"to restore the files it changed", t.name, calculated.Checksum)
+	}
+	logrus.Infof("Successfully applied plan %s", t.name)
+	return nil
+}
+
+// GetPlanHistoryDir returns the applied plan history of the plan applied with `llmos plan apply` with the name, or
+// of the node plan if the name is empty.
+func GetPlanHistoryDir(dataDir, name string) string {
+	if name == "" {
+		return plan.GetPlanAppliedDir(dataDir)
+	}
+	return filepath.Join(GetStandalonePlanDir(dataDir, name), "applied")
+}
+
+// GetStandalonePlanDir returns the directory holding the state of the plan applied with `llmos plan apply`.
+func GetStandalonePlanDir(dataDir, name string) string {
+	return filepath.Join(dataDir, "plans", name)
+}
@@ -0,0 +1,65 @@
+package plan_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+
+	cliplan "github.com/llmos-ai/llmos/pkg/cli/plan"
+	"github.com/llmos-ai/llmos/pkg/utils/signature"
+)
+
+var _ = Describe("plan parse", Label("plan", "parse"), func() {
+	const content = `{"files": [{"path": "/etc/llmos/motd", "content": "aGVsbG8K"}]}`
+
+	var (
+		dir  string
+		logs *bytes.Buffer
+		sig  []byte
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		logs = &bytes.Buffer{}
+		out := logrus.StandardLogger().Out
+		logrus.SetOutput(logs)
+		DeferCleanup(logrus.SetOutput, out)
+
+		Expect(signature.GenerateKey(filepath.Join(dir, "trust", "ops.key"))).To(Succeed())
+		key, err := signature.LoadPrivateKey(filepath.Join(dir, "trust", "ops.key"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.Remove(filepath.Join(dir, "trust", "ops.key"))).To(Succeed())
+		sig = signature.Sign([]byte(content), key)
+	})
+
+	It("verifies the signature against the trusted keys", func() {
+		trust, err := signature.LoadTrustStore(filepath.Join(dir, "trust"))
+		Expect(err).NotTo(HaveOccurred())
+
+		calculated, err := cliplan.Parse("plan secret llmos-system/node1", []byte(content), sig, trust)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(calculated.SignedBy).To(Equal("ops"))
+		Expect(logs.String()).To(BeEmpty())
+	})
+
+	It("warns about signatures that can't be verified without trusted keys", func() {
+		trust, err := signature.LoadTrustStore(filepath.Join(dir, "missing"))
+		Expect(err).NotTo(HaveOccurred())
+
+		calculated, err := cliplan.Parse("plan secret llmos-system/node1", []byte(content), sig, trust)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(calculated.SignedBy).To(BeEmpty())
+		Expect(logs.String()).To(ContainSubstring(
+			"The signature of plan secret llmos-system/node1 is not verified, no trusted keys are configured"))
+	})
+
+	It("ignores the signature without a trust store", func() {
+		_, err := cliplan.Parse("plan.json", []byte(content), sig, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(logs.String()).To(BeEmpty())
+	})
+})
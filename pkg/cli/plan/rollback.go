@@ -0,0 +1,243 @@
+package plan
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/llmos-ai/llmos/pkg/applyinator"
+	"github.com/llmos-ai/llmos/pkg/bootstrap/config"
+	"github.com/llmos-ai/llmos/pkg/bootstrap/plan"
+	"github.com/llmos-ai/llmos/pkg/bootstrap/version"
+	"github.com/llmos-ai/llmos/pkg/utils/signature"
+)
+
+// RollbackFilesOptions selects the plan whose file changes are rolled back.
+type RollbackFilesOptions struct {
+	DataDir string
+	// Checksum of the plan, defaults to the last applied plan
+	Checksum string
+	// Force restores the files even if the plan did not fail
+	Force bool
+}
+
+// RollbackFiles restores the files overwritten by the plan to the content they had before, which is
+// the content of the previously applied plan.
+func RollbackFiles(w io.Writer, opts RollbackFilesOptions) error {
+	state, err := applyinator.ReadPlanState(plan.GetPlanStateFile(opts.DataDir))
+	if err != nil {
+		return fmt.Errorf("reading plan state: %w", err)
+	}
+
+	checksum := opts.Checksum
+	if checksum == "" {
+		if state.Checksum == "" {
+			return fmt.Errorf("no plan was applied yet")
+		}
+		checksum = state.Checksum
+	}
+	if checksum == state.Checksum && !opts.Force && !failed(state) {
+		return fmt.Errorf("plan %s did not fail, use --force to restore its files anyway", checksum)
+	}
+
+	store := applyinator.NewBackupStore(plan.GetPlanBackupDir(opts.DataDir), nil)
+	set, err := store.Get(checksum)
+	if err != nil {
+		return err
+	}
+	if set == nil {
+		return fmt.Errorf("plan %s did not change any file", checksum)
+	}
+
+	restored, err := store.Restore(*set)
+	for _, path := range restored {
+		fmt.Fprintf(w, "restored %s\n", path)
+	}
+	return err
+}
+
+func failed(state *applyinator.PlanState) bool {
+	for _, status := range state.Instructions {
+		if status.State == applyinator.InstructionFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// RollbackOptions selects the applied plan that is applied again.
+type RollbackOptions struct {
+	DataDir    string
+	ConfigPath string
+	// Timestamp of the plan in the applied plan history
+	Timestamp string
+	// Name of the plan applied with `llmos plan apply` whose state is used, the bootstrap node plan if empty
+	Name string
+	// Env holds the values of the sensitive env of the instructions, the history does not record them
+	Env         map[string]string
+	Facts       applyinator.Facts
+	Concurrency int
+}
+
+// Rollback applies the plan recorded in the applied plan history again. Signed plans are applied again from the
+// signed content the history keeps for them, unsigned plans from the unredacted plan the history keeps if it is
+// encrypted. Otherwise the history of unsigned plans is redacted, so they are only applied again if the sensitive
+// files still have the content of the plan and the values of the sensitive env are passed in; unsigned plans can't
+// be rolled back if plan signatures are enforced.
+func Rollback(ctx context.Context, opts RollbackOptions) error {
+	t, err := historyTarget(opts.DataDir, opts.Name)
+	if err != nil {
+		return err
+	}
+	applied, err := readAppliedPlan(t, opts.Timestamp)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("no plan was applied at %s, see `llmos plan history`", opts.Timestamp)
+	} else if err != nil {
+		return err
+	}
+
+	cfg, err := config.Load(opts.ConfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	enforced, err := signature.Open(cfg.PlanSignature)
+	if err != nil {
+		return err
+	}
+
+	var calculated applyinator.CalculatedPlan
+	switch {
+	case len(applied.Signed) == 0 && enforced != nil:
+		return fmt.Errorf("plan %s can't be applied again: it is not signed and plan signatures are enforced", opts.Timestamp)
+	case len(applied.Signed) > 0 || applied.Unredacted != nil:
+		if calculated, err = applied.Original(); err != nil {
+			return fmt.Errorf("plan %s can't be applied again: %w", opts.Timestamp, err)
+		}
+	default:
+		if calculated, err = restoreRedacted(applied.CalculatedPlan, opts.Env); err != nil {
+			return fmt.Errorf("plan %s can't be applied again: %w", opts.Timestamp, err)
+		}
+	}
+
+	facts := applyinator.Facts{}
+	if !t.standalone {
+		k8sVersion, err := version.K8sVersion(cfg.KubernetesVersion)
+		if err != nil {
+			return err
+		}
+		facts = plan.ToFacts(&cfg, k8sVersion)
+	}
+	for key, value := range opts.Facts {
+		facts[key] = value
+	}
+
+	logrus.Infof("Rolling back plan %s to the plan applied at %s (checksum %s)", t.name, opts.Timestamp, applied.Checksum)
+	return applyPlan(ctx, &cfg, t, calculated, applySettings{
+		facts:       facts,
+		concurrency: opts.Concurrency,
+	})
+}
+
+// restoreRedacted returns the plan with the values masked in the history put back: sensitive files get the
+// content they have on the node, and sensitive env the values passed in. It fails unless the restored plan is the
+// recorded one, as the sensitive files changed since or the values passed in are not the ones of the plan.
+func restoreRedacted(applied applyinator.CalculatedPlan, env map[string]string) (applyinator.CalculatedPlan, error) {
+	p, err := restoreRedactedPlan(applied.Plan, env)
+	if err != nil {
+		return applyinator.CalculatedPlan{}, err
+	}
+	raw, err := json.Marshal(p)
+	if err != nil {
+		return applyinator.CalculatedPlan{}, err
+	}
+	calculated, err := applyinator.CalculatePlan(raw)
+	if err != nil {
+		return calculated, err
+	}
+	if calculated.Checksum != applied.Checksum {
+		var sensitive []string
+		for _, file := range p.Files {
+			if file.Sensitive {
+				sensitive = append(sensitive, file.Path)
+			}
+		}
+		if len(sensitive) == 0 {
+			return calculated, fmt.Errorf("the values of the sensitive env are not the ones of the plan")
+		}
+		return calculated, fmt.Errorf("the history does not record the content of the sensitive files %s, "+
+			"they or the values of the sensitive env differ from the ones of the plan; enable the encryption for the "+
+			"history to record them", strings.Join(sensitive, ", "))
+	}
+	return calculated, nil
+}
+
+func restoreRedactedPlan(p applyinator.Plan, env map[string]string) (applyinator.Plan, error) {
+	redactedContent := base64.StdEncoding.EncodeToString([]byte(applyinator.Redacted + "\n"))
+	p.Redacted = false
+
+	files := make([]applyinator.File, len(p.Files))
+	for i, file := range p.Files {
+		if file.Sensitive && file.Content == redactedContent {
+			content, err := os.ReadFile(file.Path)
+			if err != nil {
+				return p, fmt.Errorf("the content of sensitive file %s is not recorded in the history: %w", file.Path, err)
+			}
+			file.Content = base64.StdEncoding.EncodeToString(content)
+		}
+		files[i] = file
+	}
+	p.Files = files
+
+	var missing []string
+	restore := func(instruction applyinator.CommonInstruction) (applyinator.CommonInstruction, error) {
+		restoredEnv := make([]string, len(instruction.Env))
+		for i, e := range instruction.Env {
+			if key, value, _ := strings.Cut(e, "="); value == applyinator.Redacted {
+				if v, ok := env[key]; ok {
+					e = key + "=" + v
+				} else if !slices.Contains(missing, key) {
+					missing = append(missing, key)
+				}
+			}
+			restoredEnv[i] = e
+		}
+		instruction.Env = restoredEnv
+		for _, arg := range instruction.Args {
+			if strings.Contains(arg, applyinator.Redacted) {
+				return instruction, fmt.Errorf("the arguments of instruction %s are redacted", instruction.Name)
+			}
+		}
+		return instruction, nil
+	}
+
+	var err error
+	oneTime := make([]applyinator.OneTimeInstruction, len(p.OneTimeInstructions))
+	for i, instruction := range p.OneTimeInstructions {
+		if instruction.CommonInstruction, err = restore(instruction.CommonInstruction); err != nil {
+			return p, err
+		}
+		oneTime[i] = instruction
+	}
+	p.OneTimeInstructions = oneTime
+	periodic := make([]applyinator.PeriodicInstruction, len(p.PeriodicInstructions))
+	for i, instruction := range p.PeriodicInstructions {
+		if instruction.CommonInstruction, err = restore(instruction.CommonInstruction); err != nil {
+			return p, err
+		}
+		periodic[i] = instruction
+	}
+	p.PeriodicInstructions = periodic
+
+	if len(missing) > 0 {
+		return p, fmt.Errorf("the history does not record the sensitive env %s, set the values with --env KEY=VALUE",
+			strings.Join(missing, ", "))
+	}
+	return p, nil
+}
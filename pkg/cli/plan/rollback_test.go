@@ -0,0 +1,165 @@
+package plan_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/llmos-ai/llmos/pkg/applyinator"
+	cliplan "github.com/llmos-ai/llmos/pkg/cli/plan"
+)
+
+var _ = Describe("plan rollback", Label("plan", "rollback"), func() {
+	const timestamp = "20240101-000000"
+
+	var (
+		dir, tokenFile, output string
+		opts                   cliplan.RollbackOptions
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		tokenFile = filepath.Join(dir, "token")
+		output = filepath.Join(dir, "output")
+
+		configPath := filepath.Join(dir, "config.yaml")
+		Expect(os.WriteFile(configPath, nil, 0600)).To(Succeed())
+		opts = cliplan.RollbackOptions{
+			DataDir:    filepath.Join(dir, "data"),
+			ConfigPath: configPath,
+			Timestamp:  timestamp,
+			Name:       "demo",
+			Env:        map[string]string{"PASSWORD": "s3cr3t-password"},
+		}
+	})
+
+	// record records a plan writing the sensitive file and an instruction echoing the sensitive env.
+	record := func(files ...applyinator.File) {
+		recordApplied(opts.DataDir, opts.Name, timestamp, applyinator.Plan{
+			Files: files,
+			OneTimeInstructions: []applyinator.OneTimeInstruction{{CommonInstruction: applyinator.CommonInstruction{
+				Name:         "login",
+				Command:      "/bin/sh",
+				Args:         []string{"-c", `echo "$PASSWORD" > ` + output},
+				Env:          []string{"PASSWORD=s3cr3t-password"},
+				SensitiveEnv: []string{"PASSWORD"},
+			}}},
+		})
+	}
+	sensitiveFile := func() applyinator.File {
+		return applyinator.File{Path: tokenFile, Encoding: "plain", Content: "t0ken-value\n", Permissions: "0600", Sensitive: true}
+	}
+
+	It("applies the plan again with the content of the sensitive files on the node", func() {
+		record(sensitiveFile())
+		Expect(os.WriteFile(tokenFile, []byte("t0ken-value\n"), 0600)).To(Succeed())
+
+		Expect(cliplan.Rollback(context.Background(), opts)).To(Succeed())
+		Expect(os.ReadFile(output)).To(Equal([]byte("s3cr3t-password\n")))
+		Expect(os.ReadFile(tokenFile)).To(Equal([]byte("t0ken-value\n")))
+	})
+
+	It("fails if a sensitive file changed since the plan was applied", func() {
+		record(sensitiveFile())
+		Expect(os.WriteFile(tokenFile, []byte("rotated-token\n"), 0600)).To(Succeed())
+
+		err := cliplan.Rollback(context.Background(), opts)
+		Expect(err).To(MatchError("plan " + timestamp + " can't be applied again: the history does not record the " +
+			"content of the sensitive files " + tokenFile + ", they or the values of the sensitive env differ from the ones of the plan; " +
+			"enable the encryption for the history to record them"))
+		Expect(output).NotTo(BeAnExistingFile())
+		Expect(os.ReadFile(tokenFile)).To(Equal([]byte("rotated-token\n")))
+	})
+
+	It("fails if a sensitive file is missing", func() {
+		record(sensitiveFile())
+
+		err := cliplan.Rollback(context.Background(), opts)
+		Expect(err).To(MatchError(ContainSubstring("the content of sensitive file " + tokenFile + " is not recorded in the history")))
+		Expect(err).To(MatchError(os.ErrNotExist))
+		Expect(output).NotTo(BeAnExistingFile())
+	})
+
+	It("fails without the values of the sensitive env", func() {
+		record()
+		opts.Env = nil
+
+		err := cliplan.Rollback(context.Background(), opts)
+		Expect(err).To(MatchError("plan " + timestamp + " can't be applied again: the history does not record the " +
+			"sensitive env PASSWORD, set the values with --env KEY=VALUE"))
+	})
+
+	It("fails if the values of the sensitive env are not the ones of the plan", func() {
+		record()
+		opts.Env = map[string]string{"PASSWORD": "wrong-password"}
+
+		err := cliplan.Rollback(context.Background(), opts)
+		Expect(err).To(MatchError("plan " + timestamp + " can't be applied again: the values of the sensitive env are " +
+			"not the ones of the plan"))
+		Expect(output).NotTo(BeAnExistingFile())
+	})
+
+	It("applies the plan again from the encrypted history", func() {
+		Expect(os.WriteFile(opts.ConfigPath, []byte("encryption:\n  enabled: true\n  keyFile: "+
+			filepath.Join(dir, "encryption.key")+"\n"), 0600)).To(Succeed())
+		apply := func(plan applyinator.Plan) {
+			planFile := filepath.Join(dir, "demo.json")
+			raw, err := json.Marshal(plan)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.WriteFile(planFile, raw, 0600)).To(Succeed())
+			Expect(cliplan.Apply(context.Background(), cliplan.ApplyOptions{
+				File: planFile, DataDir: opts.DataDir, ConfigPath: opts.ConfigPath,
+			})).To(Succeed())
+		}
+		apply(applyinator.Plan{
+			Files: []applyinator.File{sensitiveFile()},
+			OneTimeInstructions: []applyinator.OneTimeInstruction{{CommonInstruction: applyinator.CommonInstruction{
+				Name:         "login",
+				Command:      "/bin/sh",
+				Args:         []string{"-c", `echo "$PASSWORD" > ` + output},
+				Env:          []string{"PASSWORD=s3cr3t-password"},
+				SensitiveEnv: []string{"PASSWORD"},
+			}}},
+		})
+		// the entry is dated back so that the next plan applied within the same second doesn't replace it
+		historyDir := cliplan.GetPlanHistoryDir(opts.DataDir, "demo")
+		entries, err := os.ReadDir(historyDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(2))
+		for _, entry := range entries {
+			Expect(os.Rename(filepath.Join(historyDir, entry.Name()),
+				filepath.Join(historyDir, timestamp+entry.Name()[len(timestamp):]))).To(Succeed())
+		}
+
+		// the next plan rotates the token
+		rotated := sensitiveFile()
+		rotated.Content = "rotated-token\n"
+		apply(applyinator.Plan{Files: []applyinator.File{rotated}})
+		Expect(os.Remove(output)).To(Succeed())
+
+		opts.Env = nil
+		Expect(cliplan.Rollback(context.Background(), opts)).To(Succeed())
+		Expect(os.ReadFile(tokenFile)).To(Equal([]byte("t0ken-value\n")))
+		Expect(os.ReadFile(output)).To(Equal([]byte("s3cr3t-password\n")))
+	})
+
+	It("refuses the plans of the history of another plan", func() {
+		recordApplied(opts.DataDir, "", timestamp, applyinator.Plan{})
+		err := cliplan.Rollback(context.Background(), opts)
+		Expect(err).To(MatchError("the plan applied at " + timestamp + " is the node plan, not plan demo, select it with no --name"))
+
+		recordApplied(opts.DataDir, "other", "20240102-000000", applyinator.Plan{})
+		opts.Name, opts.Timestamp = "", "20240102-000000"
+		err = cliplan.Rollback(context.Background(), opts)
+		Expect(err).To(MatchError("the plan applied at 20240102-000000 is plan other, not the node plan, select it with --name other"))
+	})
+
+	It("fails for plans missing from the history", func() {
+		err := cliplan.Rollback(context.Background(), opts)
+		Expect(err).To(MatchError("no plan was applied at " + timestamp + ", see `llmos plan history`"))
+	})
+})
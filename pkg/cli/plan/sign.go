@@ -0,0 +1,50 @@
+package plan
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/llmos-ai/llmos/pkg/utils/crypt"
+	"github.com/llmos-ai/llmos/pkg/utils/signature"
+)
+
+// SignOptions selects the plan files to sign and the private key to sign them with.
+type SignOptions struct {
+	Key string
+	// GenerateKey creates the key and its public key if the key does not exist yet
+	GenerateKey bool
+	Files       []string
+}
+
+// Sign writes the detached signature of every plan file next to it.
+func Sign(w io.Writer, opts SignOptions) error {
+	if opts.GenerateKey {
+		if _, err := os.Stat(opts.Key); os.IsNotExist(err) {
+			if err = signature.GenerateKey(opts.Key); err != nil {
+				return fmt.Errorf("generating key %s: %w", opts.Key, err)
+			}
+			fmt.Fprintf(w, "generated key %s, copy its public key to %s on the nodes\n", opts.Key, signature.DefaultTrustDir)
+		}
+	}
+
+	key, err := signature.LoadPrivateKey(opts.Key)
+	if err != nil {
+		return err
+	}
+	for _, path := range opts.Files {
+		// sign the plan exactly as it is read when applied, validating it first
+		if _, err = Load(path, nil); err != nil {
+			return err
+		}
+		content, err := crypt.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err = os.WriteFile(path+signature.FileSuffix, signature.Sign(content, key), 0644); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "signed %s, signature: %s\n", path, path+signature.FileSuffix)
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package probe
 import (
 	"fmt"
 	"os"
+	"slices"
 	"strings"
 
 	"github.com/llmos-ai/llmos/utils/cmd"
@@ -19,7 +20,7 @@ var probes = map[string]prober.Probe{
 		TimeoutSeconds:      5,
 		SuccessThreshold:    1,
 		FailureThreshold:    2,
-		HTTPGetAction: prober.HTTPGetAction{
+		HTTPGetAction: &prober.HTTPGetAction{
 			URL:        "https://127.0.0.1:6443/readyz",
 			CACert:     "/var/lib/rancher/%s/server/tls/server-ca.crt",
 			ClientCert: "/var/lib/rancher/%s/server/tls/client-kube-apiserver.crt",
@@ -31,7 +32,7 @@ var probes = map[string]prober.Probe{
 		TimeoutSeconds:      5,
 		SuccessThreshold:    1,
 		FailureThreshold:    2,
-		HTTPGetAction: prober.HTTPGetAction{
+		HTTPGetAction: &prober.HTTPGetAction{
 			URL:      "https://127.0.0.1:10259/healthz",
 			Insecure: true,
 		},
@@ -41,7 +42,7 @@ var probes = map[string]prober.Probe{
 		TimeoutSeconds:      5,
 		SuccessThreshold:    1,
 		FailureThreshold:    2,
-		HTTPGetAction: prober.HTTPGetAction{
+		HTTPGetAction: &prober.HTTPGetAction{
 			URL:      "https://127.0.0.1:10257/healthz",
 			Insecure: true,
 		},
@@ -51,7 +52,7 @@ var probes = map[string]prober.Probe{
 		TimeoutSeconds:      5,
 		SuccessThreshold:    1,
 		FailureThreshold:    2,
-		HTTPGetAction: prober.HTTPGetAction{
+		HTTPGetAction: &prober.HTTPGetAction{
 			URL: "http://127.0.0.1:10248/healthz",
 		},
 	},
@@ -77,32 +78,138 @@ func AllProbes(runtime config.Runtime) map[string]prober.Probe {
 	return replaceRuntimeForProbes(probes, runtime)
 }
 
+// ConfigProbes returns the probes declared in the config that apply to the role of the node.
+func ConfigProbes(cfg *config.Config, runtime config.Runtime) map[string]prober.Probe {
+	selected := map[string]prober.Probe{}
+	for name, probeConfig := range cfg.Probes {
+		if !forRole(probeConfig.Roles, string(cfg.Role)) {
+			continue
+		}
+		selected[name] = probeConfig.Probe
+	}
+	return replaceRuntimeForProbes(selected, runtime)
+}
+
+// ValidateConfigProbes checks the probes declared in the config.
+func ValidateConfigProbes(probeConfigs map[string]config.ProbeConfig) error {
+	for name, probeConfig := range probeConfigs {
+		if _, ok := probes[name]; ok {
+			return fmt.Errorf("probe %s conflicts with a built-in probe", name)
+		}
+		if err := prober.ValidateProbe(probeConfig.Probe); err != nil {
+			return fmt.Errorf("invalid probe %s: %w", name, err)
+		}
+		for _, r := range probeConfig.Roles {
+			if !slices.Contains(probeRoles, r) {
+				return fmt.Errorf("invalid probe %s: unknown role %s, must be one of %s", name, r, strings.Join(probeRoles, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+var probeRoles = []string{
+	string(config.ClusterInitRole), string(config.ServerRole), string(config.AgentRole),
+	"etcd", "control-plane", "worker",
+}
+
+// forRole returns true if the node role matches one of the probe roles, probes without roles run on every node.
+func forRole(probeRoles []string, nodeRole string) bool {
+	if len(probeRoles) == 0 {
+		return true
+	}
+	for _, r := range probeRoles {
+		switch r {
+		case "etcd":
+			if role.IsEtcd(nodeRole) {
+				return true
+			}
+		case "control-plane":
+			if role.IsControlPlane(nodeRole) {
+				return true
+			}
+		case "worker":
+			if role.IsWorker(nodeRole) {
+				return true
+			}
+		default:
+			if r == nodeRole {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func replaceRuntimeForProbes(probes map[string]prober.Probe, runtime config.Runtime) map[string]prober.Probe {
 	result := map[string]prober.Probe{}
 	for k, v := range probes {
 		// we don't know the runtime to find the file
-		if runtime == config.RuntimeUnknown && (v.HTTPGetAction.CACert+
-			v.HTTPGetAction.ClientCert+
-			v.HTTPGetAction.ClientKey) != "" {
+		if runtime == config.RuntimeUnknown && usesRuntime(v) {
 			continue
 		}
-		v.HTTPGetAction.CACert = replaceRuntime(v.HTTPGetAction.CACert, runtime)
-		v.HTTPGetAction.ClientCert = replaceRuntime(v.HTTPGetAction.ClientCert, runtime)
-		v.HTTPGetAction.ClientKey = replaceRuntime(v.HTTPGetAction.ClientKey, runtime)
+		if v.HTTPGetAction != nil {
+			action := *v.HTTPGetAction
+			action.CACert = replaceRuntime(action.CACert, runtime)
+			action.ClientCert = replaceRuntime(action.ClientCert, runtime)
+			action.ClientKey = replaceRuntime(action.ClientKey, runtime)
+			v.HTTPGetAction = &action
+		}
+		if v.ExecAction != nil {
+			action := prober.ExecAction{}
+			for _, arg := range v.ExecAction.Command {
+				action.Command = append(action.Command, replaceRuntime(arg, runtime))
+			}
+			v.ExecAction = &action
+		}
+		if v.FileExistsAction != nil {
+			v.FileExistsAction = &prober.FileExistsAction{
+				Path: replaceRuntime(v.FileExistsAction.Path, runtime),
+			}
+		}
 		result[k] = v
 	}
 	return result
 }
 
-func ToInstruction() (*applyinator.OneTimeInstruction, error) {
+// usesRuntime returns true if the probe refers to files of the kubernetes runtime
+func usesRuntime(probe prober.Probe) bool {
+	var refs []string
+	if probe.HTTPGetAction != nil {
+		refs = append(refs, probe.HTTPGetAction.CACert, probe.HTTPGetAction.ClientCert, probe.HTTPGetAction.ClientKey)
+	}
+	if probe.ExecAction != nil {
+		refs = append(refs, probe.ExecAction.Command...)
+	}
+	if probe.FileExistsAction != nil {
+		refs = append(refs, probe.FileExistsAction.Path)
+	}
+	for _, ref := range refs {
+		if strings.Contains(ref, "%s") {
+			return true
+		}
+	}
+	return false
+}
+
+// probeTimeout fails the probe instruction, so it is retried and the statuses of the unhealthy probes are saved in its output
+const probeTimeout = "10m"
+
+// ToInstruction returns the instruction that waits for the probes of the plan to be healthy,
+// only the named probes are run if names are given.
+func ToInstruction(name string, probeNames ...string) (*applyinator.OneTimeInstruction, error) {
 	cmd, err := cmd.Self()
 	if err != nil {
 		return nil, fmt.Errorf("resolving location of %s: %w", os.Args[0], err)
 	}
+	args := []string{"probe", "--timeout", probeTimeout, "--output", OutputJSON}
+	for _, probeName := range probeNames {
+		args = append(args, "--name", probeName)
+	}
 	return &applyinator.OneTimeInstruction{
 		CommonInstruction: applyinator.CommonInstruction{
-			Name:    "probes",
-			Args:    []string{"probe"},
+			Name:    name,
+			Args:    args,
 			Command: cmd,
 		},
 		SaveOutput: true,
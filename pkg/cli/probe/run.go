@@ -5,37 +5,66 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/llmos-ai/llmos/pkg/applyinator"
 	"github.com/llmos-ai/llmos/pkg/applyinator/prober"
+	"github.com/llmos-ai/llmos/pkg/utils/crypt"
 )
 
-func RunProbes(_ context.Context, planFile string, interval time.Duration) error {
-	f, err := os.Open(planFile)
+const OutputJSON = "json"
+
+type Options struct {
+	// Interval between two probe runs
+	Interval time.Duration
+	// Timeout after which unhealthy probes fail the run, 0 waits until all probes are healthy
+	Timeout time.Duration
+	// Names of the probes to run, all probes of the plan are run if empty
+	Names []string
+	// Output format of the final probe statuses written to stdout, empty for none
+	Output string
+}
+
+// RunProbes runs the probes of the plan until all of them are healthy or the timeout is reached.
+func RunProbes(ctx context.Context, planFile string, opts Options) error {
+	content, err := crypt.ReadFile(planFile)
 	if err != nil {
-		return fmt.Errorf("opening plan %s: %w", planFile, err)
+		return fmt.Errorf("reading plan %s: %w", planFile, err)
 	}
-	defer func() {
-		err = f.Close()
-		if err != nil {
-			logrus.Fatalln(err)
-		}
-	}()
 
 	plan := &applyinator.Plan{}
-	if err = json.NewDecoder(f).Decode(plan); err != nil {
+	if err = json.Unmarshal(content, plan); err != nil {
 		return err
 	}
 
+	if len(opts.Names) > 0 {
+		selected := map[string]prober.Probe{}
+		for _, name := range opts.Names {
+			p, ok := plan.Probes[name]
+			if !ok {
+				return fmt.Errorf("probe %s is not defined in %s", name, planFile)
+			}
+			selected[name] = p
+		}
+		plan.Probes = selected
+	}
+
 	if len(plan.Probes) == 0 {
 		logrus.Infof("No probes defined in %s", planFile)
 		return nil
 	}
 	logrus.Infof("Running probes defined in %s", planFile)
 
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
 	probeStatuses := make(map[string]prober.ProbeStatus)
 	initial := true
 
@@ -48,7 +77,7 @@ func RunProbes(_ context.Context, planFile string, interval time.Duration) error
 		allGood := true
 		prober.DoProbes(plan.Probes, newProbeStatuses, initial)
 
-		for probeName, probeStatus := range probeStatuses {
+		for probeName, probeStatus := range newProbeStatuses {
 			if !probeStatus.Healthy {
 				allGood = false
 			}
@@ -63,15 +92,54 @@ func RunProbes(_ context.Context, planFile string, interval time.Duration) error
 			}
 		}
 
+		probeStatuses = newProbeStatuses
+		initial = false
+
 		if allGood {
 			logrus.Info("All probes are healthy")
-			break
+			return writeStatuses(probeStatuses, opts.Output)
 		}
 
-		probeStatuses = newProbeStatuses
-		initial = false
-		time.Sleep(interval)
+		select {
+		case <-ctx.Done():
+			if err := writeStatuses(probeStatuses, opts.Output); err != nil {
+				logrus.Errorf("failed to write probe statuses: %v", err)
+			}
+			if ctx.Err() != context.DeadlineExceeded {
+				return ctx.Err()
+			}
+			return fmt.Errorf("probes are not healthy after %v: %s", opts.Timeout, unhealthyProbes(probeStatuses))
+		case <-time.After(opts.Interval):
+		}
 	}
+}
 
-	return nil
+// unhealthyProbes lists the unhealthy probes with their last error or output.
+func unhealthyProbes(probeStatuses map[string]prober.ProbeStatus) string {
+	var result []string
+	for name, status := range probeStatuses {
+		if status.Healthy {
+			continue
+		}
+		reason := status.LastError
+		if reason == "" {
+			reason = strings.TrimSpace(status.LastOutput)
+		}
+		if reason == "" {
+			result = append(result, name)
+		} else {
+			result = append(result, fmt.Sprintf("%s (%s)", name, reason))
+		}
+	}
+	sort.Strings(result)
+	return strings.Join(result, ", ")
+}
+
+func writeStatuses(probeStatuses map[string]prober.ProbeStatus, output string) error {
+	if output != OutputJSON {
+		return nil
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(probeStatuses)
 }
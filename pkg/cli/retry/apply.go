@@ -2,29 +2,183 @@ package retry
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
 	"os"
 	"os/exec"
+	"slices"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
-func Retry(ctx context.Context, interval time.Duration, args []string) error {
+const jitterFactor = 0.2
+
+// Options bounds how often and for how long a command is retried.
+type Options struct {
+	// MaxAttempts is the maximum number of times the command is run, 0 means no limit.
+	MaxAttempts int
+	// Timeout is the total duration after which retrying stops and a running command is killed, 0 means no timeout.
+	Timeout time.Duration
+	// Interval is the delay after the first failed attempt, it is doubled after every further failure.
+	Interval time.Duration
+	// MaxInterval caps the delay between two attempts.
+	MaxInterval time.Duration
+	// RetryOnExitCodes, if not empty, are the only exit codes that are retried.
+	RetryOnExitCodes []int
+	// FailOnExitCodes are exit codes that are never retried.
+	FailOnExitCodes []int
+	// Output receives the summary of the attempts when giving up, os.Stderr if nil.
+	Output io.Writer
+}
+
+// A command killed by a signal, e.g. by the OOM killer, has no exit code. It is retried regardless of the retried
+// and failing exit codes, until the attempts are exhausted or the timeout is reached.
+type attempt struct {
+	exitCode int
+	signal   os.Signal
+	duration time.Duration
+	err      error
+}
+
+// Retry runs the command in args until it succeeds, the attempts are exhausted, the timeout is hit or
+// the command exits with a code that is not retryable. A summary of all attempts is printed when giving up.
+func Retry(ctx context.Context, opts Options, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no command to retry")
+	}
+	if opts.Interval <= 0 {
+		return fmt.Errorf("the retry interval must be positive, got %s", opts.Interval)
+	}
+	if opts.MaxInterval < 0 {
+		return fmt.Errorf("the maximum retry interval can't be negative, got %s", opts.MaxInterval)
+	}
+	output := opts.Output
+	if output == nil {
+		output = os.Stderr
+	}
+
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	var (
+		start    = time.Now()
+		attempts []attempt
+		interval = opts.Interval
+	)
 	for {
-		cmd := exec.Command(args[0], args[1:]...)
-		cmd.Stdout = os.Stdout
-		cmd.Stdin = os.Stdin
-		cmd.Stderr = os.Stderr
-		err := cmd.Run()
-		if err != nil {
-			logrus.Errorf("will retry failed command %v: %v", args, err)
-			select {
-			case <-time.After(interval):
-				continue
-			case <-ctx.Done():
+		result := run(ctx, args)
+		attempts = append(attempts, result)
+		if result.err == nil {
+			return nil
+		}
+
+		reason := opts.giveUpReason(result, len(attempts))
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			reason = "timeout reached"
+		} else if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if reason != "" {
+			printSummary(output, args, attempts, time.Since(start), reason)
+			return fmt.Errorf("command %v failed after %d attempt(s): %s", args, len(attempts), reason)
+		}
+
+		delay := withJitter(interval)
+		logrus.Errorf("will retry failed command %v in %s: %v", args, delay.Round(time.Millisecond), result.err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
 				return ctx.Err()
 			}
+			printSummary(output, args, attempts, time.Since(start), "timeout reached")
+			return fmt.Errorf("command %v failed after %d attempt(s): timeout reached", args, len(attempts))
+		}
+
+		interval *= 2
+		if opts.MaxInterval > 0 && interval > opts.MaxInterval {
+			interval = opts.MaxInterval
+		}
+	}
+}
+
+func run(ctx context.Context, args []string) attempt {
+	start := time.Now()
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+
+	result := attempt{
+		duration: time.Since(start),
+		err:      err,
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		result.exitCode = exitErr.ExitCode()
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			result.signal = status.Signal()
+		}
+	} else if err != nil {
+		result.exitCode = -1
+	}
+	return result
+}
+
+// giveUpReason returns why the command should not be retried, or an empty string if it should be.
+func (o Options) giveUpReason(result attempt, attempts int) string {
+	var exitErr *exec.ExitError
+	if !errors.As(result.err, &exitErr) {
+		return fmt.Sprintf("command could not be run: %v", result.err)
+	}
+	if result.signal != nil {
+		// the exit codes do not apply to a command killed by a signal
+		if o.MaxAttempts > 0 && attempts >= o.MaxAttempts {
+			return fmt.Sprintf("reached maximum of %d attempts", o.MaxAttempts)
+		}
+		return ""
+	}
+	if slices.Contains(o.FailOnExitCodes, result.exitCode) {
+		return fmt.Sprintf("exit code %d is not retryable", result.exitCode)
+	}
+	if len(o.RetryOnExitCodes) > 0 && !slices.Contains(o.RetryOnExitCodes, result.exitCode) {
+		return fmt.Sprintf("exit code %d is not retryable", result.exitCode)
+	}
+	if o.MaxAttempts > 0 && attempts >= o.MaxAttempts {
+		return fmt.Sprintf("reached maximum of %d attempts", o.MaxAttempts)
+	}
+	return ""
+}
+
+// withJitter randomizes the interval by up to 20% to keep retrying commands from running in lockstep.
+func withJitter(interval time.Duration) time.Duration {
+	jitter := (rand.Float64()*2 - 1) * jitterFactor * float64(interval) // nolint: gosec
+	return interval + time.Duration(jitter)
+}
+
+func printSummary(w io.Writer, args []string, attempts []attempt, elapsed time.Duration, reason string) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Giving up on command %v after %d attempt(s) in %s (%s):\n",
+		args, len(attempts), elapsed.Round(time.Second), reason)
+	for i, a := range attempts {
+		if a.signal != nil {
+			fmt.Fprintf(&b, "  attempt %d: killed by signal %v after %s", i+1, a.signal, a.duration.Round(time.Millisecond))
+		} else {
+			fmt.Fprintf(&b, "  attempt %d: exit code %d after %s", i+1, a.exitCode, a.duration.Round(time.Millisecond))
+		}
+		if a.exitCode == -1 && a.signal == nil && a.err != nil {
+			fmt.Fprintf(&b, " (%v)", a.err)
 		}
-		return nil
+		b.WriteString("\n")
 	}
+	_, _ = io.WriteString(w, b.String())
 }
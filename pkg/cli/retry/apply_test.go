@@ -0,0 +1,109 @@
+package retry_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/llmos-ai/llmos/pkg/cli/retry"
+)
+
+var _ = Describe("retry", Label("retry"), func() {
+	var (
+		dir    string
+		output *bytes.Buffer
+		opts   retry.Options
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		output = &bytes.Buffer{}
+		opts = retry.Options{Interval: time.Millisecond, MaxInterval: 5 * time.Millisecond, Output: output}
+	})
+
+	// script counts its runs and exits with the code of the run, the last code is kept for the further runs
+	script := func(codes ...string) []string {
+		counter := filepath.Join(dir, "runs")
+		return []string{"/bin/sh", "-c", `echo run >> ` + counter + `; set -- ` + strings.Join(codes, " ") +
+			`; n=$(wc -l < ` + counter + `); while [ $n -gt 1 ] && [ $# -gt 1 ]; do shift; n=$((n-1)); done; exit $1`}
+	}
+
+	runs := func() int {
+		content, err := os.ReadFile(filepath.Join(dir, "runs"))
+		Expect(err).NotTo(HaveOccurred())
+		return strings.Count(string(content), "run\n")
+	}
+
+	It("retries the command until it succeeds", func() {
+		Expect(retry.Retry(context.Background(), opts, script("1", "2", "0"))).To(Succeed())
+		Expect(runs()).To(Equal(3))
+		Expect(output.String()).To(BeEmpty())
+	})
+
+	DescribeTable("gives up",
+		func(configure func(*retry.Options), codes []string, attempts int, reason string) {
+			configure(&opts)
+			err := retry.Retry(context.Background(), opts, script(codes...))
+			Expect(err).To(MatchError(ContainSubstring(reason)))
+			Expect(runs()).To(Equal(attempts))
+		},
+		Entry("on the maximum attempts", func(o *retry.Options) { o.MaxAttempts = 2 },
+			[]string{"1"}, 2, "reached maximum of 2 attempts"),
+		Entry("on a failing exit code", func(o *retry.Options) { o.FailOnExitCodes = []int{3} },
+			[]string{"1", "3"}, 2, "exit code 3 is not retryable"),
+		Entry("on an exit code that is not retried", func(o *retry.Options) { o.RetryOnExitCodes = []int{1} },
+			[]string{"1", "1", "2"}, 3, "exit code 2 is not retryable"),
+	)
+
+	It("gives up if the command can't be run", func() {
+		err := retry.Retry(context.Background(), opts, []string{filepath.Join(dir, "missing")})
+		Expect(err).To(MatchError(ContainSubstring("failed after 1 attempt(s): command could not be run")))
+		Expect(output.String()).To(ContainSubstring("attempt 1: exit code -1 after"))
+	})
+
+	It("retries a command killed by a signal regardless of the exit codes", func() {
+		opts.MaxAttempts = 2
+		opts.RetryOnExitCodes = []int{1}
+		killed := []string{"/bin/sh", "-c", "echo run >> " + filepath.Join(dir, "runs") + "; kill -TERM $$"}
+
+		err := retry.Retry(context.Background(), opts, killed)
+		Expect(err).To(MatchError(ContainSubstring("reached maximum of 2 attempts")))
+		Expect(runs()).To(Equal(2))
+		Expect(output.String()).To(ContainSubstring("attempt 1: killed by signal terminated after"))
+	})
+
+	It("kills the command once the timeout is reached", func() {
+		opts.Timeout = 200 * time.Millisecond
+		start := time.Now()
+		err := retry.Retry(context.Background(), opts, []string{"/bin/sleep", "10"})
+		Expect(err).To(MatchError(ContainSubstring("failed after 1 attempt(s): timeout reached")))
+		Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+		Expect(output.String()).To(ContainSubstring("(timeout reached)"))
+	})
+
+	It("prints a summary of the attempts when giving up", func() {
+		opts.MaxAttempts = 3
+		Expect(retry.Retry(context.Background(), opts, script("4", "5"))).NotTo(Succeed())
+
+		lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+		Expect(lines).To(HaveLen(4))
+		Expect(lines[0]).To(MatchRegexp(`^Giving up on command \[/bin/sh -c .*\] after 3 attempt\(s\) in \d+s ` +
+			`\(reached maximum of 3 attempts\):$`))
+		Expect(lines[1]).To(MatchRegexp(`^  attempt 1: exit code 4 after \d+ms$`))
+		Expect(lines[2]).To(MatchRegexp(`^  attempt 2: exit code 5 after \d+ms$`))
+		Expect(lines[3]).To(MatchRegexp(`^  attempt 3: exit code 5 after \d+ms$`))
+	})
+
+	It("rejects an interval that is not positive", func() {
+		opts.Interval = 0
+		Expect(retry.Retry(context.Background(), opts, []string{"/bin/true"})).
+			To(MatchError(ContainSubstring("the retry interval must be positive")))
+		Expect(filepath.Join(dir, "runs")).NotTo(BeAnExistingFile())
+	})
+})
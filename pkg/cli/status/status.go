@@ -0,0 +1,296 @@
+package status
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/llmos-ai/llmos/pkg/applyinator"
+	"github.com/llmos-ai/llmos/pkg/applyinator/prober"
+	"github.com/llmos-ai/llmos/pkg/bootstrap"
+	"github.com/llmos-ai/llmos/pkg/bootstrap/plan"
+	"github.com/llmos-ai/llmos/pkg/utils/crypt"
+)
+
+const OutputJSON = "json"
+
+// Phases of the node bootstrap
+const (
+	PhaseNotStarted    = "not-started"
+	PhaseBootstrapping = "bootstrapping"
+	PhaseBootstrapped  = "bootstrapped"
+)
+
+type Options struct {
+	// DataDir is the llmos state dir with the stamps and the plan
+	DataDir string
+	// Output format, empty for a human-readable table
+	Output string
+	// Watch refreshes the status every interval until the context is done
+	Watch    bool
+	Interval time.Duration
+	// Lines is the number of output lines shown per instruction
+	Lines int
+}
+
+// NodeStatus is the bootstrap progress of the node.
+type NodeStatus struct {
+	Phase        string                        `json:"phase"`
+	Instructions []InstructionStatus           `json:"instructions"`
+	Probes       map[string]prober.ProbeStatus `json:"probes,omitempty"`
+}
+
+// InstructionStatus is the progress of a single one-time instruction of the node plan.
+type InstructionStatus struct {
+	Name       string                       `json:"name"`
+	State      applyinator.InstructionState `json:"state"`
+	Attempts   int                          `json:"attempts,omitempty"`
+	ExitCode   int                          `json:"exitCode,omitempty"`
+	StartTime  string                       `json:"startTime,omitempty"`
+	FinishTime string                       `json:"finishTime,omitempty"`
+	Duration   string                       `json:"duration,omitempty"`
+	Output     []string                     `json:"output,omitempty"`
+}
+
+// Run prints the bootstrap status of the node to w, repeatedly if watching.
+func Run(ctx context.Context, w io.Writer, opts Options) error {
+	for {
+		status, err := Get(opts.DataDir, opts.Lines)
+		if err != nil {
+			return err
+		}
+		if opts.Watch && opts.Output != OutputJSON {
+			// clear the terminal before refreshing the table
+			fmt.Fprint(w, "\033[H\033[2J")
+		}
+		if err = Print(w, status, opts.Output); err != nil {
+			return err
+		}
+		if !opts.Watch {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(opts.Interval):
+		}
+	}
+}
+
+// Get reads the bootstrap stamps, plan, output and state under the data dir and runs the plan probes once.
+func Get(dataDir string, lines int) (*NodeStatus, error) {
+	l := bootstrap.New(bootstrap.Config{DataDir: dataDir})
+	status := &NodeStatus{
+		Phase:        PhaseNotStarted,
+		Instructions: []InstructionStatus{},
+	}
+	if exists(l.DoneStamp()) {
+		status.Phase = PhaseBootstrapped
+	} else if exists(l.WorkingStamp()) {
+		status.Phase = PhaseBootstrapping
+	}
+
+	nodePlan, err := readPlan(plan.GetPlanFile(dataDir))
+	if err != nil || nodePlan == nil {
+		return status, err
+	}
+
+	// the plan file is redacted so its checksum can't be compared, the state is reset by the
+	// applyinator once it starts to apply a new plan
+	state, err := applyinator.ReadPlanState(plan.GetPlanStateFile(dataDir))
+	if err != nil {
+		return nil, fmt.Errorf("reading plan state: %w", err)
+	}
+
+	outputs, err := readOutput(plan.GetPlanOutput(dataDir))
+	if err != nil {
+		return nil, fmt.Errorf("reading plan output: %w", err)
+	}
+
+	for _, instruction := range nodePlan.OneTimeInstructions {
+		status.Instructions = append(status.Instructions,
+			toInstructionStatus(instruction.Name, state.Instructions[instruction.Name], outputs[instruction.Name], lines))
+	}
+
+	if len(nodePlan.Probes) > 0 {
+		status.Probes = runProbes(nodePlan.Probes)
+	}
+	return status, nil
+}
+
+func toInstructionStatus(name string, recorded applyinator.InstructionStatus, output []byte, lines int) InstructionStatus {
+	result := InstructionStatus{
+		Name:       name,
+		State:      recorded.State,
+		Attempts:   recorded.Attempts,
+		ExitCode:   recorded.ExitCode,
+		StartTime:  recorded.StartTime,
+		FinishTime: recorded.FinishTime,
+		Output:     lastLines(output, lines),
+	}
+	if result.State == "" {
+		result.State = applyinator.InstructionPending
+	}
+
+	start, err := time.Parse(time.UnixDate, recorded.StartTime)
+	if err != nil {
+		return result
+	}
+	finish := time.Now()
+	if recorded.FinishTime != "" {
+		if finish, err = time.Parse(time.UnixDate, recorded.FinishTime); err != nil {
+			return result
+		}
+	}
+	if finish.After(start) {
+		result.Duration = finish.Sub(start).Round(time.Second).String()
+	}
+	return result
+}
+
+// runProbes runs every probe of the plan once and returns its current health.
+func runProbes(probes map[string]prober.Probe) map[string]prober.ProbeStatus {
+	current := make(map[string]prober.Probe, len(probes))
+	for name, p := range probes {
+		// a single successful run is enough to report the probe as healthy
+		p.SuccessThreshold = 1
+		current[name] = p
+	}
+	statuses := map[string]prober.ProbeStatus{}
+	prober.DoProbes(current, statuses, false)
+	return statuses
+}
+
+// readPlan reads the plan file, a nil plan is returned if there is no plan yet.
+func readPlan(path string) (*applyinator.Plan, error) {
+	content, err := crypt.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	nodePlan := &applyinator.Plan{}
+	if err = json.Unmarshal(content, nodePlan); err != nil {
+		return nil, fmt.Errorf("decoding plan %s: %w", path, err)
+	}
+	return nodePlan, nil
+}
+
+func readOutput(path string) (map[string][]byte, error) {
+	outputs := map[string][]byte{}
+	content, err := crypt.ReadFile(path)
+	if os.IsNotExist(err) || len(content) == 0 {
+		return outputs, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(content, &outputs); err != nil {
+		return nil, err
+	}
+	return outputs, nil
+}
+
+func lastLines(output []byte, n int) []string {
+	trimmed := strings.TrimRight(string(output), "\n")
+	if trimmed == "" || n <= 0 {
+		return nil
+	}
+	lines := strings.Split(trimmed, "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Print writes the node status to w in the given output format.
+func Print(w io.Writer, status *NodeStatus, output string) error {
+	if output == OutputJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(status)
+	}
+
+	fmt.Fprintf(w, "Bootstrap: %s\n\n", status.Phase)
+	if len(status.Instructions) == 0 {
+		fmt.Fprintln(w, "No plan found")
+		return nil
+	}
+
+	// the rows are aligned on their own, the output lines printed below them would split the columns
+	var rows bytes.Buffer
+	tw := tabwriter.NewWriter(&rows, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "INSTRUCTION\tSTATE\tATTEMPTS\tDURATION")
+	for _, instruction := range status.Instructions {
+		state := string(instruction.State)
+		if instruction.State == applyinator.InstructionFailed {
+			state = fmt.Sprintf("%s (exit %d)", state, instruction.ExitCode)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", instruction.Name, state, instruction.Attempts, orDash(instruction.Duration))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	lines := strings.Split(rows.String(), "\n")
+	fmt.Fprintln(w, lines[0])
+	for i, instruction := range status.Instructions {
+		fmt.Fprintln(w, lines[i+1])
+		for _, line := range instruction.Output {
+			fmt.Fprintf(w, "  | %s\n", line)
+		}
+	}
+
+	if len(status.Probes) == 0 {
+		return nil
+	}
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROBE\tHEALTH\tOUTPUT")
+	for _, name := range sortedKeys(status.Probes) {
+		probeStatus := status.Probes[name]
+		health := "unhealthy"
+		if probeStatus.Healthy {
+			health = "healthy"
+		}
+		detail := probeStatus.LastError
+		if detail == "" {
+			detail = strings.TrimSpace(probeStatus.LastOutput)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", name, health, orDash(firstLine(detail)))
+	}
+	return tw.Flush()
+}
+
+func sortedKeys(m map[string]prober.ProbeStatus) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,163 @@
+package status_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/llmos-ai/llmos/pkg/applyinator"
+	"github.com/llmos-ai/llmos/pkg/applyinator/prober"
+	"github.com/llmos-ai/llmos/pkg/bootstrap"
+	"github.com/llmos-ai/llmos/pkg/bootstrap/plan"
+	"github.com/llmos-ai/llmos/pkg/cli/status"
+)
+
+var _ = Describe("node status", Label("status"), func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+	})
+
+	writeJSON := func(path string, value interface{}) {
+		content, err := json.Marshal(value)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.MkdirAll(filepath.Dir(path), 0700)).To(Succeed())
+		Expect(os.WriteFile(path, content, 0600)).To(Succeed())
+	}
+
+	// writeFixture records a bootstrap that failed at its second instruction
+	writeFixture := func() {
+		stamps := bootstrap.New(bootstrap.Config{DataDir: dir})
+		writeJSON(stamps.WorkingStamp(), map[string]string{})
+
+		instruction := func(name string) applyinator.OneTimeInstruction {
+			return applyinator.OneTimeInstruction{CommonInstruction: applyinator.CommonInstruction{Name: name, Command: "/bin/true"}}
+		}
+		writeJSON(plan.GetPlanFile(dir), applyinator.Plan{
+			OneTimeInstructions: []applyinator.OneTimeInstruction{instruction("runtime"), instruction("operator"), instruction("probes")},
+			Probes: map[string]prober.Probe{
+				"kubelet": {FileExistsAction: &prober.FileExistsAction{Path: filepath.Join(dir, "missing")}},
+				"config":  {FileExistsAction: &prober.FileExistsAction{Path: plan.GetPlanFile(dir)}},
+			},
+			Redacted: true,
+		})
+
+		start := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+		writeJSON(plan.GetPlanStateFile(dir), applyinator.PlanState{
+			Checksum: "checksum",
+			Instructions: map[string]applyinator.InstructionStatus{
+				"runtime": {State: applyinator.InstructionSucceeded, Attempts: 1,
+					StartTime: start.Format(time.UnixDate), FinishTime: start.Add(90 * time.Second).Format(time.UnixDate)},
+				"operator": {State: applyinator.InstructionFailed, Attempts: 3, ExitCode: 2,
+					StartTime: start.Format(time.UnixDate), FinishTime: start.Add(5 * time.Second).Format(time.UnixDate)},
+			},
+		})
+		writeJSON(plan.GetPlanOutput(dir), map[string][]byte{
+			"runtime":  []byte("downloading\ninstalling\nstarting\nstarted\n\n"),
+			"operator": []byte("timed out\n"),
+		})
+	}
+
+	It("reports that the node was not bootstrapped without stamps and plan", func() {
+		nodeStatus, err := status.Get(dir, 3)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nodeStatus.Phase).To(Equal(status.PhaseNotStarted))
+		Expect(nodeStatus.Instructions).To(BeEmpty())
+
+		var out bytes.Buffer
+		Expect(status.Print(&out, nodeStatus, "")).To(Succeed())
+		Expect(out.String()).To(Equal("Bootstrap: not-started\n\nNo plan found\n"))
+	})
+
+	It("reports the phase, the state of the instructions and the health of the probes", func() {
+		writeFixture()
+
+		nodeStatus, err := status.Get(dir, 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nodeStatus.Phase).To(Equal(status.PhaseBootstrapping))
+		Expect(nodeStatus.Instructions).To(HaveLen(3))
+
+		runtime := nodeStatus.Instructions[0]
+		Expect(runtime.State).To(Equal(applyinator.InstructionSucceeded))
+		Expect(runtime.Duration).To(Equal("1m30s"))
+		// only the last lines are shown, trailing empty lines are dropped
+		Expect(runtime.Output).To(Equal([]string{"starting", "started"}))
+
+		operator := nodeStatus.Instructions[1]
+		Expect(operator.State).To(Equal(applyinator.InstructionFailed))
+		Expect(operator.Attempts).To(Equal(3))
+		Expect(operator.ExitCode).To(Equal(2))
+		Expect(operator.Output).To(Equal([]string{"timed out"}))
+
+		probes := nodeStatus.Instructions[2]
+		Expect(probes.State).To(Equal(applyinator.InstructionPending))
+		Expect(probes.Duration).To(BeEmpty())
+		Expect(probes.Output).To(BeEmpty())
+
+		Expect(nodeStatus.Probes).To(HaveLen(2))
+		Expect(nodeStatus.Probes["config"].Healthy).To(BeTrue())
+		Expect(nodeStatus.Probes["kubelet"].Healthy).To(BeFalse())
+
+		Expect(bootstrap.New(bootstrap.Config{DataDir: dir}).DoneStamp()).NotTo(BeAnExistingFile())
+		writeJSON(bootstrap.New(bootstrap.Config{DataDir: dir}).DoneStamp(), map[string]string{})
+		nodeStatus, err = status.Get(dir, 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nodeStatus.Phase).To(Equal(status.PhaseBootstrapped))
+	})
+
+	It("prints the status as a table", func() {
+		writeFixture()
+		nodeStatus, err := status.Get(dir, 1)
+		Expect(err).NotTo(HaveOccurred())
+		nodeStatus.Probes = map[string]prober.ProbeStatus{
+			"config":  {Healthy: true},
+			"kubelet": {LastError: "file does not exist\nsecond line"},
+		}
+
+		var out bytes.Buffer
+		Expect(status.Print(&out, nodeStatus, "")).To(Succeed())
+		Expect(out.String()).To(Equal(`Bootstrap: bootstrapping
+
+INSTRUCTION  STATE            ATTEMPTS  DURATION
+runtime      succeeded        1         1m30s
+  | started
+operator     failed (exit 2)  3         5s
+  | timed out
+probes       pending          0         -
+
+PROBE    HEALTH     OUTPUT
+config   healthy    -
+kubelet  unhealthy  file does not exist
+`))
+	})
+
+	It("prints the status as JSON", func() {
+		writeFixture()
+		nodeStatus, err := status.Get(dir, 1)
+		Expect(err).NotTo(HaveOccurred())
+
+		var out bytes.Buffer
+		Expect(status.Print(&out, nodeStatus, status.OutputJSON)).To(Succeed())
+		decoded := status.NodeStatus{}
+		Expect(json.Unmarshal(out.Bytes(), &decoded)).To(Succeed())
+		Expect(decoded.Phase).To(Equal(status.PhaseBootstrapping))
+		Expect(decoded.Instructions[1].Name).To(Equal("operator"))
+	})
+
+	It("refreshes the status on the writer in watch mode", func() {
+		writeFixture()
+		ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+		defer cancel()
+
+		var out bytes.Buffer
+		Expect(status.Run(ctx, &out, status.Options{DataDir: dir, Watch: true, Interval: 100 * time.Millisecond})).To(Succeed())
+		Expect(bytes.Count(out.Bytes(), []byte("\033[H\033[2JBootstrap: bootstrapping\n"))).To(BeNumerically(">=", 2))
+	})
+})
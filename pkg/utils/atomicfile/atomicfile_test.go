@@ -0,0 +1,35 @@
+package atomicfile_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/llmos-ai/llmos/pkg/utils/atomicfile"
+)
+
+var _ = Describe("atomic file writes", Label("atomicfile"), func() {
+	It("replaces the file with the content and permissions", func() {
+		dir := GinkgoT().TempDir()
+		path := filepath.Join(dir, "state.json")
+		Expect(os.WriteFile(path, []byte("previous content"), 0644)).To(Succeed())
+
+		Expect(atomicfile.WriteFile(path, []byte("new"), 0600)).To(Succeed())
+		Expect(os.ReadFile(path)).To(Equal([]byte("new")))
+		info, err := os.Stat(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+		// the temporary file is renamed
+		entries, err := os.ReadDir(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+	})
+
+	It("fails if the directory does not exist", func() {
+		err := atomicfile.WriteFile(filepath.Join(GinkgoT().TempDir(), "missing", "state.json"), nil, 0600)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+package atomicfile
+
+import "os"
+
+// SyncDir flushes the directory entries, so that a file renamed into the directory survives a crash.
+func SyncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
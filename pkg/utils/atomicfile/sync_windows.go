@@ -0,0 +1,9 @@
+//go:build windows
+// +build windows
+
+package atomicfile
+
+// SyncDir is a no op on Windows, directories can't be synced.
+func SyncDir(_ string) error {
+	return nil
+}
@@ -0,0 +1,310 @@
+// Package crypt encrypts the state files llmos keeps under its data dir with envelope encryption. Every file is
+// encrypted with its own random data key, which is wrapped with a node-local key read from a key file or derived
+// from a passphrase file. The encrypted files record where their key comes from, so they are decrypted
+// transparently by ReadFile without any configuration.
+package crypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+
+	"github.com/llmos-ai/llmos/pkg/utils/atomicfile"
+)
+
+const (
+	// DefaultKeyFile is the key file used if encryption is enabled without a key or passphrase file.
+	DefaultKeyFile = "/etc/llmos/encryption.key"
+
+	envelopeVersion = "llmos/v1"
+	keySize         = 32
+	saltSize        = 16
+)
+
+// envelopePrefix starts every encrypted file and tells it apart from the plain JSON and YAML state files.
+var envelopePrefix = []byte(`{"encryption":"` + envelopeVersion + `"`)
+
+// Config enables the encryption and selects its node-local key, either a key file holding a base64 encoded
+// 256-bit key or a passphrase file. A missing file is created with a random key or passphrase.
+type Config struct {
+	Enabled        bool   `json:"enabled,omitempty"`
+	KeyFile        string `json:"keyFile,omitempty"`
+	PassphraseFile string `json:"passphraseFile,omitempty"`
+}
+
+// Validate checks that at most one of the key and passphrase file is set, and that the paths are absolute
+// as they are recorded in the encrypted files.
+func (c *Config) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.KeyFile != "" && c.PassphraseFile != "" {
+		return errors.New("only one of keyFile and passphraseFile can be set")
+	}
+	for _, path := range []string{c.KeyFile, c.PassphraseFile} {
+		if path != "" && !filepath.IsAbs(path) {
+			return fmt.Errorf("encryption key path %s must be absolute", path)
+		}
+	}
+	return nil
+}
+
+func (c *Config) enabled() bool {
+	return c != nil && c.Enabled
+}
+
+// envelope is the content of an encrypted file.
+type envelope struct {
+	Encryption     string `json:"encryption"`
+	KeyFile        string `json:"keyFile,omitempty"`
+	PassphraseFile string `json:"passphraseFile,omitempty"`
+	// Salt derives the key encryption key from the passphrase
+	Salt []byte `json:"salt,omitempty"`
+	// Key is the data key encrypted with the key encryption key
+	Key  []byte `json:"key"`
+	Data []byte `json:"data"`
+}
+
+// Cipher encrypts files with the node-local key, a nil Cipher leaves the content as is.
+type Cipher struct {
+	keyFile        string
+	passphraseFile string
+	salt           []byte
+	kek            []byte
+}
+
+// Open returns the cipher of the config, creating the key or passphrase file if it does not exist yet.
+// A nil cipher is returned if the encryption is not enabled.
+func Open(cfg *Config) (*Cipher, error) {
+	if !cfg.enabled() {
+		return nil, nil
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	c := &Cipher{keyFile: cfg.KeyFile, passphraseFile: cfg.PassphraseFile}
+	if c.passphraseFile != "" {
+		if err := createSecretFile(c.passphraseFile); err != nil {
+			return nil, err
+		}
+		c.salt = make([]byte, saltSize)
+		if _, err := rand.Read(c.salt); err != nil {
+			return nil, err
+		}
+	} else {
+		if c.keyFile == "" {
+			c.keyFile = DefaultKeyFile
+		}
+		if err := createSecretFile(c.keyFile); err != nil {
+			return nil, err
+		}
+	}
+
+	kek, err := keyEncryptionKey(c.keyFile, c.passphraseFile, c.salt)
+	if err != nil {
+		return nil, err
+	}
+	c.kek = kek
+	return c, nil
+}
+
+// Encrypt returns the envelope of the data, or the data itself if the cipher is nil.
+func (c *Cipher) Encrypt(data []byte) ([]byte, error) {
+	if c == nil {
+		return data, nil
+	}
+
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	encryptedData, err := seal(dataKey, data)
+	if err != nil {
+		return nil, err
+	}
+	encryptedKey, err := seal(c.kek, dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(envelope{
+		Encryption:     envelopeVersion,
+		KeyFile:        c.keyFile,
+		PassphraseFile: c.passphraseFile,
+		Salt:           c.salt,
+		Key:            encryptedKey,
+		Data:           encryptedData,
+	})
+}
+
+// WriteFile encrypts the data with the cipher and replaces the file with it atomically, so that a crash leaves the
+// previous envelope in place rather than one that can't be decrypted.
+func (c *Cipher) WriteFile(path string, data []byte, perm os.FileMode) error {
+	data, err := c.Encrypt(data)
+	if err != nil {
+		return fmt.Errorf("encrypting %s: %w", path, err)
+	}
+	return atomicfile.WriteFile(path, data, perm)
+}
+
+// IsEncrypted returns whether the data is an envelope written by a cipher.
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, envelopePrefix)
+}
+
+// Decrypt returns the data of the envelope with the key it was encrypted with, data that is not
+// encrypted is returned as is.
+func Decrypt(data []byte) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return data, nil
+	}
+
+	e := envelope{}
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("decoding encrypted data: %w", err)
+	}
+	kek, err := keyEncryptionKey(e.KeyFile, e.PassphraseFile, e.Salt)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := open(kek, e.Key)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting data key: %w", err)
+	}
+	return open(dataKey, e.Data)
+}
+
+// ReadFile reads the file and decrypts it if it is encrypted.
+func ReadFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err = Decrypt(data)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting %s: %w", path, err)
+	}
+	return data, nil
+}
+
+var (
+	kekCache   = map[string][]byte{}
+	kekCacheMu sync.Mutex
+)
+
+// keyEncryptionKey reads the key file or derives the key from the passphrase file and the salt.
+// Deriving the key is slow on purpose, so the keys are cached.
+func keyEncryptionKey(keyFile, passphraseFile string, salt []byte) ([]byte, error) {
+	cacheKey := keyFile + "\x00" + passphraseFile + "\x00" + string(salt)
+	kekCacheMu.Lock()
+	defer kekCacheMu.Unlock()
+	if kek, ok := kekCache[cacheKey]; ok {
+		return kek, nil
+	}
+
+	var kek []byte
+	switch {
+	case passphraseFile != "":
+		passphrase, err := os.ReadFile(passphraseFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading passphrase file: %w", err)
+		}
+		trimmed := strings.TrimSpace(string(passphrase))
+		if trimmed == "" {
+			return nil, fmt.Errorf("passphrase file %s is empty", passphraseFile)
+		}
+		kek, err = scrypt.Key([]byte(trimmed), salt, 1<<15, 8, 1, keySize)
+		if err != nil {
+			return nil, err
+		}
+	case keyFile != "":
+		content, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading key file: %w", err)
+		}
+		kek, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(content)))
+		if err != nil {
+			return nil, fmt.Errorf("decoding key file %s: %w", keyFile, err)
+		}
+		if len(kek) != keySize {
+			return nil, fmt.Errorf("key file %s must hold a base64 encoded %d-byte key", keyFile, keySize)
+		}
+	default:
+		return nil, errors.New("neither a key file nor a passphrase file is set")
+	}
+
+	kekCache[cacheKey] = kek
+	return kek, nil
+}
+
+// createSecretFile writes a random base64 encoded key to the path if it does not exist yet,
+// it is used for both key and passphrase files.
+func createSecretFile(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0400)
+	if err != nil {
+		return fmt.Errorf("creating key file: %w", err)
+	}
+	if _, err = f.WriteString(base64.StdEncoding.EncodeToString(key) + "\n"); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// seal encrypts the data with AES-256-GCM, the nonce is prepended to the result.
+func seal(key, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, data, nil), nil
+}
+
+func open(key, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("encrypted data is too short")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
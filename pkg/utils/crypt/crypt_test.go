@@ -0,0 +1,92 @@
+package crypt_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/llmos-ai/llmos/pkg/utils/crypt"
+)
+
+var _ = Describe("envelope encryption", Label("crypt"), func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+	})
+
+	It("leaves the content as is if encryption is not enabled", func() {
+		cipher, err := crypt.Open(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cipher).To(BeNil())
+
+		path := filepath.Join(dir, "plan.json")
+		Expect(cipher.WriteFile(path, []byte(`{"files":[]}`), 0600)).To(Succeed())
+		Expect(os.ReadFile(path)).To(Equal([]byte(`{"files":[]}`)))
+		Expect(crypt.ReadFile(path)).To(Equal([]byte(`{"files":[]}`)))
+	})
+
+	It("replaces the files rather than rewriting them in place", func() {
+		cipher, err := crypt.Open(&crypt.Config{Enabled: true, KeyFile: filepath.Join(dir, "encryption.key")})
+		Expect(err).NotTo(HaveOccurred())
+		path := filepath.Join(dir, "plan.json")
+		Expect(cipher.WriteFile(path, []byte("first"), 0600)).To(Succeed())
+		// a reader holding the previous file keeps a whole envelope
+		Expect(os.Link(path, filepath.Join(dir, "previous"))).To(Succeed())
+
+		Expect(cipher.WriteFile(path, []byte("second"), 0600)).To(Succeed())
+		Expect(crypt.ReadFile(path)).To(Equal([]byte("second")))
+		Expect(crypt.ReadFile(filepath.Join(dir, "previous"))).To(Equal([]byte("first")))
+		entries, err := os.ReadDir(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(3))
+	})
+
+	DescribeTable("creates the key at the first use and decrypts the files transparently",
+		func(cfg func() *crypt.Config, keyFile string) {
+			cipher, err := crypt.Open(cfg())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(filepath.Join(dir, keyFile)).To(BeARegularFile())
+
+			path := filepath.Join(dir, "plan.json")
+			Expect(cipher.WriteFile(path, []byte("token: secret"), 0600)).To(Succeed())
+			content, err := os.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(crypt.IsEncrypted(content)).To(BeTrue())
+			Expect(string(content)).NotTo(ContainSubstring("secret"))
+
+			// the key is reused once it exists
+			reopened, err := crypt.Open(cfg())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reopened.WriteFile(filepath.Join(dir, "other"), []byte("other"), 0600)).To(Succeed())
+
+			Expect(crypt.ReadFile(path)).To(Equal([]byte("token: secret")))
+			Expect(crypt.ReadFile(filepath.Join(dir, "other"))).To(Equal([]byte("other")))
+		},
+		Entry("key file", func() *crypt.Config {
+			return &crypt.Config{Enabled: true, KeyFile: filepath.Join(dir, "encryption.key")}
+		}, "encryption.key"),
+		Entry("passphrase file", func() *crypt.Config {
+			return &crypt.Config{Enabled: true, PassphraseFile: filepath.Join(dir, "passphrase")}
+		}, "passphrase"),
+	)
+
+	It("fails to decrypt tampered data", func() {
+		cipher, err := crypt.Open(&crypt.Config{Enabled: true, KeyFile: filepath.Join(dir, "encryption.key")})
+		Expect(err).NotTo(HaveOccurred())
+		encrypted, err := cipher.Encrypt([]byte("secret"))
+		Expect(err).NotTo(HaveOccurred())
+
+		tampered := bytes.Replace(encrypted, []byte(`"data":"`), []byte(`"data":"AAAA`), 1)
+		_, err = crypt.Decrypt(tampered)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rejects invalid configs", func() {
+		Expect((&crypt.Config{Enabled: true, KeyFile: "/a", PassphraseFile: "/b"}).Validate()).To(HaveOccurred())
+		Expect((&crypt.Config{KeyFile: "relative.key"}).Validate()).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,218 @@
+// Package signature signs plans with detached ed25519 signatures and verifies them against the trusted public keys
+// of the node. The keys are PEM encoded the way `openssl genpkey -algorithm ed25519` writes them, and a signature is
+// the base64 encoded ed25519 signature of the plan file, kept next to the plan in a file with a .sig suffix.
+package signature
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// DefaultTrustDir holds the public keys plans are trusted to be signed with.
+	DefaultTrustDir = "/etc/llmos/trust"
+	// FileSuffix is appended to the path of the plan file to get the path of its signature.
+	FileSuffix = ".sig"
+
+	publicKeySuffix = ".pub"
+)
+
+// ErrUnsigned is returned when a plan has no signature but signatures are enforced.
+var ErrUnsigned = errors.New("plan is not signed")
+
+// Config enforces that the plans applied by llmos are signed with a trusted key.
+type Config struct {
+	Enforce bool `json:"enforce,omitempty"`
+	// TrustDir holds the trusted public keys as <name>.pub files, default /etc/llmos/trust
+	TrustDir string `json:"trustDir,omitempty"`
+}
+
+// Validate checks that the trust dir is an absolute path.
+func (c *Config) Validate() error {
+	if c == nil || c.TrustDir == "" {
+		return nil
+	}
+	if !filepath.IsAbs(c.TrustDir) {
+		return fmt.Errorf("trust dir %s must be absolute", c.TrustDir)
+	}
+	return nil
+}
+
+// Open returns the trust store plans are verified against, nil if the signatures are not enforced.
+func Open(cfg *Config) (*TrustStore, error) {
+	if cfg == nil || !cfg.Enforce {
+		return nil, nil
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	dir := cfg.TrustDir
+	if dir == "" {
+		dir = DefaultTrustDir
+	}
+	trust, err := LoadTrustStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(trust.keys) == 0 {
+		return nil, fmt.Errorf("signed plans are enforced but %s has no trusted keys", dir)
+	}
+	return trust, nil
+}
+
+// TrustStore holds the trusted public keys by their name.
+type TrustStore struct {
+	keys map[string]ed25519.PublicKey
+}
+
+// LoadTrustStore reads the <name>.pub public keys of the directory, a missing directory has no keys.
+func LoadTrustStore(dir string) (*TrustStore, error) {
+	trust := &TrustStore{keys: map[string]ed25519.PublicKey{}}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return trust, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), publicKeySuffix) {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		key, err := ParsePublicKey(content)
+		if err != nil {
+			return nil, fmt.Errorf("reading trusted key %s: %w", entry.Name(), err)
+		}
+		trust.keys[strings.TrimSuffix(entry.Name(), publicKeySuffix)] = key
+	}
+	return trust, nil
+}
+
+// Keys returns the names of the trusted keys.
+func (t *TrustStore) Keys() []string {
+	if t == nil {
+		return nil
+	}
+	names := make([]string, 0, len(t.keys))
+	for name := range t.keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Verify checks the base64 encoded signature of the content and returns the name of the key it was signed with.
+func (t *TrustStore) Verify(content, signature []byte) (string, error) {
+	if len(signature) == 0 {
+		return "", ErrUnsigned
+	}
+	if t == nil || len(t.keys) == 0 {
+		return "", errors.New("no trusted keys to verify the signature with")
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return "", fmt.Errorf("decoding signature: %w", err)
+	}
+	for _, name := range t.Keys() {
+		if ed25519.Verify(t.keys[name], content, sig) {
+			return name, nil
+		}
+	}
+	return "", errors.New("signature does not match a trusted key, the plan was tampered with or signed with an untrusted key")
+}
+
+// Sign returns the base64 encoded signature of the content.
+func Sign(content []byte, key ed25519.PrivateKey) []byte {
+	return []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(key, content)) + "\n")
+}
+
+// ReadSignature returns the signature of the plan file at the path, nil if the plan is not signed.
+func ReadSignature(path string) ([]byte, error) {
+	signature, err := os.ReadFile(path + FileSuffix)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return signature, err
+}
+
+// GenerateKey writes a new PEM encoded private key to the path and its public key next to it with a .pub suffix.
+func GenerateKey(path string) error {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	// never replace an existing key, the plans signed with it could not be verified anymore
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err = pem.Encode(file, &pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}); err != nil {
+		return err
+	}
+	return os.WriteFile(strings.TrimSuffix(path, filepath.Ext(path))+publicKeySuffix,
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0644)
+}
+
+// LoadPrivateKey reads the PEM encoded ed25519 private key at the path.
+func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s is not a PEM encoded private key", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an ed25519 key", path)
+	}
+	return private, nil
+}
+
+// ParsePublicKey parses a PEM encoded ed25519 public key.
+func ParsePublicKey(content []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(content)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, errors.New("not a PEM encoded public key")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	public, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("not an ed25519 key")
+	}
+	return public, nil
+}
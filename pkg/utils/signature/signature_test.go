@@ -0,0 +1,64 @@
+package signature_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/llmos-ai/llmos/pkg/utils/signature"
+)
+
+var _ = Describe("plan signatures", Label("signature"), func() {
+	var (
+		dir  string
+		plan = []byte("instructions:\n- name: sysctl\n  command: sysctl\n")
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		Expect(signature.GenerateKey(filepath.Join(dir, "keys", "ops.key"))).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(dir, "trust"), 0700)).To(Succeed())
+		Expect(os.Rename(filepath.Join(dir, "keys", "ops.pub"), filepath.Join(dir, "trust", "ops.pub"))).To(Succeed())
+	})
+
+	It("verifies a plan signed with a trusted key", func() {
+		key, err := signature.LoadPrivateKey(filepath.Join(dir, "keys", "ops.key"))
+		Expect(err).NotTo(HaveOccurred())
+		trust, err := signature.Open(&signature.Config{Enforce: true, TrustDir: filepath.Join(dir, "trust")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trust.Keys()).To(Equal([]string{"ops"}))
+
+		sig := signature.Sign(plan, key)
+		Expect(trust.Verify(plan, sig)).To(Equal("ops"))
+
+		tampered := append([]byte(nil), plan...)
+		tampered[len(tampered)-2] = 'x'
+		_, err = trust.Verify(tampered, sig)
+		Expect(err).To(MatchError(ContainSubstring("does not match a trusted key")))
+		_, err = trust.Verify(plan, nil)
+		Expect(err).To(MatchError(signature.ErrUnsigned))
+	})
+
+	It("rejects a signature of an untrusted key", func() {
+		Expect(signature.GenerateKey(filepath.Join(dir, "other.key"))).To(Succeed())
+		key, err := signature.LoadPrivateKey(filepath.Join(dir, "other.key"))
+		Expect(err).NotTo(HaveOccurred())
+		trust, err := signature.LoadTrustStore(filepath.Join(dir, "trust"))
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = trust.Verify(plan, signature.Sign(plan, key))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("never replaces an existing key", func() {
+		Expect(signature.GenerateKey(filepath.Join(dir, "keys", "ops.key"))).NotTo(Succeed())
+	})
+
+	It("is not enforced by default and refuses to enforce without trusted keys", func() {
+		Expect(signature.Open(nil)).To(BeNil())
+		_, err := signature.Open(&signature.Config{Enforce: true, TrustDir: filepath.Join(dir, "missing")})
+		Expect(err).To(MatchError(ContainSubstring("has no trusted keys")))
+	})
+})
@@ -61,11 +61,13 @@ setup_env() {
 
     # --- set related files from system name ---
     SERVICE_LLMOS=${SYSTEM_NAME}.service
+    SERVICE_LLMOS_AGENT=${SYSTEM_NAME}-agent.service
 
     # --- use service or environment location depending on systemd/openrc ---
 	if [ "${HAS_SYSTEMD}" = true ]; then
 		FILE_LLMOS_SERVICE=${SYSTEMD_DIR}/${SERVICE_LLMOS}
 		FILE_LLMOS_ENV=${SYSTEMD_DIR}/${SERVICE_LLMOS}.env
+		FILE_LLMOS_AGENT_SERVICE=${SYSTEMD_DIR}/${SERVICE_LLMOS_AGENT}
     elif [ "${HAS_OPENRC}" = true ]; then
 		FILE_LLMOS_SERVICE=/etc/init.d/${SYSTEM_NAME}
 		FILE_LLMOS_ENV=/etc/llmos/${SYSTEM_NAME}.env
@@ -98,6 +100,12 @@ setup_env() {
 }
 
 uninstall_llmos() {
+	if [ -n "${FILE_LLMOS_AGENT_SERVICE}" ] && [ -f "${FILE_LLMOS_AGENT_SERVICE}" ]; then
+		info "Uninstalling ${SYSTEM_NAME}-agent service"
+		$SUDO systemctl disable --now ${SERVICE_LLMOS_AGENT}
+		$SUDO rm -f "${FILE_LLMOS_AGENT_SERVICE}"
+	fi
+
 	if [ -f "${FILE_LLMOS_SERVICE}" ]; then
 		info "Uninstalling ${SYSTEM_NAME} service"
 		if [ "${HAS_SYSTEMD}" = true ]; then